@@ -38,7 +38,8 @@ var conf = oauth2.Config{
 	},
 	RedirectURL: "urn:ietf:wg:oauth:2.0:oob",
 	Scopes: []string{"https://www.googleapis.com/auth/devstorage.full_control",
-		"https://www.googleapis.com/auth/compute"},
+		"https://www.googleapis.com/auth/compute",
+		"https://www.googleapis.com/auth/cloudkms"},
 }
 
 func writeCache(cachePath string, tok *oauth2.Token) error {
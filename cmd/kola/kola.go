@@ -36,6 +36,8 @@ import (
 var (
 	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "kola")
 
+	rerunFailed string
+
 	root = &cobra.Command{
 		Use:   "kola [command]",
 		Short: "The CoreOS Superdeep Borehole",
@@ -50,9 +52,21 @@ var (
 If the glob pattern is exactly equal to the name of a single test, any
 restrictions on the versions of Container Linux supported by that test
 will be ignored.
+
+Subtests of grouped tests are selected by globs after a "/", one per
+level of subtests. The group's ClusterSetup still runs. For example:
+
+    kola run docker.base/networks-reliably
+
+For selections a glob can't express, --match and --exclude take regular
+expressions which must match whole test names. They refine the glob: a
+test runs if it matches the glob, any --match expression (when given), and
+no --exclude expression. For example:
+
+    kola run --match 'docker\.(base|network)' --exclude '.*userns'
 `,
 		Run:    runRun,
-		PreRun: preRun,
+		PreRun: preRunPlatforms,
 	}
 
 	cmdList = &cobra.Command{
@@ -63,6 +77,9 @@ will be ignored.
 )
 
 func init() {
+	cmdRun.Flags().Var((*stringArray)(&kola.MatchRegexps), "match", "run only tests whose full names match this regular expression; may be repeated")
+	cmdRun.Flags().Var((*stringArray)(&kola.ExcludeRegexps), "exclude", "skip tests whose full names match this regular expression; may be repeated")
+	cmdRun.Flags().StringVar(&rerunFailed, "rerun-failed", "", "run only the tests which failed in the run with this output directory")
 	root.AddCommand(cmdRun)
 	root.AddCommand(cmdList)
 }
@@ -71,13 +88,31 @@ func main() {
 	cli.Execute(root)
 }
 
+// preRun prepares commands which use a single platform.
 func preRun(cmd *cobra.Command, args []string) {
+	if len(selectedPlatforms()) > 1 {
+		fmt.Fprintf(os.Stderr, "Error: kola %s accepts a single --platform, not %q\n", cmd.Name(), kolaPlatform)
+		os.Exit(2)
+	}
+	preRunPlatforms(cmd, args)
+}
+
+// preRunPlatforms prepares kola run, which accepts a comma-separated list
+// of platforms.
+func preRunPlatforms(cmd *cobra.Command, args []string) {
 	err := syncOptions()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(3)
 	}
 
+	for _, pltfrm := range selectedPlatforms() {
+		if err := kola.ResolveImage(pltfrm); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(3)
+		}
+	}
+
 	// Packet uses storage, and storage talks too much.
 	if !plog.LevelAt(capnslog.INFO) {
 		mantleLogger := capnslog.MustRepoLogger("github.com/coreos/mantle")
@@ -99,6 +134,21 @@ func runRun(cmd *cobra.Command, args []string) {
 		pattern = "*" // run all tests by default
 	}
 
+	// read the failures before the output directory is cleaned, in
+	// case it is being reused
+	if rerunFailed != "" {
+		failed, err := kola.ReadFailedTests(rerunFailed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reading failed tests: %v\n", err)
+			os.Exit(1)
+		}
+		if len(failed) == 0 {
+			fmt.Printf("No failed tests in %v\n", rerunFailed)
+			return
+		}
+		kola.RerunTests = failed
+	}
+
 	var err error
 	outputDir, err = kola.SetupOutputDir(outputDir, kolaPlatform)
 	if err != nil {
@@ -106,7 +156,7 @@ func runRun(cmd *cobra.Command, args []string) {
 		os.Exit(1)
 	}
 
-	runErr := kola.RunTests(pattern, kolaPlatform, outputDir)
+	runErr := kola.RunTests(pattern, selectedPlatforms(), outputDir)
 
 	// needs to be after RunTests() because harness empties the directory
 	if err := writeProps(); err != nil {
@@ -179,8 +229,8 @@ func writeProps() error {
 			MachineType: kola.GCEOptions.MachineType,
 		},
 		Packet: Packet{
-			Facility: kola.PacketOptions.Facility,
-			Plan:     kola.PacketOptions.Plan,
+			Facility:              kola.PacketOptions.Facility,
+			Plan:                  kola.PacketOptions.Plan,
 			InstallerImageBaseURL: kola.PacketOptions.InstallerImageBaseURL,
 			ImageURL:              kola.PacketOptions.ImageURL,
 		},
@@ -16,11 +16,18 @@ package main
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coreos/mantle/auth"
 	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/platform/api/gcloud"
+	"github.com/coreos/mantle/platform/api/packet"
+	"github.com/coreos/mantle/platform/machine/qemu"
 	"github.com/coreos/mantle/sdk"
 )
 
@@ -28,12 +35,17 @@ var (
 	outputDir          string
 	kolaPlatform       string
 	defaultTargetBoard = sdk.DefaultBoard()
-	kolaPlatforms      = []string{"aws", "esx", "gce", "packet", "qemu"}
+	kolaPlatforms      = []string{"aws", "esx", "gce", "kubernetes", "packet", "qemu"}
 	kolaDefaultImages  = map[string]string{
 		"amd64-usr": sdk.BuildRoot() + "/images/amd64-usr/latest/coreos_production_image.bin",
 		"arm64-usr": sdk.BuildRoot() + "/images/arm64-usr/latest/coreos_production_image.bin",
 	}
 
+	qemuSharedDirs     []string
+	qemuCgroupMemoryMB int64
+	trustedCAFiles     []string
+	gceExtraDisks      []string
+
 	kolaDefaultBIOS = map[string]string{
 		"amd64-usr": "bios-256k.bin",
 		"arm64-usr": sdk.BuildRoot() + "/images/arm64-usr/latest/coreos_production_qemu_uefi_efi_code.fd",
@@ -47,24 +59,74 @@ func init() {
 	// general options
 	sv(&outputDir, "output-dir", "", "Temporary output directory for test data and logs")
 	sv(&kola.TorcxManifestFile, "torcx-manifest", "", "Path to a torcx manifest that should be made available to tests")
-	root.PersistentFlags().StringVarP(&kolaPlatform, "platform", "p", "qemu", "VM platform: "+strings.Join(kolaPlatforms, ", "))
-	root.PersistentFlags().IntVarP(&kola.TestParallelism, "parallel", "j", 1, "number of tests to run in parallel")
+	sv(&kola.DockerRuncBinary, "docker-runc", "", "Path to a candidate runc binary for docker to use in the docker.candidate-components test")
+	sv(&kola.DockerContainerdBinary, "docker-containerd", "", "Path to a candidate containerd binary for docker to use in the docker.candidate-components test")
+	root.PersistentFlags().StringVarP(&kolaPlatform, "platform", "p", "qemu", "VM platform: "+strings.Join(kolaPlatforms, ", ")+"; kola run accepts a comma-separated list")
+	root.PersistentFlags().IntVarP(&kola.TestParallelism, "parallel", "j", 1, "number of tests to run in parallel, 1 to run tests serially")
+	root.PersistentFlags().IntVar(&kola.MaxTestWeight, "max-weight", 0, "limit the total resource weight of tests run in parallel, roughly in machines; 0 for no limit")
+	bv(&kola.SmokeOnly, "smoke", false, "run only the smoke set of fast tests which gate merges")
+	bv(&kola.TestShuffle, "shuffle", false, "run tests in a random order to expose ordering dependencies")
+	root.PersistentFlags().Int64Var(&kola.TestShuffleSeed, "shuffle-seed", 0, "seed for --shuffle, to reproduce an order; 0 picks one")
 	sv(&kola.TAPFile, "tapfile", "", "file to write TAP results to")
+	bv(&kola.QuietTests, "quiet-tests", false, "print only failing tests' logs; passing tests' logs are still written to their log files")
+	sv(&kola.TestLogFile, "test-log-file", "test.log", "name of the file in each test's output directory which its log, including SSH commands, is written to; empty for none")
+	root.PersistentFlags().IntVar(&kola.DestroyWorkers, "destroy-workers", 10, "machines of a cluster to destroy at once")
+	root.PersistentFlags().DurationVar(&kola.DestroyTimeout, "destroy-timeout", 10*time.Minute, "abandon machines not destroyed within this time after the end of a test")
+	root.PersistentFlags().IntVar(&kola.MaxConsoleSize, "max-console-size", 4*1024*1024, "bytes of console output to keep per machine, 0 for unlimited")
+	root.PersistentFlags().DurationVar(&kola.ConsolePollInterval, "console-poll-interval", 5*time.Second, "least time between console output requests on rate-limited cloud platforms")
+	root.PersistentFlags().StringSliceVar(&trustedCAFiles, "trusted-ca", nil, "PEM CA certificate file to add to each machine's trust store; may be repeated")
+	bv(&kola.NoCompressUserData, "no-compress-userdata", false, "fail rather than gzip user-data over a platform's size limit")
+	bv(&kola.SSHByDNSName, "ssh-dns-name", false, "SSH to machines by DNS name instead of IP on platforms which assign one")
+	root.PersistentFlags().IntVar(&kola.BootRetries, "boot-retries", 0, "times to replace a cloud machine which fails to come up before failing the test")
+	root.PersistentFlags().IntVar(&kola.SSHRetries, "ssh-retries", 0, "times to rerun an SSH command whose connection dropped before it exited; commands must be idempotent")
+	root.PersistentFlags().IntVar(&kola.MaxSSHSessions, "ssh-max-sessions", 0, "concurrent SSH commands allowed per machine; 0 for the default, negative for no limit")
+	sv(&kola.SSHShell, "ssh-shell", "", "remote shell to run test commands with, e.g. bash (default the login shell)")
+	sv(&kola.ImageCacheDir, "image-cache-dir", filepath.Join(os.TempDir(), "kola-images"), "directory to cache downloaded images in")
 	sv(&kola.Options.BaseName, "basename", "kola", "Cluster name prefix")
+	root.PersistentFlags().DurationVar(&kola.Options.LaunchTimeout, "launch-timeout", 10*time.Minute, "how long to retry cloud instance launches that fail due to throttling or capacity")
 
 	// QEMU-specific options
 	sv(&kola.QEMUOptions.Board, "board", defaultTargetBoard, "target board")
-	sv(&kola.QEMUOptions.DiskImage, "qemu-image", "", "path to CoreOS disk image")
+	sv(&kola.QEMUOptions.DiskImage, "qemu-image", "", "path or http(s)/gs URL of CoreOS disk image")
+	sv(&kola.ImageSignature, "image-signature", "", "detached OpenPGP signature of the QEMU image, as booted, to verify before use")
+	sv(&kola.ImageKeyring, "image-keyring", "", "OpenPGP keyring to verify --image-signature against")
 	sv(&kola.QEMUOptions.BIOSImage, "qemu-bios", "", "BIOS to use for QEMU vm")
+	root.PersistentFlags().StringSliceVar(&qemuSharedDirs, "qemu-shared-dir", nil, "host directory to share with QEMU guests over 9p, as path:tag[:ro]")
+	sv(&kola.QEMUOptions.RTC.Base, "qemu-rtc-base", "", "guest RTC base: utc, localtime, or a start time as 2006-01-02T15:04:05")
+	sv(&kola.QEMUOptions.RTC.Clock, "qemu-rtc-clock", "", "clock driving the guest RTC: host, rt, or vm")
+	sv(&kola.QEMUOptions.NICModel, "qemu-nic-model", "virtio-net", "guest network device model: virtio-net, e1000, or rtl8139")
+	root.PersistentFlags().StringSliceVar(&kola.QEMUOptions.CPUFlags, "qemu-cpu-flags", nil, "CPU features to toggle in QEMU guests, e.g. +aes,-avx512f")
+	bv(&kola.QEMUOptions.Hugepages, "qemu-hugepages", false, "back guest memory with huge pages; the host must have enough reserved")
+	sv(&kola.QEMUOptions.HugepagesPath, "qemu-hugepages-path", "/dev/hugepages", "hugetlbfs mount point used by --qemu-hugepages")
+	root.PersistentFlags().DurationVar(&kola.QEMUOptions.DHCP.LeaseTime, "qemu-dhcp-lease-time", 0, "DHCP lease time of QEMU guests, at least 2m (default dnsmasq's 1h)")
+	root.PersistentFlags().Uint8Var(&kola.QEMUOptions.DHCP.FirstHost, "qemu-dhcp-first-host", 2, "last octet of the first address given to QEMU guests on each network")
+	sv(&kola.QEMUOptions.Cgroup.Parent, "qemu-cgroup-parent", "", "host cgroup v2 under which to create a cgroup limiting each cluster's QEMU processes, e.g. /sys/fs/cgroup/kola")
+	root.PersistentFlags().Int64Var(&qemuCgroupMemoryMB, "qemu-cgroup-memory", 0, "memory limit in MiB of each cluster's QEMU processes with --qemu-cgroup-parent; 0 for no limit")
+	root.PersistentFlags().Float64Var(&kola.QEMUOptions.Cgroup.CPULimit, "qemu-cgroup-cpus", 0, "CPU limit of each cluster's QEMU processes with --qemu-cgroup-parent; 0 for no limit")
+	sv(&kola.QEMUOptions.Watchdog, "qemu-watchdog", "", "attach a watchdog to QEMU guests with this action when it fires: reset, poweroff, shutdown, pause, debug, none, or inject-nmi")
+	sv(&kola.QEMUOptions.DiskCache, "qemu-disk-cache", "", "host cache mode of QEMU guest disks: none, writeback, or writethrough (default QEMU's writeback)")
+	sv(&kola.QEMUOptions.DiskAIO, "qemu-disk-aio", "", "asynchronous I/O backend of QEMU guest disks: threads, native, or io_uring (default QEMU's threads); native requires --qemu-disk-cache=none")
+	bv(&kola.QEMUOptions.Balloon, "qemu-balloon", false, "attach a memory balloon to QEMU guests so tests can resize their memory")
+	bv(&kola.QEMUOptions.OmitDefaults, "qemu-nodefaults", false, "create none of QEMU's default devices in guests, only those kola configures")
+	root.PersistentFlags().Var((*stringArray)(&kola.QEMUOptions.OmitDevices), "qemu-omit-device", "device kola attaches to QEMU guests to leave out: rng, balloon, or watchdog; may be repeated")
+	root.PersistentFlags().Var((*stringArray)(&kola.QEMUOptions.ExtraQEMUArgs), "qemu-args", "extra argument for QEMU guests, kept whole; may be repeated, e.g. --qemu-args=-device --qemu-args=virtio-serial")
+	bv(&kola.QEMUOptions.VNC, "qemu-vnc", false, "serve each guest's display over VNC on a unix socket in its output directory")
+	bv(&kola.QEMUOptions.ConsoleSocket, "qemu-console-socket", false, "serve each guest's serial console on a unix socket for interactive debugging")
+	bv(&kola.QEMUOptions.CapturePackets, "qemu-capture-packets", false, "record each test's cluster network traffic to a pcap file")
 
 	// gce-specific options
-	sv(&kola.GCEOptions.Image, "gce-image", "projects/coreos-cloud/global/images/family/coreos-alpha", "GCE image, full api endpoints names are accepted if resource is in a different project")
+	sv(&kola.GCEOptions.Image, "gce-image", "projects/coreos-cloud/global/images/family/coreos-alpha", "GCE image, full api endpoints names are accepted if resource is in a different project; a gs:// image tarball will be imported")
 	sv(&kola.GCEOptions.Project, "gce-project", "coreos-gce-testing", "GCE project name")
 	sv(&kola.GCEOptions.Zone, "gce-zone", "us-central1-a", "GCE zone name")
 	sv(&kola.GCEOptions.MachineType, "gce-machinetype", "n1-standard-1", "GCE machine type")
 	sv(&kola.GCEOptions.DiskType, "gce-disktype", "pd-ssd", "GCE disk type")
 	sv(&kola.GCEOptions.Network, "gce-network", "default", "GCE network")
 	bv(&kola.GCEOptions.ServiceAuth, "gce-service-auth", false, "for non-interactive auth when running within GCE")
+	root.PersistentFlags().IntVar(&kola.GCEOptions.LocalSSDs, "gce-local-ssds", 0, "number of local SSDs to attach to each GCE instance")
+	root.PersistentFlags().StringSliceVar(&gceExtraDisks, "gce-extra-disk", nil, "additional persistent disk for each GCE instance, as size-in-GB[:disk-type]")
+	sv(&kola.GCEOptions.DiskKMSKey, "gce-disk-kms-key", "", "Cloud KMS key resource name to encrypt GCE instance disks with")
+	sv(&kola.GCEOptions.DiskKMSKey, "gce-disk-encryption-key", "", "Cloud KMS key resource name to encrypt GCE instance disks with")
+	root.PersistentFlags().MarkDeprecated("gce-disk-encryption-key", "use --gce-disk-kms-key")
 	sv(&kola.GCEOptions.JSONKeyFile, "gce-json-key", "", "use a service account's JSON key for authentication")
 
 	// aws-specific options
@@ -74,9 +136,10 @@ func init() {
 	}
 	// Container Linux 1430.0.0 (alpha) on us-west-2
 	sv(&kola.AWSOptions.Region, "aws-region", defaultRegion, "AWS region")
-	sv(&kola.AWSOptions.AMI, "aws-ami", "alpha", `AWS AMI ID, or (alpha|beta|stable) to use the latest image`)
+	sv(&kola.AWSOptions.AMI, "aws-ami", "alpha", `AWS AMI ID, (alpha|beta|stable) to use the latest image, or an s3:// raw image to import`)
 	sv(&kola.AWSOptions.InstanceType, "aws-type", "t2.small", "AWS instance type")
 	sv(&kola.AWSOptions.SecurityGroup, "aws-sg", "kola", "AWS security group name")
+	sv(&kola.AWSOptions.RootVolumeKMSKey, "aws-root-kms-key", "", "KMS key ID, ARN, or alias to encrypt AWS instance root volumes with")
 
 	// packet-specific options
 	sv(&kola.PacketOptions.ConfigPath, "packet-config-file", "", "Packet config file (default \"~/"+auth.PacketConfigPath+"\")")
@@ -87,12 +150,26 @@ func init() {
 	sv(&kola.PacketOptions.Plan, "packet-plan", "", "Packet plan slug (default board-dependent, e.g. \"baremetal_0\")")
 	sv(&kola.PacketOptions.InstallerImageBaseURL, "packet-installer-image-base-url", "", "Packet installer image base URL, non-https (default board-dependent, e.g. \"http://stable.release.core-os.net/amd64-usr/current\")")
 	sv(&kola.PacketOptions.ImageURL, "packet-image-url", "", "Packet image URL (default board-dependent, e.g. \"https://alpha.release.core-os.net/amd64-usr/current/coreos_production_packet_image.bin.bz2\")")
+	root.PersistentFlags().StringSliceVar(&kola.PacketOptions.ConsoleBanners, "packet-console-banner", packet.DefaultConsoleBanners, "Packet console banner marking the start of the OS boot; repeat for banners which must appear in order")
+	root.PersistentFlags().DurationVar(&kola.PacketOptions.ConsoleBannerTimeout, "packet-console-banner-timeout", 30*time.Second, "how long to wait for the boot banners in Packet console output before deleting a device")
 	sv(&kola.PacketOptions.StorageURL, "packet-storage-url", "gs://users.developer.core-os.net/"+os.Getenv("USER")+"/mantle", "Google Storage base URL for temporary uploads")
 
 	// esx-specific options
 	sv(&kola.ESXOptions.Server, "esx-server", "", "ESX server")
 	sv(&kola.ESXOptions.Profile, "esx-profile", "", "ESX profile (default \"default\")")
 	sv(&kola.ESXOptions.BaseVMName, "esx-base-vm", "", "ESX base VM name")
+
+	// kubernetes-specific options
+	sv(&kola.KubernetesOptions.Kubeconfig, "kube-config", "", "kubeconfig file (default kubectl's)")
+	sv(&kola.KubernetesOptions.Context, "kube-context", "", "kubeconfig context (default the current context)")
+	sv(&kola.KubernetesOptions.Namespace, "kube-namespace", "", "namespace to create machines in (default the context's)")
+	sv(&kola.KubernetesOptions.ContainerDisk, "kube-container-disk", "", "KubeVirt containerDisk image with a Container Linux disk")
+	sv(&kola.KubernetesOptions.Memory, "kube-memory", "2Gi", "memory of each KubeVirt machine")
+}
+
+// selectedPlatforms returns the platforms named by the --platform flag.
+func selectedPlatforms() []string {
+	return strings.Split(kolaPlatform, ",")
 }
 
 // Sync up the command line options if there is dependency
@@ -100,15 +177,17 @@ func syncOptions() error {
 	kola.PacketOptions.Board = kola.QEMUOptions.Board
 	kola.PacketOptions.GSOptions = &kola.GCEOptions
 
-	ok := false
-	for _, platform := range kolaPlatforms {
-		if platform == kolaPlatform {
-			ok = true
-			break
+	for _, pltfrm := range selectedPlatforms() {
+		ok := false
+		for _, platform := range kolaPlatforms {
+			if platform == pltfrm {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unsupport platform %q", pltfrm)
 		}
-	}
-	if !ok {
-		return fmt.Errorf("unsupport platform %q", kolaPlatform)
 	}
 
 	image, ok := kolaDefaultImages[kola.QEMUOptions.Board]
@@ -124,5 +203,57 @@ func syncOptions() error {
 		kola.QEMUOptions.BIOSImage = kolaDefaultBIOS[kola.QEMUOptions.Board]
 	}
 
+	for _, dir := range qemuSharedDirs {
+		parts := strings.Split(dir, ":")
+		if len(parts) < 2 || len(parts) > 3 || (len(parts) == 3 && parts[2] != "ro") {
+			return fmt.Errorf("invalid shared directory %q, expected path:tag[:ro]", dir)
+		}
+		kola.QEMUOptions.SharedDirs = append(kola.QEMUOptions.SharedDirs, qemu.SharedDir{
+			HostPath: parts[0],
+			MountTag: parts[1],
+			ReadOnly: len(parts) == 3,
+		})
+	}
+
+	kola.QEMUOptions.Cgroup.MemoryLimit = qemuCgroupMemoryMB << 20
+
+	for _, disk := range gceExtraDisks {
+		parts := strings.Split(disk, ":")
+		size, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil || size <= 0 || len(parts) > 2 {
+			return fmt.Errorf("invalid GCE disk %q, expected size-in-GB[:disk-type]", disk)
+		}
+		d := gcloud.Disk{SizeGB: size}
+		if len(parts) == 2 {
+			d.Type = parts[1]
+		}
+		kola.GCEOptions.AdditionalDisks = append(kola.GCEOptions.AdditionalDisks, d)
+	}
+
+	for _, path := range trustedCAFiles {
+		ca, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("reading trusted CA: %v", err)
+		}
+		kola.TrustedCAs = append(kola.TrustedCAs, string(ca))
+	}
+
 	return nil
 }
+
+// stringArray is a repeatable flag which keeps each value whole, unlike
+// a StringSlice flag, which splits values on commas.
+type stringArray []string
+
+func (a *stringArray) String() string {
+	return fmt.Sprintf("%q", []string(*a))
+}
+
+func (a *stringArray) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+func (a *stringArray) Type() string {
+	return "stringArray"
+}
@@ -19,6 +19,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/spf13/cobra"
 
@@ -39,6 +41,7 @@ var (
 	spawnNodeCount      int
 	spawnUserData       string
 	spawnShell          bool
+	spawnIdle           bool
 	spawnRemove         bool
 	spawnVerbose        bool
 	spawnMachineOptions string
@@ -48,6 +51,7 @@ func init() {
 	cmdSpawn.Flags().IntVarP(&spawnNodeCount, "nodecount", "c", 1, "number of nodes to spawn")
 	cmdSpawn.Flags().StringVarP(&spawnUserData, "userdata", "u", "", "userdata to pass to the instances")
 	cmdSpawn.Flags().BoolVarP(&spawnShell, "shell", "s", true, "spawn a shell in an instance before exiting")
+	cmdSpawn.Flags().BoolVar(&spawnIdle, "idle", false, "print SSH details and keep the instances until interrupted instead of spawning a shell")
 	cmdSpawn.Flags().BoolVarP(&spawnRemove, "remove", "r", true, "remove instances after shell exits")
 	cmdSpawn.Flags().BoolVarP(&spawnVerbose, "verbose", "v", false, "output information about spawned instances")
 	cmdSpawn.Flags().StringVar(&spawnMachineOptions, "qemu-options", "", "experimental: path to QEMU machine options json")
@@ -93,7 +97,7 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 		defer cluster.Destroy()
 	}
 
-	var someMach platform.Machine
+	var machs []platform.Machine
 	for i := 0; i < spawnNodeCount; i++ {
 		var mach platform.Machine
 		var err error
@@ -122,13 +126,52 @@ func doSpawn(cmd *cobra.Command, args []string) error {
 			fmt.Printf("Machine spawned at %v\n", mach.IP())
 		}
 
-		someMach = mach
+		machs = append(machs, mach)
+	}
+
+	if spawnIdle {
+		printSSHDetails(cluster, machs)
+
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		<-sigs
+		return nil
 	}
 
 	if spawnShell {
-		if err := platform.Manhole(someMach); err != nil {
+		if err := platform.Manhole(machs[len(machs)-1]); err != nil {
 			return fmt.Errorf("Manhole failed: %v", err)
 		}
 	}
 	return nil
 }
+
+// printSSHDetails tells the user how to reach the spawned machines.
+func printSSHDetails(cluster platform.Cluster, machs []platform.Machine) {
+	if a, ok := cluster.(interface {
+		SSHAgentSocket() string
+	}); ok {
+		fmt.Printf("SSH agent: SSH_AUTH_SOCK=%s\n", a.SSHAgentSocket())
+	}
+	if kolaPlatform == "qemu" {
+		fmt.Printf("QEMU machines are only reachable from the cluster's network namespace\n")
+	}
+	for i, m := range machs {
+		fmt.Printf("%s: ssh core@%s\n", m.ID(), m.IP())
+		if c, ok := m.(interface {
+			ConsoleSocket() string
+		}); ok && c.ConsoleSocket() != "" {
+			fmt.Printf("%s: console: socat -,raw,echo=0 UNIX-CONNECT:%s\n", m.ID(), c.ConsoleSocket())
+		}
+		if v, ok := m.(interface {
+			VNCSocket() string
+		}); ok && v.VNCSocket() != "" {
+			port := 5900 + i
+			fmt.Printf("%s: display: socat TCP-LISTEN:%d,fork UNIX-CONNECT:%s, then connect a VNC viewer to port %d\n", m.ID(), port, v.VNCSocket(), port)
+		}
+		if url := platform.ConsoleURL(m); url != "" {
+			fmt.Printf("%s: console: %s\n", m.ID(), url)
+		}
+	}
+	fmt.Printf("Interrupt to destroy the machines and exit\n")
+}
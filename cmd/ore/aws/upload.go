@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	"github.com/coreos/mantle/platform/api/aws"
+	"github.com/coreos/mantle/platform/local"
 	"github.com/coreos/mantle/sdk"
 	"github.com/spf13/cobra"
 )
@@ -49,6 +50,8 @@ After a successful run, the final line of output will be a line of JSON describi
 	uploadImageName      string
 	uploadBoard          string
 	uploadFile           string
+	uploadFileSignature  string
+	uploadKeyring        string
 	uploadDeleteObject   bool
 	uploadForce          bool
 	uploadSourceSnapshot string
@@ -68,6 +71,8 @@ func init() {
 	cmdUpload.Flags().StringVar(&uploadFile, "file",
 		defaultUploadFile(),
 		"path to CoreOS image (build with: ./image_to_vm.sh --format=ami_vmdk ...)")
+	cmdUpload.Flags().StringVar(&uploadFileSignature, "file-signature", "", "detached OpenPGP signature of the image file to verify before uploading it")
+	cmdUpload.Flags().StringVar(&uploadKeyring, "keyring", "", "OpenPGP keyring to verify --file-signature against")
 	cmdUpload.Flags().BoolVar(&uploadDeleteObject, "delete-object", true, "delete uploaded S3 object after snapshot is created")
 	cmdUpload.Flags().BoolVar(&uploadForce, "force", false, "overwrite existing S3 object without prompt")
 	cmdUpload.Flags().StringVar(&uploadSourceSnapshot, "source-snapshot", "", "the snapshot ID to base this AMI on (default: create new snapshot)")
@@ -130,6 +135,10 @@ func runUpload(cmd *cobra.Command, args []string) error {
 		fmt.Fprintf(os.Stderr, "At most one of --source-object and --source-snapshot may be specified.\n")
 		os.Exit(2)
 	}
+	if uploadFileSignature != "" && uploadKeyring == "" {
+		fmt.Fprintf(os.Stderr, "--file-signature requires --keyring.\n")
+		os.Exit(2)
+	}
 
 	// if an image name is unspecified try to use version.txt
 	imageName := uploadImageName
@@ -189,12 +198,22 @@ func runUpload(cmd *cobra.Command, args []string) error {
 	// if there's no existing snapshot and no provided S3 object to
 	// make one from, upload to S3
 	if uploadSourceObject == "" && sourceSnapshot == "" {
-		f, err := os.Open(uploadFile)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Could not open image file %v: %v\n", uploadFile, err)
-			os.Exit(1)
+		var f *os.File
+		if uploadFileSignature != "" {
+			// upload the verified file, not whatever is at the path now
+			f, err = local.VerifyImage(uploadFile, uploadFileSignature, uploadKeyring)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Image verification failed: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			f, err = os.Open(uploadFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Could not open image file %v: %v\n", uploadFile, err)
+				os.Exit(1)
+			}
+			defer f.Close()
 		}
-		defer f.Close()
 
 		err = API.UploadObject(f, s3BucketName, s3ObjectPath, uploadForce)
 		if err != nil {
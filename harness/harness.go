@@ -47,6 +47,8 @@ type H struct {
 	w        io.Writer    // For flushToParent.
 	tap      io.Writer    // Optional TAP log of test results.
 	logger   *log.Logger
+	logFile  *os.File    // Optional per-test copy of the log, see Options.LogFile.
+	fileLog  *log.Logger // Writes to logFile.
 	ctx      context.Context
 	cancel   context.CancelFunc
 	ran      bool // Test (or one of its subtests) was executed.
@@ -66,6 +68,9 @@ type H struct {
 	signal   chan bool // To signal a test is done.
 	sub      []*H      // Queue of subtests to be run in parallel.
 
+	artifacts []string            // Paths of files saved by AddArtifact.
+	helpers   map[string]struct{} // Functions marked by Helper, skipped when logging.
+
 	isParallel bool
 }
 
@@ -100,6 +105,16 @@ func (c *H) flushToParent(format string, args ...interface{}) {
 		} else {
 			fmt.Fprintf(p.tap, "ok - %s\n", name)
 		}
+
+		c.mu.RLock()
+		if len(c.artifacts) > 0 {
+			fmt.Fprintf(p.tap, "  ---\n  artifacts:\n")
+			for _, path := range c.artifacts {
+				fmt.Fprintf(p.tap, "    - %s\n", path)
+			}
+			fmt.Fprintf(p.tap, "  ...\n")
+		}
+		c.mu.RUnlock()
 	}
 
 	c.mu.Lock()
@@ -211,11 +226,68 @@ func (c *H) FailNow() {
 	runtime.Goexit()
 }
 
-// log generates the output. It's always at the same stack depth.
+// log generates the output. It's always at the same stack depth, but the
+// reported file and line skip past any functions marked by Helper.
 func (c *H) log(s string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
-	c.logger.Output(3, s)
+	depth := c.logDepth()
+	c.logger.Output(depth, s)
+	if c.fileLog != nil {
+		c.fileLog.Output(depth, s)
+	}
+}
+
+// trace writes to the log file only, from the same stack depth as log.
+func (c *H) trace(s string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.fileLog != nil {
+		c.fileLog.Output(c.logDepth(), s)
+	}
+}
+
+// logDepth returns the call depth, relative to log, of the frame to
+// attribute a log line to. It must be called directly by log with c.mu
+// held.
+func (c *H) logDepth() int {
+	// log's caller's caller: the function calling Errorf and friends.
+	const depth = 3
+	if len(c.helpers) == 0 {
+		return depth
+	}
+
+	pc := make([]uintptr, 50)
+	// skip runtime.Callers, logDepth, and log
+	n := runtime.Callers(3, pc)
+	frames := runtime.CallersFrames(pc[:n])
+	// the first frame is the reporting method itself
+	frames.Next()
+	d := depth
+	for {
+		frame, more := frames.Next()
+		if _, ok := c.helpers[frame.Function]; !ok || !more {
+			return d
+		}
+		d++
+	}
+}
+
+// Helper marks the calling function as a test helper function. When
+// logging file and line information, that function will be skipped.
+// Helper may be called simultaneously from multiple goroutines.
+func (c *H) Helper() {
+	var pc [1]uintptr
+	// skip runtime.Callers and Helper
+	runtime.Callers(2, pc[:])
+	frame, _ := runtime.CallersFrames(pc[:]).Next()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.helpers == nil {
+		c.helpers = make(map[string]struct{})
+	}
+	c.helpers[frame.Function] = struct{}{}
 }
 
 // Log formats its arguments using default formatting, analogous to Println,
@@ -228,6 +300,11 @@ func (c *H) Log(args ...interface{}) { c.log(fmt.Sprintln(args...)) }
 // The text will be printed only if the test fails or the -harness.v flag is set.
 func (c *H) Logf(format string, args ...interface{}) { c.log(fmt.Sprintf(format, args...)) }
 
+// Tracef formats its arguments like Logf, but records the text only in
+// the test's log file, for detail too noisy for the test's output such as
+// every command it runs. It does nothing unless Options.LogFile is set.
+func (c *H) Tracef(format string, args ...interface{}) { c.trace(fmt.Sprintf(format, args...)) }
+
 // Error is equivalent to Log followed by Fail.
 func (c *H) Error(args ...interface{}) {
 	c.log(fmt.Sprintln(args...))
@@ -342,6 +419,37 @@ func (h *H) TempFile(prefix string) *os.File {
 	return tmp
 }
 
+// AddArtifact saves content to the file name under OutputDir and records
+// it as evidence for the test's result. Artifacts are noted in the test
+// log and listed with the test's result in the TAP output. A failure to
+// save one fails the test without stopping it, since artifacts are often
+// collected while cleaning up.
+func (h *H) AddArtifact(name string, content []byte) {
+	if name != filepath.Base(name) {
+		h.log(fmt.Sprintf("Invalid artifact name %q", name))
+		h.Fail()
+		return
+	}
+	dir, err := h.mkOutputDir()
+	if err != nil {
+		h.log(err.Error())
+		h.Fail()
+		return
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, content, 0666); err != nil {
+		h.log(fmt.Sprintf("Failed to write artifact: %v", err))
+		h.Fail()
+		return
+	}
+
+	h.mu.Lock()
+	h.artifacts = append(h.artifacts, path)
+	h.mu.Unlock()
+
+	h.log(fmt.Sprintf("Saved artifact %s", path))
+}
+
 // Parallel signals that this test is to be run in parallel with (and only with)
 // other parallel tests.
 func (t *H) Parallel() {
@@ -382,6 +490,7 @@ func tRunner(t *H, fn func(t *H)) {
 		if err != nil {
 			t.Fail()
 			t.report()
+			t.closeLogFile()
 			panic(err)
 		}
 
@@ -405,6 +514,7 @@ func tRunner(t *H, fn func(t *H)) {
 			t.suite.release()
 		}
 		t.report() // Report after all subtests have finished.
+		t.closeLogFile()
 
 		// Do not lock t.done to allow race detector to detect race in case
 		// the user does not appropriately synchronizes a goroutine.
@@ -440,6 +550,9 @@ func (t *H) Run(name string, f func(t *H)) bool {
 	// Indent logs 8 spaces to distinguish them from sub-test headers.
 	const indent = "        "
 	t.logger = log.New(&t.output, indent, log.Lshortfile)
+	if t.suite.opts.LogFile != "" {
+		t.openLogFile()
+	}
 
 	if t.suite.opts.Verbose {
 		// Print directly to root's io.Writer so there is no delay.
@@ -458,6 +571,38 @@ func (t *H) Run(name string, f func(t *H)) bool {
 	return !t.failed
 }
 
+// closeLogFile ends t's log file with its result.
+func (t *H) closeLogFile() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.logFile == nil {
+		return
+	}
+	result := "PASS"
+	if t.failed {
+		result = "FAIL"
+	} else if t.skipped {
+		result = "SKIP"
+	}
+	fmt.Fprintf(t.logFile, "--- %s: %s (%s)\n", result, t.name, fmtDuration(t.duration))
+	t.logFile.Close()
+	t.logFile, t.fileLog = nil, nil
+}
+
+// openLogFile starts copying t's log to Options.LogFile in its output
+// directory. Failing that, the test's output still has the log.
+func (t *H) openLogFile() {
+	dir, err := t.mkOutputDir()
+	if err == nil {
+		t.logFile, err = os.Create(filepath.Join(dir, t.suite.opts.LogFile))
+	}
+	if err != nil {
+		t.logger.Output(1, fmt.Sprintf("Failed to create log file: %v", err))
+		return
+	}
+	t.fileLog = log.New(t.logFile, "", log.Ltime|log.Lmicroseconds|log.Lshortfile)
+}
+
 func (t *H) report() {
 	if t.parent == nil {
 		return
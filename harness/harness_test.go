@@ -487,3 +487,134 @@ func TestTempFile(t *testing.T) {
 		t.Errorf("%q missing %q prefix", second, "second")
 	}
 }
+
+func TestAddArtifact(t *testing.T) {
+	var suitedir string
+	if dir, err := ioutil.TempDir("", ""); err != nil {
+		t.Fatal(err)
+	} else {
+		defer os.RemoveAll(dir)
+		suitedir = filepath.Join(dir, "_test_temp")
+	}
+
+	opts := Options{
+		OutputDir: suitedir,
+		Verbose:   true,
+	}
+	suite := NewSuite(opts, Tests{
+		"Artifact": func(h *H) {
+			h.AddArtifact("evidence.txt", []byte("hello"))
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	tap := &bytes.Buffer{}
+	if err := suite.runTests(buf, tap); err != nil {
+		t.Log("\n" + buf.String())
+		t.Error(err)
+	}
+
+	path := filepath.Join(suitedir, "Artifact", "evidence.txt")
+	if data, err := ioutil.ReadFile(path); err != nil {
+		t.Error(err)
+	} else if string(data) != "hello" {
+		t.Errorf("artifact contents %q != %q", data, "hello")
+	}
+
+	if !strings.Contains(tap.String(), "    - "+path+"\n") {
+		t.Errorf("artifact missing from TAP output:\n%s", tap.String())
+	}
+}
+
+func TestHelper(t *testing.T) {
+	helper := func(h *H) {
+		h.Helper()
+		h.Errorf("helper failed")
+	}
+
+	var line int
+	suite := NewSuite(Options{}, Tests{
+		"Helper": func(h *H) {
+			_, _, line, _ = runtime.Caller(0)
+			helper(h)
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+
+	want := fmt.Sprintf("harness_test.go:%d: helper failed", line+1)
+	if !strings.Contains(buf.String(), want) {
+		t.Errorf("output missing %q:\n%s", want, buf.String())
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	var suitedir string
+	if dir, err := ioutil.TempDir("", ""); err != nil {
+		t.Fatal(err)
+	} else {
+		defer os.RemoveAll(dir)
+		suitedir = filepath.Join(dir, "_test_temp")
+	}
+
+	opts := Options{
+		OutputDir: suitedir,
+		LogFile:   "test.log",
+	}
+	suite := NewSuite(opts, Tests{
+		"Logged": func(h *H) {
+			h.Log("to both")
+			h.Tracef("to the file")
+			h.Run("Sub", func(h *H) {
+				h.Error("subtest failed")
+			})
+		},
+	})
+
+	buf := &bytes.Buffer{}
+	if err := suite.runTests(buf, nil); err != SuiteFailed {
+		t.Errorf("got %v; want %v", err, SuiteFailed)
+	}
+
+	if !strings.Contains(buf.String(), "to both") {
+		t.Errorf("output missing logged line:\n%s", buf.String())
+	}
+	if strings.Contains(buf.String(), "to the file") {
+		t.Errorf("output includes traced line:\n%s", buf.String())
+	}
+
+	for _, tc := range []struct {
+		path string
+		want []string
+		skip []string
+	}{
+		{
+			path: filepath.Join(suitedir, "Logged", "test.log"),
+			want: []string{"to both", "to the file", "--- FAIL: Logged"},
+			skip: []string{"subtest failed"},
+		},
+		{
+			path: filepath.Join(suitedir, "Logged", "Sub", "test.log"),
+			want: []string{"subtest failed", "--- FAIL: Logged/Sub"},
+		},
+	} {
+		data, err := ioutil.ReadFile(tc.path)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(string(data), want) {
+				t.Errorf("%s missing %q:\n%s", tc.path, want, data)
+			}
+		}
+		for _, skip := range tc.skip {
+			if strings.Contains(string(data), skip) {
+				t.Errorf("%s includes %q:\n%s", tc.path, skip, data)
+			}
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -70,6 +71,16 @@ type Options struct {
 
 	// Limit number of tests to run in parallel (0 means GOMAXPROCS).
 	Parallel int
+
+	// Run tests in a random order, seeded by ShuffleSeed (0 means
+	// pick one). The seed is printed so an order can be reproduced.
+	Shuffle     bool
+	ShuffleSeed int64
+
+	// If set, each test's log is also written, as it is logged, to a
+	// file of this name in the test's output directory, along with
+	// lines recorded by Tracef. Subtests log to their own files.
+	LogFile string
 }
 
 // FlagSet can be used to setup options via command line flags.
@@ -101,6 +112,12 @@ func (o *Options) FlagSet(prefix string, errorHandling flag.ErrorHandling) *flag
 		"fail test binary execution after duration `d` (0 means unlimited)")
 	f.IntVar(&o.Parallel, prefix+"parallel", o.Parallel,
 		"run at most `n` tests in parallel")
+	f.BoolVar(&o.Shuffle, prefix+"shuffle", o.Shuffle,
+		"run tests in a random order")
+	f.Int64Var(&o.ShuffleSeed, prefix+"shuffleseed", o.ShuffleSeed,
+		"shuffle tests using `seed` (0 means pick one)")
+	f.StringVar(&o.LogFile, prefix+"logfile", o.LogFile,
+		"also write each test's log to `name` in its output directory")
 	return f
 }
 
@@ -118,6 +135,9 @@ func (o *Options) init() {
 	if o.Parallel < 1 {
 		o.Parallel = runtime.GOMAXPROCS(0)
 	}
+	if o.Shuffle && o.ShuffleSeed == 0 {
+		o.ShuffleSeed = time.Now().UnixNano()
+	}
 }
 
 // Suite is a type passed to a TestMain function to run the actual tests.
@@ -267,9 +287,12 @@ func (s *Suite) runTests(out, tap io.Writer) error {
 		tap:     tap,
 		suite:   s,
 	}
+	if s.opts.Shuffle {
+		fmt.Fprintf(out, "harness: shuffling tests with seed %d\n", s.opts.ShuffleSeed)
+	}
 	tRunner(t, func(t *H) {
-		for name, test := range s.tests {
-			t.Run(name, test)
+		for _, name := range s.testOrder() {
+			t.Run(name, s.tests[name])
 		}
 		// Run catching the signal rather than the tRunner as a separate
 		// goroutine to avoid adding a goroutine during the sequential
@@ -285,6 +308,20 @@ func (s *Suite) runTests(out, tap io.Writer) error {
 	return nil
 }
 
+// testOrder returns the names of the tests in the order they should start:
+// sorted, or shuffled by Options.ShuffleSeed if Options.Shuffle is set.
+func (s *Suite) testOrder() []string {
+	names := s.tests.List()
+	if s.opts.Shuffle {
+		r := rand.New(rand.NewSource(s.opts.ShuffleSeed))
+		for i := len(names) - 1; i > 0; i-- {
+			j := r.Intn(i + 1)
+			names[i], names[j] = names[j], names[i]
+		}
+	}
+	return names
+}
+
 // outputPath returns the file name under Options.OutputDir.
 func (s *Suite) outputPath(path string) string {
 	return filepath.Join(s.opts.OutputDir, path)
@@ -16,6 +16,8 @@
 package harness
 
 import (
+	"reflect"
+	"sort"
 	"testing"
 )
 
@@ -111,3 +113,30 @@ func TestSuiteParallelism(t *testing.T) {
 		}
 	}
 }
+
+func TestSuiteShuffle(t *testing.T) {
+	var tests Tests
+	for _, name := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		tests.Add(name, func(h *H) {})
+	}
+
+	sorted := NewSuite(Options{}, tests).testOrder()
+	if !reflect.DeepEqual(sorted, tests.List()) {
+		t.Errorf("unshuffled order %v is not sorted", sorted)
+	}
+
+	order := NewSuite(Options{Shuffle: true, ShuffleSeed: 1}, tests).testOrder()
+	again := NewSuite(Options{Shuffle: true, ShuffleSeed: 1}, tests).testOrder()
+	if !reflect.DeepEqual(order, again) {
+		t.Errorf("same seed gave different orders: %v and %v", order, again)
+	}
+	if reflect.DeepEqual(order, sorted) {
+		t.Errorf("shuffled order %v is sorted", order)
+	}
+
+	shuffled := append([]string(nil), order...)
+	sort.Strings(shuffled)
+	if !reflect.DeepEqual(shuffled, sorted) {
+		t.Errorf("shuffled order %v is not a permutation of %v", order, sorted)
+	}
+}
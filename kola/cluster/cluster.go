@@ -17,26 +17,44 @@ package cluster
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/pkg/multierror"
+	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/lang/worker"
 	"github.com/coreos/mantle/platform"
 )
 
+// forEachMachineWorkers bounds how many machines ForEachMachine works on
+// at once.
+const forEachMachineWorkers = 10
+
 // TestCluster embedds a Cluster to provide platform independant helper
 // methods.
 type TestCluster struct {
 	*harness.H
 	platform.Cluster
 	NativeFuncs []string
+
+	// SSHPrefix, if set, runs every command run with SSH or MustSSH
+	// under it, e.g. "sudo", with the whole command passed to the
+	// cluster's SSH shell ("sh" by default) so the prefix applies to
+	// every part of a pipeline. It is inherited by subtests. Use
+	// SSHWithoutPrefix to bypass it for a single command.
+	SSHPrefix string
 }
 
 // Run runs f as a subtest and reports whether f succeeded.
 func (t *TestCluster) Run(name string, f func(c TestCluster)) bool {
 	return t.H.Run(name, func(h *harness.H) {
-		f(TestCluster{H: h, Cluster: t.Cluster})
+		f(TestCluster{H: h, Cluster: t.Cluster, SSHPrefix: t.SSHPrefix})
 	})
 }
 
@@ -95,15 +113,398 @@ func (t *TestCluster) DropFile(localPath string) error {
 // SSH runs a ssh command on the given machine in the cluster. It differs from
 // Machine.SSH in that stderr is written to the test's output as a 'Log' line.
 // This ensures the output will be correctly accumulated under the correct
-// test.
+// test. The command is prefixed with SSHPrefix, if set.
 func (t *TestCluster) SSH(m platform.Machine, cmd string) ([]byte, error) {
+	return t.SSHWithoutPrefix(m, t.prefixed(cmd))
+}
+
+// prefixed returns cmd to be run under SSHPrefix, if set, by the
+// cluster's RuntimeConfig.SSHShell, or sh by default.
+func (t *TestCluster) prefixed(cmd string) string {
+	if t.SSHPrefix == "" {
+		return cmd
+	}
+	shell := "sh"
+	if rc, ok := t.Cluster.(interface {
+		RuntimeConf() platform.RuntimeConfig
+	}); ok && rc.RuntimeConf().SSHShell != "" {
+		shell = rc.RuntimeConf().SSHShell
+	}
+	return t.SSHPrefix + " " + shell + " -c " + platform.ShellQuote(cmd)
+}
+
+// SSHWithoutPrefix runs a ssh command like SSH, but ignores SSHPrefix.
+func (t *TestCluster) SSHWithoutPrefix(m platform.Machine, cmd string) ([]byte, error) {
 	stdout, stderr, err := m.SSH(cmd)
+	t.traceSSH(m, cmd, err)
+	t.logStderr(stderr)
+	return stdout, err
+}
+
+// RunWithInput runs a ssh command like SSH, with stdin connected to the
+// command's standard input, so tests can pass it data without quoting it
+// into the command.
+func (t *TestCluster) RunWithInput(m platform.Machine, cmd string, stdin io.Reader) ([]byte, error) {
+	cmd = t.prefixed(cmd)
+	stdout, stderr, err := m.SSHWithInput(cmd, stdin)
+	t.traceSSH(m, cmd, err)
+	t.logStderr(stderr)
+	return stdout, err
+}
 
+// traceSSH records a command run on m in the test's log file.
+func (t *TestCluster) traceSSH(m platform.Machine, cmd string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Tracef("ssh %s %q: %v", platform.MachineName(m), cmd, err)
+	} else {
+		t.Tracef("ssh %s %q", platform.MachineName(m), cmd)
+	}
+}
+
+// logStderr writes a command's stderr to the test's output.
+func (t *TestCluster) logStderr(stderr []byte) {
 	if len(stderr) > 0 {
 		for _, line := range strings.Split(string(stderr), "\n") {
 			t.Log(line)
 		}
 	}
+}
 
+// RunScript copies the local script at localPath to m, runs it with args
+// and removes it, returning its output. The script runs as the SSH user
+// regardless of SSHPrefix, so it should use sudo where it needs to.
+func (t *TestCluster) RunScript(m platform.Machine, localPath string, args ...string) ([]byte, error) {
+	stdout, stderr, err := platform.RunScript(m, localPath, args...)
+	t.logStderr(stderr)
 	return stdout, err
 }
+
+// MustSSH runs a ssh command on the given machine in the cluster like SSH,
+// but fails the test, including the command's stderr in the failure, if
+// the command is unsuccessful. It returns the command's trimmed stdout.
+func (t *TestCluster) MustSSH(m platform.Machine, cmd string) []byte {
+	cmd = t.prefixed(cmd)
+	out, stderr, err := m.SSH(cmd)
+	t.traceSSH(m, cmd, err)
+	if err != nil {
+		t.Fatalf("%q failed: output %q, stderr %q, status %v", cmd, out, stderr, err)
+	}
+	t.logStderr(stderr)
+	return out
+}
+
+// SSHJSON runs cmd like SSH and unmarshals its standard output, which must
+// be JSON, into v.
+func (t *TestCluster) SSHJSON(m platform.Machine, cmd string, v interface{}) error {
+	out, err := t.SSH(m, cmd)
+	if err != nil {
+		return fmt.Errorf("%q failed: output %q, status %v", cmd, out, err)
+	}
+	return platform.DecodeJSON(cmd, out, v)
+}
+
+// WaitForSSH blocks until m accepts SSH commands again, such as after a
+// reboot, or until timeout elapses.
+func (t *TestCluster) WaitForSSH(m platform.Machine, timeout time.Duration) error {
+	return platform.WaitForSSH(m, timeout)
+}
+
+// Sleep pauses the test for d, failing it early if the test's context is
+// cancelled first, such as when the test times out.
+func (t *TestCluster) Sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-t.Context().Done():
+		t.Fatalf("interrupted while sleeping for %v: %v", d, t.Context().Err())
+	}
+}
+
+// ForEachMachine runs fn on each of the cluster's machines concurrently,
+// a bounded number at a time, and waits for them all. Unlike a worker
+// group it doesn't stop at the first failure: it returns every error,
+// each prefixed with the machine it came from. Machines not yet started
+// when the test is cancelled are reported as errors too.
+func (t *TestCluster) ForEachMachine(fn func(platform.Machine) error) error {
+	var errs multierror.Error
+	var errLock sync.Mutex
+	addErr := func(m platform.Machine, err error) {
+		errLock.Lock()
+		errs = append(errs, fmt.Errorf("%s: %v", platform.MachineName(m), err))
+		errLock.Unlock()
+	}
+
+	// errors are collected rather than returned to the group, which
+	// would stop it starting the remaining machines
+	wg := worker.NewWorkerGroup(t.Context(), forEachMachineWorkers)
+	for _, m := range t.Machines() {
+		m := m
+		run := func(context.Context) error {
+			if err := fn(m); err != nil {
+				addErr(m, err)
+			}
+			return nil
+		}
+		if err := wg.Start(run); err != nil {
+			addErr(m, err)
+		}
+	}
+	wg.Wait()
+
+	return errs.AsError()
+}
+
+// SSHEach runs cmd on each of machines concurrently, like SSH, and
+// returns their outputs in the same order. It returns the first error,
+// prefixed with the machine it came from.
+func (t *TestCluster) SSHEach(machines []platform.Machine, cmd string) ([][]byte, error) {
+	outputs := make([][]byte, len(machines))
+	workers := make([]worker.Worker, len(machines))
+	for i, m := range machines {
+		i, m := i, m
+		workers[i] = func(context.Context) error {
+			out, err := t.SSH(m, cmd)
+			if err != nil {
+				return fmt.Errorf("%s: %v", platform.MachineName(m), err)
+			}
+			outputs[i] = out
+			return nil
+		}
+	}
+	if err := worker.Parallel(t.Context(), workers...); err != nil {
+		return nil, err
+	}
+	return outputs, nil
+}
+
+// WaitForClusterCondition evaluates fn over all of the cluster's machines
+// every interval until it reports true, such as once every member agrees
+// on a leader. Errors from fn are treated as the condition not holding
+// yet, since members are often briefly unreachable while a cluster
+// converges. fn should query the machines concurrently, e.g. with
+// SSHEach, so each evaluation takes about as long as its slowest machine.
+// WaitForClusterCondition returns an error including the last one from fn
+// if timeout elapses or the test is cancelled first.
+func (t *TestCluster) WaitForClusterCondition(timeout, interval time.Duration, fn func([]platform.Machine) (bool, error)) error {
+	ctx, cancel := context.WithTimeout(t.Context(), timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		ok, err := fn(t.Machines())
+		if err == nil && ok {
+			return nil
+		}
+		lastErr = err
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("cluster condition not met after %v: %v", timeout, lastErr)
+			}
+			return fmt.Errorf("cluster condition not met after %v", timeout)
+		}
+	}
+}
+
+// SetGuestTime sets m's system clock to tm, failing the test if it can't.
+func (t *TestCluster) SetGuestTime(m platform.Machine, tm time.Time) {
+	if err := platform.SetGuestTime(m, tm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// AssertClocksSynced fails the test unless the clocks of all of the
+// cluster's machines come within tolerance of the host's before timeout
+// elapses, e.g. after one was skewed to check that time synchronization
+// corrects it.
+func (t *TestCluster) AssertClocksSynced(tolerance, timeout time.Duration) {
+	var mu sync.Mutex
+	skewed := make(map[string]time.Duration)
+	err := t.WaitForClusterCondition(timeout, 5*time.Second, func(machines []platform.Machine) (bool, error) {
+		skewed = make(map[string]time.Duration)
+		workers := make([]worker.Worker, len(machines))
+		for i, m := range machines {
+			m := m
+			workers[i] = func(context.Context) error {
+				skew, err := platform.ClockSkew(m)
+				if err != nil {
+					return fmt.Errorf("%s: %v", platform.MachineName(m), err)
+				}
+				if skew > tolerance || skew < -tolerance {
+					mu.Lock()
+					skewed[platform.MachineName(m)] = skew
+					mu.Unlock()
+				}
+				return nil
+			}
+		}
+		if err := worker.Parallel(t.Context(), workers...); err != nil {
+			return false, err
+		}
+		return len(skewed) == 0, nil
+	})
+	if err != nil {
+		t.Fatalf("clocks did not sync within %v, skewed by %v: %v", tolerance, skewed, err)
+	}
+}
+
+// AssertDropin fails the test unless the systemd dropin named dropinName
+// for unit exists on m with exactly expectedContents, catching configs
+// whose escaping mangled the dropin on its way through Ignition.
+func (t *TestCluster) AssertDropin(m platform.Machine, unit, dropinName, expectedContents string) {
+	contents, err := platform.ReadDropin(m, unit, dropinName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contents != expectedContents {
+		t.Fatalf("%s contains %q, expected %q", platform.DropinPath(unit, dropinName), contents, expectedContents)
+	}
+}
+
+// AssertModuleLoaded fails the test unless the kernel module is loaded on
+// m or built into its kernel.
+func (t *TestCluster) AssertModuleLoaded(m platform.Machine, module string) {
+	loaded, err := platform.ModuleLoaded(m, module)
+	if err != nil {
+		t.Fatalf("checking for module %s: %v", module, err)
+	}
+	if !loaded {
+		t.Fatalf("module %s is not loaded", module)
+	}
+}
+
+// AssertPersistsAcrossReboot runs setup, reboots m, and runs check once m
+// is back up. The test fails if the machine did not actually reboot, so
+// check cannot pass by observing state from before the reboot.
+func (t *TestCluster) AssertPersistsAcrossReboot(m platform.Machine, setup func(), check func()) {
+	setup()
+
+	before := t.MustSSH(m, "cat /proc/sys/kernel/random/boot_id")
+	if err := m.Reboot(); err != nil {
+		t.Fatalf("rebooting %s: %v", m.ID(), err)
+	}
+	after := t.MustSSH(m, "cat /proc/sys/kernel/random/boot_id")
+	if string(before) == string(after) {
+		t.Fatalf("%s did not reboot: boot ID is still %s", m.ID(), after)
+	}
+
+	check()
+}
+
+// AssertMount fails the test unless a filesystem of type fstype is mounted
+// at mountpoint on m with all of the given mount options, as listed in
+// /proc/mounts.
+func (t *TestCluster) AssertMount(m platform.Machine, mountpoint, fstype string, opts ...string) {
+	mounts, err := platform.Mounts(m)
+	if err != nil {
+		t.Fatalf("listing mounts: %v", err)
+	}
+	mnt, ok := platform.FindMount(mounts, mountpoint)
+	if !ok {
+		t.Fatalf("nothing is mounted at %s", mountpoint)
+	}
+	if mnt.FSType != fstype {
+		t.Fatalf("%s is %s, expected %s", mountpoint, mnt.FSType, fstype)
+	}
+	for _, opt := range opts {
+		if !mnt.HasOption(opt) {
+			t.Fatalf("%s is missing mount option %q: %s", mountpoint, opt, strings.Join(mnt.Options, ","))
+		}
+	}
+}
+
+// AssertMemAvailable fails the test unless at least min bytes of memory
+// are available on m, as reported by MemAvailable in /proc/meminfo.
+func (t *TestCluster) AssertMemAvailable(m platform.Machine, min uint64) {
+	info, err := m.MemInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Available < min {
+		t.Fatalf("%s has %d bytes of memory available, expected at least %d", m.ID(), info.Available, min)
+	}
+}
+
+// AssertDiskAvailable fails the test unless the filesystem containing
+// path on m has at least min bytes available.
+func (t *TestCluster) AssertDiskAvailable(m platform.Machine, path string, min uint64) {
+	usage, err := m.DiskUsage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Available < min {
+		t.Fatalf("%s has %d bytes available on %s, expected at least %d", m.ID(), usage.Available, path, min)
+	}
+}
+
+// AssertSELinuxMode fails the test unless m's SELinux mode is mode, one
+// of platform.SELinuxEnforcing, SELinuxPermissive, or SELinuxDisabled.
+func (t *TestCluster) AssertSELinuxMode(m platform.Machine, mode string) {
+	got, err := platform.SELinuxMode(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != mode {
+		t.Fatalf("%s is in SELinux mode %s, expected %s", m.ID(), got, mode)
+	}
+}
+
+// AssertSELinuxContext fails the test unless path on m is labeled with
+// the security context label.
+func (t *TestCluster) AssertSELinuxContext(m platform.Machine, path, label string) {
+	got, err := platform.SELinuxContext(m, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != label {
+		t.Fatalf("%s is labeled %s, expected %s", path, got, label)
+	}
+}
+
+// AssertNoSELinuxDenials fails the test if any AVC denials were logged on
+// m since it booted, including those permissive mode allowed.
+func (t *TestCluster) AssertNoSELinuxDenials(m platform.Machine) {
+	denials, err := platform.SELinuxDenials(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range denials {
+		t.Errorf("SELinux %v", d)
+	}
+	if len(denials) > 0 {
+		t.FailNow()
+	}
+}
+
+// AssertPortOpen fails the test unless m accepts connections on port over
+// proto, "tcp" or "udp", when dialed from the host side of the cluster's
+// network rather than from inside the machine.
+func (t *TestCluster) AssertPortOpen(m platform.Machine, port int, proto string) {
+	if err := platform.CheckPortOpen(t.Cluster, m, port, proto); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// AssertCmdFails runs cmd on m like SSH and fails the test unless cmd exits
+// with expectedExitCode, which must be nonzero. Use it for negative tests,
+// such as checking that an operation is denied.
+func (t *TestCluster) AssertCmdFails(m platform.Machine, cmd string, expectedExitCode int) {
+	out, err := t.SSH(m, cmd)
+	if err == nil {
+		t.Fatalf("%q unexpectedly succeeded: output %q", cmd, out)
+	}
+	status, ok := platform.ExitStatus(err)
+	if !ok {
+		t.Fatalf("%q failed to run: %v", cmd, err)
+	}
+	if status != expectedExitCode {
+		t.Fatalf("%q exited with status %d, expected %d: output %q", cmd, status, expectedExitCode, out)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/fake"
+)
+
+func TestSSHPrefix(t *testing.T) {
+	for _, tt := range []struct {
+		shell  string
+		cmd    string
+		prefix string
+		want   string
+	}{
+		{"", "id -u", "", "id -u"},
+		{"", "id -u", "sudo", `sudo sh -c 'id -u'`},
+		{"bash", "echo 'a b' | tee x", "sudo", `sudo bash -c 'echo '\''a b'\'' | tee x'`},
+	} {
+		c, err := fake.NewCluster(&platform.RuntimeConfig{SSHShell: tt.shell})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tc := TestCluster{Cluster: c, SSHPrefix: tt.prefix}
+		if got := tc.prefixed(tt.cmd); got != tt.want {
+			t.Errorf("prefixed(%q) with shell %q = %q, expected %q", tt.cmd, tt.shell, got, tt.want)
+		}
+		c.Destroy()
+	}
+}
+
+func TestSSHPrefixQuoting(t *testing.T) {
+	c, err := fake.NewCluster(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy()
+
+	// a prefix which runs its arguments unchanged, so the quoting can be
+	// checked by a local shell
+	tc := TestCluster{Cluster: c, SSHPrefix: "env"}
+	cmd := `printf '%s|' "it's" '$HOME' "a  b" | tr '|' '\n'`
+	want, err := exec.Command("sh", "-c", cmd).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := exec.Command("sh", "-c", tc.prefixed(cmd)).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("prefixed command printed %q, expected %q", got, want)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		writes []string
+		lines  []string
+	}{
+		{"empty", nil, nil},
+		{"one line", []string{"a\n"}, []string{"a"}},
+		{"no trailing newline", []string{"a\nb"}, []string{"a", "b"}},
+		{"split across writes", []string{"he", "llo\nwor", "ld\n"}, []string{"hello", "world"}},
+		{"several lines per write", []string{"a\nb\nc\n"}, []string{"a", "b", "c"}},
+		{"blank lines", []string{"\n\na\n"}, []string{"", "", "a"}},
+		{"crlf", []string{"a\r\nb\r", "\n"}, []string{"a", "b"}},
+	} {
+		var lines []string
+		w := &lineWriter{emit: func(line []byte) { lines = append(lines, string(line)) }}
+		for _, s := range tt.writes {
+			if n, err := w.Write([]byte(s)); n != len(s) || err != nil {
+				t.Errorf("%s: Write(%q) = %d, %v", tt.name, s, n, err)
+			}
+		}
+		w.Flush()
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%s: got lines %q, expected %q", tt.name, lines, tt.lines)
+		}
+	}
+}
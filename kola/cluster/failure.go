@@ -0,0 +1,136 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// failureJournalLines is how much of each machine's journal to attach to a
+// failing test.
+const failureJournalLines = 200
+
+// failureDiagnosticsTimeout bounds how long a failing test waits for
+// diagnostics from its machines.
+const failureDiagnosticsTimeout = time.Minute
+
+// Error is like harness.H.Error, but attaches machine diagnostics to the
+// test first; see Errorf.
+func (t *TestCluster) Error(args ...interface{}) {
+	t.H.Helper()
+	t.attachFailureDiagnostics()
+	t.H.Error(args...)
+}
+
+// Errorf is like harness.H.Errorf, but first attaches each machine's
+// current console output, where the platform can provide it, and the end
+// of its journal to the test as artifacts. Diagnostics are only collected
+// for the test's first failure.
+func (t *TestCluster) Errorf(format string, args ...interface{}) {
+	t.H.Helper()
+	t.attachFailureDiagnostics()
+	t.H.Errorf(format, args...)
+}
+
+// Fatal is like harness.H.Fatal, but attaches machine diagnostics to the
+// test first; see Errorf.
+func (t *TestCluster) Fatal(args ...interface{}) {
+	t.H.Helper()
+	t.attachFailureDiagnostics()
+	t.H.Fatal(args...)
+}
+
+// Fatalf is like harness.H.Fatalf, but attaches machine diagnostics to the
+// test first; see Errorf.
+func (t *TestCluster) Fatalf(format string, args ...interface{}) {
+	t.H.Helper()
+	t.attachFailureDiagnostics()
+	t.H.Fatalf(format, args...)
+}
+
+// consoleSnapshotter is implemented by machines which can read their
+// console output while still running.
+type consoleSnapshotter interface {
+	ConsoleSnapshot() (string, error)
+}
+
+// failureDiagnostics is what could be collected from one machine.
+type failureDiagnostics struct {
+	m       platform.Machine
+	console []byte
+	journal []byte
+	errs    []error
+}
+
+func (t *TestCluster) attachFailureDiagnostics() {
+	if t.Cluster == nil || t.Failed() {
+		return
+	}
+
+	// Collect from every machine at once; a machine which has stopped
+	// answering SSH is exactly what a failing test may be reporting, so
+	// don't let it hold up the failure any longer than the timeout.
+	machines := t.Machines()
+	results := make(chan failureDiagnostics, len(machines))
+	for _, m := range machines {
+		if url := platform.ConsoleURL(m); url != "" {
+			t.Logf("console of %s: %s", m.ID(), url)
+		}
+		go func(m platform.Machine) {
+			results <- collectFailureDiagnostics(m)
+		}(m)
+	}
+
+	timeout := time.After(failureDiagnosticsTimeout)
+	for pending := len(machines); pending > 0; pending-- {
+		select {
+		case d := <-results:
+			for _, err := range d.errs {
+				t.Logf("collecting diagnostics from %s: %v", d.m.ID(), err)
+			}
+			if d.console != nil {
+				t.AddArtifact(d.m.ID()+"-failure-console.txt", d.console)
+			}
+			if d.journal != nil {
+				t.AddArtifact(d.m.ID()+"-failure-journal.txt", d.journal)
+			}
+		case <-timeout:
+			t.Logf("gave up collecting diagnostics from %d machine(s) after %v", pending, failureDiagnosticsTimeout)
+			return
+		}
+	}
+}
+
+func collectFailureDiagnostics(m platform.Machine) failureDiagnostics {
+	d := failureDiagnostics{m: m}
+	if cs, ok := m.(consoleSnapshotter); ok {
+		if console, err := cs.ConsoleSnapshot(); err != nil {
+			d.errs = append(d.errs, fmt.Errorf("reading console: %v", err))
+		} else {
+			d.console = []byte(console)
+		}
+	}
+
+	out, stderr, err := m.SSH(fmt.Sprintf("journalctl --no-pager -n %d", failureJournalLines))
+	if err != nil {
+		d.errs = append(d.errs, fmt.Errorf("reading journal: %v: %s", err, stderr))
+	} else {
+		d.journal = out
+	}
+	return d
+}
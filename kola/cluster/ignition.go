@@ -0,0 +1,96 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// IgnitionReport summarizes what Ignition did while provisioning a machine,
+// as recorded in the journal of the first boot.
+type IgnitionReport struct {
+	// Stages lists the Ignition stages that ran, in order.
+	Stages []string
+	// Messages holds every message Ignition logged.
+	Messages []string
+	// Errors holds the messages Ignition logged at error priority or
+	// higher. A successful provisioning run has none.
+	Errors []string
+}
+
+// Succeeded reports whether Ignition ran and logged no errors.
+func (r IgnitionReport) Succeeded() bool {
+	return len(r.Stages) > 0 && len(r.Errors) == 0
+}
+
+// IgnitionReport fetches and parses the Ignition log from the first boot
+// of m.
+func (t *TestCluster) IgnitionReport(m platform.Machine) (IgnitionReport, error) {
+	var report IgnitionReport
+
+	out, err := t.SSH(m, "journalctl --no-pager -o json -t ignition")
+	if err != nil {
+		return report, fmt.Errorf("reading ignition journal: %v", err)
+	}
+
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var entry struct {
+			Message  json.RawMessage `json:"MESSAGE"`
+			Priority string          `json:"PRIORITY"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return report, fmt.Errorf("parsing ignition journal: %v", err)
+		}
+
+		// journald encodes non-UTF-8 messages as byte arrays; skip them
+		var msg string
+		if err := json.Unmarshal(entry.Message, &msg); err != nil {
+			continue
+		}
+		report.Messages = append(report.Messages, msg)
+
+		// Ignition prefixes messages with the stage name, e.g.
+		// "files: createFilesystemsFiles: ..."
+		if i := strings.Index(msg, ": "); i > 0 && !strings.Contains(msg[:i], " ") {
+			if stage := msg[:i]; !seen[stage] {
+				seen[stage] = true
+				report.Stages = append(report.Stages, stage)
+			}
+		}
+
+		if prio, err := strconv.Atoi(entry.Priority); err == nil && prio <= 3 {
+			report.Errors = append(report.Errors, msg)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return report, fmt.Errorf("parsing ignition journal: %v", err)
+	}
+
+	if len(report.Messages) == 0 {
+		return report, fmt.Errorf("no ignition messages found in the journal")
+	}
+
+	return report, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/mantle/platform"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "kola/cluster")
+
+// RunStreaming runs cmd on m like SSH, but logs each line of its stdout
+// and stderr as soon as it arrives, both to the test's output and live to
+// the kola log, rather than buffering it until the command exits. Use it
+// for long-running commands so their progress is visible even if they
+// later hang or fail.
+func (t *TestCluster) RunStreaming(m platform.Machine, cmd string) error {
+	cmd = t.prefixed(cmd)
+
+	var mu sync.Mutex
+	logLine := func(stream string, line []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		plog.Infof("%s %s: %s", m.ID(), stream, line)
+		t.Logf("%s: %s", stream, line)
+	}
+	stdout := &lineWriter{emit: func(line []byte) { logLine("stdout", line) }}
+	stderr := &lineWriter{emit: func(line []byte) { logLine("stderr", line) }}
+
+	err := t.Cluster.SSHPipeOutput(m, cmd, stdout, stderr)
+	stdout.Flush()
+	stderr.Flush()
+	return err
+}
+
+// lineWriter is an io.Writer which calls emit for each complete line
+// written to it, without the trailing newline.
+type lineWriter struct {
+	emit func(line []byte)
+	buf  []byte
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(bytes.TrimRight(w.buf[:i], "\r"))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+// Flush emits any final line which lacked a trailing newline.
+func (w *lineWriter) Flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cluster
+
+import (
+	"strings"
+
+	"github.com/kylelemons/godebug/diff"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// AssertUnitContents fails the test with a diff unless `systemctl cat
+// unit` on m matches expected. The "# /path/to/file" headers that
+// systemctl adds before the unit and each drop-in are ignored, as is
+// leading and trailing whitespace.
+func (t *TestCluster) AssertUnitContents(m platform.Machine, unit, expected string) {
+	out, err := t.SSH(m, "systemctl cat "+platform.ShellQuote(unit))
+	if err != nil {
+		t.Fatalf("systemctl cat %s failed: %s: %v", unit, out, err)
+	}
+
+	actual := stripUnitHeaders(string(out))
+	expected = strings.TrimSpace(expected)
+	if actual != expected {
+		t.Fatalf("unit %s does not match (-expected +actual):\n%s", unit, diff.Diff(expected, actual))
+	}
+}
+
+// stripUnitHeaders removes the file name comments systemctl cat prints.
+func stripUnitHeaders(contents string) string {
+	var lines []string
+	for _, line := range strings.Split(contents, "\n") {
+		if strings.HasPrefix(line, "# /") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,101 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+// metadataDiagnostics are commands whose output helps explain failures
+// involving the platform metadata service: the metadata agent's journal,
+// and the attributes it wrote out for other units to consume. The agent
+// has been called coreos-metadata and afterburn; ask for both.
+var metadataDiagnostics = []struct {
+	name string
+	cmd  string
+}{
+	{
+		name: "metadata-journal.txt",
+		cmd:  "journalctl --no-pager -u coreos-metadata.service -u 'coreos-metadata-sshkeys@*' -u afterburn.service -u 'afterburn-sshkeys@*'",
+	},
+	{
+		name: "metadata-files.txt",
+		cmd:  "sudo sh -c 'for f in /run/metadata/*; do [ -f \"$f\" ] && echo \"==> $f <==\" && cat \"$f\"; done; true'",
+	},
+}
+
+// collectMetadataDiagnostics saves the metadata agent's logs and output
+// from each machine in c as artifacts of a failed test. Platforms without
+// a metadata service are skipped.
+func collectMetadataDiagnostics(h *harness.H, c platform.Cluster) {
+	if !h.Failed() || !c.Supports(platform.CapMetadata) {
+		return
+	}
+
+	for _, m := range c.Machines() {
+		for _, d := range metadataDiagnostics {
+			out, stderr, err := m.SSH(d.cmd)
+			if err != nil {
+				plog.Warningf("collecting %s from %s: %v: %s", d.name, platform.MachineName(m), err, stderr)
+				continue
+			}
+			h.AddArtifact(fmt.Sprintf("%s-%s", m.ID(), d.name), out)
+		}
+	}
+}
+
+// collectKernelDiagnostics saves the kernel log and the requested debugfs
+// files from each machine in c as artifacts of a failed test which asked
+// for kernel instrumentation.
+func collectKernelDiagnostics(h *harness.H, c platform.Cluster, t *register.Test) {
+	if !h.Failed() || (len(t.KernelArgs) == 0 && len(t.DebugfsFiles) == 0) {
+		return
+	}
+
+	diagnostics := []struct {
+		name string
+		cmd  string
+	}{
+		{
+			name: "dmesg.txt",
+			cmd:  "sudo dmesg",
+		},
+	}
+	for _, path := range t.DebugfsFiles {
+		diagnostics = append(diagnostics, struct {
+			name string
+			cmd  string
+		}{
+			name: "debugfs-" + strings.Replace(strings.Trim(path, "/"), "/", "-", -1) + ".txt",
+			cmd:  fmt.Sprintf("sudo sh -c 'mountpoint -q /sys/kernel/debug || mount -t debugfs debugfs /sys/kernel/debug; cat /sys/kernel/debug/%s'", path),
+		})
+	}
+
+	for _, m := range c.Machines() {
+		for _, d := range diagnostics {
+			out, stderr, err := m.SSH(d.cmd)
+			if err != nil {
+				plog.Warningf("collecting %s from %s: %v: %s", d.name, platform.MachineName(m), err, stderr)
+				continue
+			}
+			h.AddArtifact(fmt.Sprintf("%s-%s", m.ID(), d.name), out)
+		}
+	}
+}
@@ -15,14 +15,18 @@
 package kola
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/go-semver/semver"
@@ -36,26 +40,54 @@ import (
 	awsapi "github.com/coreos/mantle/platform/api/aws"
 	esxapi "github.com/coreos/mantle/platform/api/esx"
 	gcloudapi "github.com/coreos/mantle/platform/api/gcloud"
+	kubernetesapi "github.com/coreos/mantle/platform/api/kubernetes"
 	packetapi "github.com/coreos/mantle/platform/api/packet"
+	"github.com/coreos/mantle/platform/image"
 	"github.com/coreos/mantle/platform/machine/aws"
 	"github.com/coreos/mantle/platform/machine/esx"
 	"github.com/coreos/mantle/platform/machine/gcloud"
+	"github.com/coreos/mantle/platform/machine/kubernetes"
 	"github.com/coreos/mantle/platform/machine/packet"
 	"github.com/coreos/mantle/platform/machine/qemu"
 	"github.com/coreos/mantle/system"
+	"github.com/coreos/mantle/util"
+)
+
+const (
+	defaultReadyTimeout = 5 * time.Minute
+	readyPollInterval   = 5 * time.Second
+
+	// failedTestsFile, in the output directory, lists the tests which
+	// failed in that run.
+	failedTestsFile = "failed-tests.txt"
 )
 
 var (
 	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "kola")
 
-	Options       = platform.Options{}
-	QEMUOptions   = qemu.Options{Options: &Options}      // glue to set platform options from main
-	GCEOptions    = gcloudapi.Options{Options: &Options} // glue to set platform options from main
-	AWSOptions    = awsapi.Options{Options: &Options}    // glue to set platform options from main
-	PacketOptions = packetapi.Options{Options: &Options} // glue to set platform options from main
-	ESXOptions    = esxapi.Options{Options: &Options}    // glue to set platform options from main
-
-	TestParallelism   int    //glue var to set test parallelism from main
+	Options           = platform.Options{}
+	QEMUOptions       = qemu.Options{Options: &Options}          // glue to set platform options from main
+	GCEOptions        = gcloudapi.Options{Options: &Options}     // glue to set platform options from main
+	AWSOptions        = awsapi.Options{Options: &Options}        // glue to set platform options from main
+	PacketOptions     = packetapi.Options{Options: &Options}     // glue to set platform options from main
+	ESXOptions        = esxapi.Options{Options: &Options}        // glue to set platform options from main
+	KubernetesOptions = kubernetesapi.Options{Options: &Options} // glue to set platform options from main
+
+	ImageCacheDir     string // where remote images are downloaded for local platforms
+	MaxConsoleSize    int    // glue var to cap captured console output from main
+	SSHByDNSName      bool   // glue var to SSH to machines by DNS name where available
+	SSHShell          string // glue var for the remote shell to run SSH commands with
+	MaxSSHSessions    int    // glue var to bound concurrent SSH commands per machine
+	SSHRetries        int    // glue var for how often to rerun SSH commands whose connection dropped
+	BootRetries       int    // glue var for how often to replace cloud machines which fail to boot
+	DestroyWorkers    int    // glue var to bound how many machines a cluster destroys at once
+	TestParallelism   int    //glue var to set test parallelism from main; 1 runs tests serially
+	MaxTestWeight     int    // glue var to cap the total ResourceWeight of concurrent tests; 0 is unlimited
+	TestShuffle       bool   // glue var to run tests in a random order
+	TestShuffleSeed   int64  // glue var to reproduce a shuffled order; 0 picks a seed
+	QuietTests        bool   // glue var to print only failing tests' logs
+	TestLogFile       string // glue var naming each test's log file in its output dir; "" for none
+	SmokeOnly         bool   // glue var to run only tests in the smoke set
 	TAPFile           string // if not "", write TAP results here
 	TorcxManifestFile string // torcx manifest to expose to tests, if set
 	// TorcxManifest is the unmarshalled torcx manifest file. It is available for
@@ -63,6 +95,23 @@ var (
 	// manifest given to kola.
 	TorcxManifest *torcx.Manifest = nil
 
+	DockerRuncBinary       string // runc binary for docker tests to swap in, if set
+	DockerContainerdBinary string // containerd binary for docker tests to swap in, if set
+
+	TrustedCAs         []string // glue var for PEM CA certificates to trust in each machine
+	NoCompressUserData bool     // glue var to never compress user-data over a platform's size limit
+	RerunTests         []string // glue var to run only these tests, by name as reported in results
+
+	MatchRegexps   []string // glue var to run only tests whose names fully match one of these
+	ExcludeRegexps []string // glue var to skip tests whose names fully match any of these
+
+	DestroyTimeout time.Duration // glue var to bound how long tearing down a cluster may take
+
+	ConsolePollInterval time.Duration // glue var to space out console requests on cloud platforms
+
+	ImageSignature string // glue var for a detached signature of the image to verify before booting it
+	ImageKeyring   string // glue var for the keyring to verify ImageSignature against
+
 	consoleChecks = []struct {
 		desc     string
 		match    *regexp.Regexp
@@ -117,15 +166,99 @@ func NewCluster(pltfrm string, rconf *platform.RuntimeConfig) (cluster platform.
 		cluster, err = packet.NewCluster(&PacketOptions, rconf)
 	case "esx":
 		cluster, err = esx.NewCluster(&ESXOptions, rconf)
+	case "kubernetes":
+		cluster, err = kubernetes.NewCluster(&KubernetesOptions, rconf)
 	default:
 		err = fmt.Errorf("invalid platform %q", pltfrm)
 	}
 	return
 }
 
+// ResolveImage resolves the image source configured for pltfrm into
+// something the platform can boot. Remote images are downloaded into
+// ImageCacheDir for QEMU, and object store images are imported for
+// AWS (s3://) and GCE (gs://). The platform options are updated to refer
+// to the resolved image.
+//
+// If ImageSignature is set, QEMU images are verified against it before
+// every cluster boots them. Imported images can't be verified, so
+// ResolveImage refuses to import them; verify images as they are
+// uploaded with ore instead.
+func ResolveImage(pltfrm string) error {
+	if ImageSignature != "" {
+		if ImageKeyring == "" {
+			return fmt.Errorf("an image signature requires a keyring to verify it against")
+		}
+		if pltfrm != "qemu" {
+			return fmt.Errorf("cannot verify image signatures on platform %q", pltfrm)
+		}
+	}
+
+	switch pltfrm {
+	case "qemu":
+		src, err := image.ParseSource(QEMUOptions.DiskImage)
+		if err != nil {
+			return err
+		}
+		if !src.IsLocal() {
+			path, err := src.Fetch(ImageCacheDir, nil)
+			if err != nil {
+				return err
+			}
+			QEMUOptions.DiskImage = path
+		}
+		QEMUOptions.DiskImageSignature = ImageSignature
+		QEMUOptions.Keyring = ImageKeyring
+	case "aws":
+		src, err := image.ParseSource(AWSOptions.AMI)
+		if err != nil {
+			return err
+		}
+		if src.Scheme != image.S3 {
+			return nil
+		}
+		api, err := awsapi.New(&AWSOptions)
+		if err != nil {
+			return err
+		}
+		ami, err := api.ImportImage(src.Name(), src.Location)
+		if err != nil {
+			return fmt.Errorf("importing %v: %v", src, err)
+		}
+		AWSOptions.AMI = ami
+	case "gce":
+		src, err := image.ParseSource(GCEOptions.Image)
+		if err != nil {
+			return err
+		}
+		if src.Scheme != image.GCS {
+			return nil
+		}
+		api, err := gcloudapi.New(&GCEOptions)
+		if err != nil {
+			return err
+		}
+		link, err := api.ImportImage(src.Name(), src.Location)
+		if err != nil {
+			return fmt.Errorf("importing %v: %v", src, err)
+		}
+		GCEOptions.Image = link
+	}
+	return nil
+}
+
 func filterTests(tests map[string]*register.Test, pattern, platform string, version semver.Version) (map[string]*register.Test, error) {
 	r := make(map[string]*register.Test)
 
+	include, err := compileNameRegexps(MatchRegexps)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileNameRegexps(ExcludeRegexps)
+	if err != nil {
+		return nil, err
+	}
+
 	for name, t := range tests {
 		match, err := filepath.Match(pattern, t.Name)
 		if err != nil {
@@ -135,6 +268,19 @@ func filterTests(tests map[string]*register.Test, pattern, platform string, vers
 			continue
 		}
 
+		// the regexps refine the glob: a test must match one of the
+		// includes, if there are any, and none of the excludes
+		if len(include) > 0 && !matchAny(include, t.Name) {
+			continue
+		}
+		if matchAny(exclude, t.Name) {
+			continue
+		}
+
+		if SmokeOnly && !t.Smoke {
+			continue
+		}
+
 		// Check the test's min and end versions when running more then one test
 		if t.Name != pattern && versionOutsideRange(version, t.MinVersion, t.EndVersion) {
 			continue
@@ -177,6 +323,93 @@ func filterTests(tests map[string]*register.Test, pattern, platform string, vers
 	return r, nil
 }
 
+// compileNameRegexps compiles regular expressions which must match a whole
+// test name.
+func compileNameRegexps(exprs []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, expr := range exprs {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid test name regexp %q: %v", expr, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matchAny reports whether any of res matches s.
+func matchAny(res []*regexp.Regexp, s string) bool {
+	for _, re := range res {
+		if re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// clusterSetupName is the name of the subtest running a test's
+// ClusterSetup, which subtest patterns always select.
+const clusterSetupName = "ClusterSetup"
+
+// splitSubtestPattern splits a pattern such as
+// "docker.base/networks-reliably" into the glob selecting tests and the
+// glob selecting their subtests, which is "" if there is none.
+func splitSubtestPattern(pattern string) (string, string) {
+	if i := strings.Index(pattern, "/"); i >= 0 {
+		return pattern[:i], pattern[i+1:]
+	}
+	return pattern, ""
+}
+
+// subtestMatch returns the harness match expression selecting subtests
+// by the glob subtests, whose "/"-separated elements select subtests at
+// successive levels, or "" for all subtests. If test names are
+// qualified by platform, they occupy two levels of the expression.
+// ClusterSetup subtests are always selected, so the shared setup of the
+// selected subtests still runs.
+func subtestMatch(subtests string, qualified bool) string {
+	if subtests == "" {
+		return ""
+	}
+
+	// an empty expression matches any test name
+	levels := []string{""}
+	if qualified {
+		levels = append(levels, "")
+	}
+	for i, glob := range strings.Split(subtests, "/") {
+		re := globRegexp(glob)
+		if i == 0 {
+			re = clusterSetupName + "|" + re
+		}
+		levels = append(levels, "^(?:"+re+")$")
+	}
+	return strings.Join(levels, "/")
+}
+
+// globRegexp converts a glob of "*" and "?" wildcards to an equivalent
+// regular expression.
+func globRegexp(glob string) string {
+	var buf bytes.Buffer
+	for _, r := range glob {
+		switch r {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		default:
+			buf.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	return buf.String()
+}
+
+// supportsMetadataSSHKeys reports whether c can deliver SSH keys through
+// provider metadata rather than the userdata.
+func supportsMetadataSSHKeys(c platform.Cluster) bool {
+	return c.Supports(platform.CapMetadataSSHKey)
+}
+
 // versionOutsideRange checks to see if version is outside [min, end). If end
 // is a zero value, it is ignored and there is no upper bound. If version is a
 // zero value, the bounds are ignored.
@@ -202,25 +435,11 @@ func versionOutsideRange(version, minVersion, endVersion semver.Version) bool {
 // register tests in their init() function.
 // outputDir is where various test logs and data will be written for
 // analysis after the test run. If it already exists it will be erased!
-func RunTests(pattern, pltfrm, outputDir string) error {
-	// Avoid incurring cost of starting machine in getClusterSemver when
-	// either:
-	// 1) none of the selected tests care about the version
-	// 2) glob is an exact match which means minVersion will be ignored
-	//    either way
-	// 3) the provided torcx flag is wrong
-	tests, err := filterTests(register.Tests, pattern, pltfrm, semver.Version{})
-	if err != nil {
-		plog.Fatal(err)
-	}
-
-	skipGetVersion := true
-	for name, t := range tests {
-		if name != pattern && (t.MinVersion != semver.Version{} || t.EndVersion != semver.Version{}) {
-			skipGetVersion = false
-			break
-		}
-	}
+//
+// When more than one platform is given the selected tests run on each of
+// them, and test names are qualified with the platform, e.g. "qemu/foo".
+func RunTests(pattern string, pltfrms []string, outputDir string) error {
+	pattern, subtests := splitSubtestPattern(pattern)
 
 	if TorcxManifestFile != "" {
 		TorcxManifest = &torcx.Manifest{}
@@ -234,41 +453,77 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 		torcxManifestFile.Close()
 	}
 
-	if !skipGetVersion {
-		version, err := getClusterSemver(pltfrm, outputDir)
-		if err != nil {
-			plog.Fatal(err)
+	limiter := newWeightLimiter(MaxTestWeight)
+
+	var rerun map[string]bool
+	if RerunTests != nil {
+		rerun = make(map[string]bool)
+		for _, name := range RerunTests {
+			rerun[name] = true
 		}
+	}
 
-		// one more filter pass now that we know real version
-		tests, err = filterTests(tests, pattern, pltfrm, *version)
+	var failedLock sync.Mutex
+	var failed []string
+
+	var htests harness.Tests
+	for _, pltfrm := range pltfrms {
+		tests, err := platformTests(pattern, pltfrm, outputDir)
 		if err != nil {
-			plog.Fatal(err)
+			return err
+		}
+
+		for _, test := range tests {
+			name := test.Name
+			if len(pltfrms) > 1 {
+				name = pltfrm + "/" + name
+			}
+			if rerun != nil && !rerun[name] {
+				continue
+			}
+
+			test, pltfrm := test, pltfrm // for the closure
+			run := func(h *harness.H) {
+				defer func() {
+					if h.Failed() {
+						failedLock.Lock()
+						failed = append(failed, name)
+						failedLock.Unlock()
+					}
+				}()
+				runTest(h, test, pltfrm, limiter)
+			}
+			htests.Add(name, run)
 		}
 	}
 
 	opts := harness.Options{
-		OutputDir: outputDir,
-		Parallel:  TestParallelism,
-		Verbose:   true,
+		OutputDir:   outputDir,
+		Parallel:    TestParallelism,
+		Verbose:     !QuietTests,
+		Match:       subtestMatch(subtests, len(pltfrms) > 1),
+		Shuffle:     TestShuffle,
+		ShuffleSeed: TestShuffleSeed,
+		LogFile:     TestLogFile,
 	}
-	var htests harness.Tests
-	for _, test := range tests {
-		test := test // for the closure
-		run := func(h *harness.H) {
-			runTest(h, test, pltfrm)
+	suite := harness.NewSuite(opts, htests)
+	// an interrupted run exits without returning here, so it must copy
+	// out the TAP results of the tests that did finish itself
+	stopInterrupts := handleInterrupts(func() {
+		if err := copyTAPFile(outputDir); err != nil {
+			plog.Errorf("copying TAP results: %v", err)
 		}
-		htests.Add(test.Name, run)
-	}
+	})
+	err := suite.Run()
+	stopInterrupts()
 
-	suite := harness.NewSuite(opts, htests)
-	err = suite.Run()
+	// the harness empties outputDir, so this must come after the run
+	if err2 := writeFailedTests(outputDir, failed); err2 != nil {
+		plog.Errorf("recording failed tests: %v", err2)
+	}
 
-	if TAPFile != "" {
-		src := filepath.Join(outputDir, "test.tap")
-		if err2 := system.CopyRegularFile(src, TAPFile); err == nil && err2 != nil {
-			err = err2
-		}
+	if err2 := copyTAPFile(outputDir); err == nil && err2 != nil {
+		err = err2
 	}
 
 	if err != nil {
@@ -280,6 +535,80 @@ func RunTests(pattern, pltfrm, outputDir string) error {
 	return err
 }
 
+// copyTAPFile copies the TAP results of the run in outputDir to TAPFile,
+// if it is set.
+func copyTAPFile(outputDir string) error {
+	if TAPFile == "" {
+		return nil
+	}
+	return system.CopyRegularFile(filepath.Join(outputDir, "test.tap"), TAPFile)
+}
+
+// writeFailedTests lists the names of failed tests in outputDir, for
+// ReadFailedTests.
+func writeFailedTests(outputDir string, failed []string) error {
+	sort.Strings(failed)
+	var buf bytes.Buffer
+	for _, name := range failed {
+		fmt.Fprintln(&buf, name)
+	}
+	return ioutil.WriteFile(filepath.Join(outputDir, failedTestsFile), buf.Bytes(), 0644)
+}
+
+// ReadFailedTests returns the names of the tests which failed in the run
+// whose output is in outputDir, suitable for RerunTests.
+func ReadFailedTests(outputDir string) ([]string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, failedTestsFile))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, name := range strings.Split(string(data), "\n") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// platformTests returns the tests matching pattern which can run on
+// pltfrm.
+func platformTests(pattern, pltfrm, outputDir string) (map[string]*register.Test, error) {
+	// Avoid incurring cost of starting machine in getClusterSemver when
+	// either:
+	// 1) none of the selected tests care about the version
+	// 2) glob is an exact match which means minVersion will be ignored
+	//    either way
+	// 3) the provided torcx flag is wrong
+	tests, err := filterTests(register.Tests, pattern, pltfrm, semver.Version{})
+	if err != nil {
+		return nil, err
+	}
+
+	skipGetVersion := true
+	for name, t := range tests {
+		if name != pattern && (t.MinVersion != semver.Version{} || t.EndVersion != semver.Version{}) {
+			skipGetVersion = false
+			break
+		}
+	}
+
+	if !skipGetVersion {
+		version, err := getClusterSemver(pltfrm, outputDir)
+		if err != nil {
+			return nil, err
+		}
+
+		// one more filter pass now that we know real version
+		tests, err = filterTests(tests, pattern, pltfrm, *version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return tests, nil
+}
+
 // getClusterSemVer returns the CoreOS semantic version via starting a
 // machine and checking
 func getClusterSemver(pltfrm, outputDir string) (*semver.Version, error) {
@@ -307,12 +636,12 @@ func getClusterSemver(pltfrm, outputDir string) (*semver.Version, error) {
 		return nil, fmt.Errorf("creating new machine for semver check: %v", err)
 	}
 
-	out, stderr, err := m.SSH("grep ^VERSION_ID= /etc/os-release")
+	osRelease, err := m.OSRelease()
 	if err != nil {
-		return nil, fmt.Errorf("parsing /etc/os-release: %v: %s", err, stderr)
+		return nil, err
 	}
 
-	version, err := semver.NewVersion(strings.Split(string(out), "=")[1])
+	version, err := semver.NewVersion(osRelease["VERSION_ID"])
 	if err != nil {
 		return nil, fmt.Errorf("parsing os-release semver: %v", err)
 	}
@@ -320,32 +649,78 @@ func getClusterSemver(pltfrm, outputDir string) (*semver.Version, error) {
 	return version, nil
 }
 
+// checkHostOOM fails the test if the kernel killed any of the cluster's
+// host processes, such as a QEMU guest, for exceeding the memory limit of
+// the cluster's host cgroup.
+func checkHostOOM(h *harness.H, c platform.Cluster) {
+	reporter, ok := c.(platform.HostOOMReporter)
+	if !ok {
+		return
+	}
+	kills, err := reporter.HostOOMKills()
+	if err != nil {
+		plog.Warningf("checking host cgroup for OOM kills: %v", err)
+	} else if kills > 0 {
+		h.Errorf("host cgroup OOM: %d cluster processes killed for exceeding the memory limit", kills)
+	}
+}
+
 // runTest is a harness for running a single test.
 // outputDir is where various test logs and data will be written for
 // analysis after the test run. It should already exist.
-func runTest(h *harness.H, t *register.Test, pltfrm string) {
-	h.Parallel()
-
-	// don't go too fast, in case we're talking to a rate limiting api like AWS EC2.
-	// FIXME(marineam): API requests must do their own
-	// backoff due to rate limiting, this is unreliable.
-	max := int64(2 * time.Second)
-	splay := time.Duration(rand.Int63n(max))
-	time.Sleep(splay)
-
+func runTest(h *harness.H, t *register.Test, pltfrm string, limiter *weightLimiter) {
 	rconf := &platform.RuntimeConfig{
-		OutputDir:          h.OutputDir(),
-		NoSSHKeyInUserData: t.HasFlag(register.NoSSHKeyInUserData),
-		NoSSHKeyInMetadata: t.HasFlag(register.NoSSHKeyInMetadata),
-		NoEnableSelinux:    t.HasFlag(register.NoEnableSelinux),
-	}
+		OutputDir:           h.OutputDir(),
+		Parallel:            TestParallelism,
+		NoSSHKeyInUserData:  t.HasFlag(register.NoSSHKeyInUserData),
+		NoSSHKeyInMetadata:  t.HasFlag(register.NoSSHKeyInMetadata),
+		NoEnableSelinux:     t.HasFlag(register.NoEnableSelinux),
+		MaxConsoleSize:      MaxConsoleSize,
+		ConsolePollInterval: ConsolePollInterval,
+		InstanceMetadata:    t.InstanceMetadata,
+		SSHByDNSName:        SSHByDNSName,
+		SSHShell:            SSHShell,
+		MaxSSHSessions:      MaxSSHSessions,
+		SSHRetries:          SSHRetries,
+		BootRetries:         BootRetries,
+		TrustedCAs:          TrustedCAs,
+		NoCompressUserData:  NoCompressUserData,
+		DestroyWorkers:      DestroyWorkers,
+		DestroyTimeout:      DestroyTimeout,
+	}
+
+	// In serial mode each test runs to completion before the next one
+	// starts, so only one test's machines exist at a time.
+	if rconf.Parallel != 1 {
+		h.Parallel()
+
+		// don't go too fast, in case we're talking to a rate limiting api like AWS EC2.
+		// FIXME(marineam): API requests must do their own
+		// backoff due to rate limiting, this is unreliable.
+		max := int64(2 * time.Second)
+		splay := time.Duration(rand.Int63n(max))
+		time.Sleep(splay)
+	}
+
+	weight := limiter.acquire(testWeight(t))
+	defer limiter.release(weight)
+
 	c, err := NewCluster(pltfrm, rconf)
 	if err != nil {
 		h.Fatalf("Cluster failed: %v", err)
 	}
+	if !liveClusters.add(c) {
+		c.Destroy()
+		h.Fatalf("Run interrupted")
+	}
+	// deferred first so the cluster is destroyed even if collecting
+	// diagnostics stops the test
 	defer func() {
-		if err := c.Destroy(); err != nil {
-			plog.Errorf("cluster.Destroy(): %v", err)
+		// an interrupted run destroys the cluster itself
+		if liveClusters.remove(c) {
+			if err := c.Destroy(); err != nil {
+				plog.Errorf("cluster.Destroy(): %v", err)
+			}
 		}
 		for id, output := range c.ConsoleOutput() {
 			for _, badness := range CheckConsole([]byte(output), t) {
@@ -353,6 +728,16 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 			}
 		}
 	}()
+	defer func() {
+		checkHostOOM(h, c)
+		collectMetadataDiagnostics(h, c)
+		collectKernelDiagnostics(h, c, t)
+	}()
+
+	// without a key in the userdata it must come from metadata
+	if t.HasFlag(register.NoSSHKeyInUserData) && !supportsMetadataSSHKeys(c) {
+		h.Skipf("platform %q can't deliver SSH keys through metadata", pltfrm)
+	}
 
 	if t.ClusterSize > 0 {
 		url, err := c.GetDiscoveryURL(t.ClusterSize)
@@ -363,6 +748,9 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 		userdata := t.UserData
 		if userdata != nil {
 			userdata = userdata.Subst("$discovery", url)
+			if t.IgnitionVersion != "" {
+				userdata = userdata.TargetIgnition(t.IgnitionVersion)
+			}
 		}
 		if _, err := platform.NewMachines(c, userdata, t.ClusterSize); err != nil {
 			h.Fatalf("Cluster failed starting machines: %v", err)
@@ -382,11 +770,35 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 		NativeFuncs: names,
 	}
 
+	if len(t.KernelArgs) > 0 {
+		if err := tcluster.ForEachMachine(func(m platform.Machine) error {
+			return platform.AppendKernelArgs(m, t.KernelArgs...)
+		}); err != nil {
+			h.Fatalf("Cluster failed setting kernel arguments: %v", err)
+		}
+	}
+
 	// drop kolet binary on machines
 	if t.NativeFuncs != nil {
 		scpKolet(tcluster, architecture(pltfrm))
 	}
 
+	if t.ReadyCmd != "" {
+		timeout := t.ReadyTimeout
+		if timeout == 0 {
+			timeout = defaultReadyTimeout
+		}
+		if err := waitForReady(c, t.ReadyCmd, timeout); err != nil {
+			h.Fatalf("Cluster not ready: %v", err)
+		}
+	}
+
+	if t.ClusterSetup != nil {
+		if !tcluster.Run(clusterSetupName, t.ClusterSetup) {
+			h.Fatalf("Cluster setup failed")
+		}
+	}
+
 	defer func() {
 		// give some time for the remote journal to be flushed so it can be read
 		// before we run the deferred machine destruction
@@ -397,6 +809,27 @@ func runTest(h *harness.H, t *register.Test, pltfrm string) {
 	t.Run(tcluster)
 }
 
+// waitForReady polls each machine in c until cmd succeeds on it, or
+// returns an error once timeout has elapsed.
+func waitForReady(c platform.Cluster, cmd string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, m := range c.Machines() {
+		// machines share the timeout, so later ones get what is left
+		attempts := int(deadline.Sub(time.Now())/readyPollInterval) + 1
+		err := util.Retry(attempts, readyPollInterval, func() error {
+			out, stderr, err := m.SSH(cmd)
+			if err != nil {
+				return fmt.Errorf("%v: %s%s", err, out, stderr)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("%q did not succeed on machine %s within %v: %v", cmd, m.ID(), timeout, err)
+		}
+	}
+	return nil
+}
+
 // architecture returns the machine architecture of the given platform.
 func architecture(pltfrm string) string {
 	nativeArch := "amd64"
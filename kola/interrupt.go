@@ -0,0 +1,106 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// clusterRegistry tracks the clusters of running tests so an interrupted
+// run can destroy them instead of leaking machines.
+type clusterRegistry struct {
+	mu       sync.Mutex
+	clusters map[platform.Cluster]struct{}
+	closed   bool
+}
+
+var liveClusters = &clusterRegistry{clusters: make(map[platform.Cluster]struct{})}
+
+// add registers c. It returns false if the run is being interrupted, in
+// which case the caller must destroy c itself.
+func (r *clusterRegistry) add(c platform.Cluster) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return false
+	}
+	r.clusters[c] = struct{}{}
+	return true
+}
+
+// remove unregisters c. It returns false if c was already claimed by
+// destroyAll, which then takes care of destroying it.
+func (r *clusterRegistry) remove(c platform.Cluster) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.clusters[c]; !ok {
+		return false
+	}
+	delete(r.clusters, c)
+	return true
+}
+
+// destroyAll destroys every registered cluster and refuses new ones.
+func (r *clusterRegistry) destroyAll() {
+	r.mu.Lock()
+	clusters := r.clusters
+	r.clusters = make(map[platform.Cluster]struct{})
+	r.closed = true
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for c := range clusters {
+		wg.Add(1)
+		go func(c platform.Cluster) {
+			defer wg.Done()
+			if err := c.Destroy(); err != nil {
+				plog.Errorf("cluster.Destroy(): %v", err)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
+
+// handleInterrupts destroys all live clusters, calls flush to save the
+// results so far, and exits if the process receives SIGINT or SIGTERM
+// before the returned stop function is called. A second signal during
+// cleanup kills the process immediately.
+func handleInterrupts(flush func()) (stop func()) {
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case sig := <-sigs:
+			signal.Stop(sigs)
+			plog.Errorf("received %v, destroying all clusters", sig)
+			liveClusters.destroyAll()
+			flush()
+			os.Exit(1)
+		case <-done:
+		}
+	}()
+
+	return func() {
+		signal.Stop(sigs)
+		close(done)
+	}
+}
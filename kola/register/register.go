@@ -16,6 +16,7 @@ package register
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
 
@@ -26,7 +27,7 @@ import (
 type Flag int
 
 const (
-	NoSSHKeyInUserData    Flag = iota // don't inject SSH key into Ignition/cloud-config
+	NoSSHKeyInUserData    Flag = iota // don't inject SSH key into Ignition/cloud-config; skipped on clusters without platform.CapMetadataSSHKey
 	NoSSHKeyInMetadata                // don't add SSH key to platform metadata
 	NoEmergencyShellCheck             // don't check console output for emergency shell invocation
 	NoEnableSelinux                   // don't enable selinux when starting or rebooting a machine
@@ -47,6 +48,61 @@ type Test struct {
 	Architectures    []string // whitelist of machine architectures supported -- defaults to all
 	Flags            []Flag   // special-case options for this test
 
+	// InstanceMetadata is attached to each machine at launch on GCE,
+	// readable from the guest through its metadata server. See
+	// platform.RuntimeConfig.InstanceMetadata.
+	InstanceMetadata map[string]string
+
+	// ReadyCmd, if set, is run on each machine after it boots until it
+	// succeeds, before Run is called, e.g. to wait for a service the
+	// test depends on. The test fails if ReadyCmd has not succeeded on
+	// every machine within ReadyTimeout, which defaults to 5 minutes.
+	ReadyCmd     string
+	ReadyTimeout time.Duration
+
+	// ClusterSetup, if set, runs once after every machine is up and
+	// ready and before Run, to do work which Run's subtests share,
+	// such as pulling or building container images. It runs as a
+	// subtest named "ClusterSetup"; if it fails, the test fails
+	// without calling Run.
+	ClusterSetup func(cluster.TestCluster)
+
+	// ResourceWeight is how heavily the test loads the host relative to
+	// a test running a single typical machine; it defaults to
+	// ClusterSize. Tests running at once are limited to a total weight
+	// when the harness is given one.
+	ResourceWeight int
+
+	// IgnitionVersion, if set, is the Ignition spec version ("2.0" or
+	// "2.1") that a Container Linux config UserData is transpiled to.
+	IgnitionVersion string
+
+	// KernelArgs are appended to the kernel command line of the
+	// machines started for the test, e.g. "slub_debug=FZPU" to
+	// instrument the kernel; each machine is rebooted once to apply
+	// them. Failed tests then also save each machine's kernel log.
+	// Tests with KernelArgs must have a ClusterSize, since machines
+	// they start themselves aren't modified.
+	KernelArgs []string
+
+	// DebugfsFiles are paths under /sys/kernel/debug, such as
+	// "kmemleak", saved from each machine when the test fails.
+	DebugfsFiles []string
+
+	// Destructive marks a test which leaves its machines unfit for other
+	// tests, e.g. by corrupting partitions or changing which one boots.
+	// Each test gets fresh machines today, but a harness which shares
+	// machines between tests must not reuse them after a destructive
+	// test, nor after one with KernelArgs.
+	Destructive bool
+
+	// Smoke adds the test to the smoke set, which `kola run --smoke`
+	// runs alone to gate merges. Smoke tests must be fast, reliable,
+	// and broad: a single machine, a few minutes at most, and no
+	// dependencies on external services. Name patterns and platform
+	// restrictions still apply within the set.
+	Smoke bool
+
 	// MinVersion prevents the test from executing on CoreOS machines
 	// less than MinVersion. This will be ignored if the name fully
 	// matches without globbing.
@@ -74,6 +130,10 @@ func Register(t *Test) {
 		panic(fmt.Sprintf("test %v has an invalid version range", t.Name))
 	}
 
+	if len(t.KernelArgs) > 0 && t.ClusterSize == 0 {
+		panic(fmt.Sprintf("test %v has KernelArgs but no ClusterSize", t.Name))
+	}
+
 	Tests[t.Name] = t
 }
 
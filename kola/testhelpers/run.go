@@ -0,0 +1,50 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package testhelpers runs kola test functions outside of kola, such as
+// against a cluster from platform/fake, so that their logic can be unit
+// tested.
+package testhelpers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/platform"
+)
+
+// Run runs f as a test named name with a TestCluster for c. The test's
+// output is printed as kola would, and its output directory is removed
+// afterwards. Run returns harness.SuiteFailed if the test failed.
+func Run(name string, c platform.Cluster, f func(cluster.TestCluster)) error {
+	dir, err := ioutil.TempDir("", "kola-testhelpers")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	var tests harness.Tests
+	tests.Add(name, func(h *harness.H) {
+		f(cluster.TestCluster{H: h, Cluster: c})
+	})
+
+	opts := harness.Options{
+		OutputDir: filepath.Join(dir, "_kola_temp"),
+		Parallel:  1,
+	}
+	return harness.NewSuite(opts, tests).Run()
+}
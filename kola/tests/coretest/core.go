@@ -29,6 +29,7 @@ func init() {
 		Name:        "coreos.basic",
 		Run:         LocalTests,
 		ClusterSize: 1,
+		Smoke:       true,
 		NativeFuncs: map[string]func() error{
 			"CloudConfig":      TestCloudinitCloudConfig,
 			"Script":           TestCloudinitScript,
@@ -0,0 +1,115 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/coreos/mantle/kola"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+// commitRegexp matches the commit in the --version output of runc and
+// containerd, which docker reports in its info. runc prints it on its own
+// "commit:" line, containerd 0.2 at the end of its single version line,
+// and containerd 1.0 after its version without a label.
+var commitRegexp = regexp.MustCompile(`commit: ([0-9a-f]+)|(?m)^containerd \S+ v\S+ ([0-9a-f]+)$`)
+
+// versionCommit returns the commit in out, the --version output of runc or
+// containerd, or "" if there is none.
+func versionCommit(out []byte) string {
+	match := commitRegexp.FindSubmatch(out)
+	if match == nil {
+		return ""
+	}
+	if len(match[1]) > 0 {
+		return string(match[1])
+	}
+	return string(match[2])
+}
+
+func init() {
+	// Qualify candidate builds of the components docker runs containers
+	// with, given to kola with --docker-runc and --docker-containerd.
+	register.Register(&register.Test{
+		Run:         dockerCandidateComponents,
+		ClusterSize: 1,
+		Name:        "docker.candidate-components",
+	})
+}
+
+func dockerCandidateComponents(c cluster.TestCluster) {
+	if kola.DockerRuncBinary == "" && kola.DockerContainerdBinary == "" {
+		c.Skip("no candidate runc or containerd binary provided")
+	}
+
+	m := c.Machines()[0]
+
+	var runcCommit, containerdCommit string
+	if kola.DockerRuncBinary != "" {
+		runcCommit = swapDockerBinary(c, m, "docker-runc", kola.DockerRuncBinary)
+	}
+	if kola.DockerContainerdBinary != "" {
+		containerdCommit = swapDockerBinary(c, m, "docker-containerd", kola.DockerContainerdBinary)
+	}
+	c.MustSSH(m, "sudo systemctl restart docker")
+
+	info, err := GetDockerInfo(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+	if runcCommit != "" && info.RuncCommit.ID != runcCommit {
+		c.Errorf("docker is using runc %v, expected candidate %v", info.RuncCommit.ID, runcCommit)
+	}
+	if containerdCommit != "" && info.ContainerdCommit.ID != containerdCommit {
+		c.Errorf("docker is using containerd %v, expected candidate %v", info.ContainerdCommit.ID, containerdCommit)
+	}
+
+	// the candidates must still be able to run containers
+	genDockerContainer(c, m, "echo", []string{"echo"})
+	containers := trackContainers(c)
+	defer containers.Cleanup()
+	if _, err := containers.RunAndCheck(m, []string{"echo", "echo", "IT WORKED"}, ContainerExpectation{Stdout: "IT WORKED"}); err != nil {
+		c.Fatal(err)
+	}
+}
+
+// swapDockerBinary bind mounts the local binary over the named docker
+// component on m, since /usr is read-only, and returns the commit the
+// binary reports. Docker must be restarted to pick it up.
+func swapDockerBinary(c cluster.TestCluster, m platform.Machine, name, localPath string) string {
+	f, err := os.Open(localPath)
+	if err != nil {
+		c.Fatal(err)
+	}
+	defer f.Close()
+
+	candidate := "/var/lib/kola/" + name
+	if err := platform.InstallFile(f, m, candidate); err != nil {
+		c.Fatalf("installing %s: %v", name, err)
+	}
+	c.MustSSH(m, fmt.Sprintf("sudo chmod 0755 %s && sudo mount --bind %s $(readlink -f $(which %s))", candidate, candidate, name))
+
+	out := c.MustSSH(m, fmt.Sprintf("%s --version", name))
+	commit := versionCommit(out)
+	if commit == "" {
+		c.Fatalf("no commit in %s --version output: %q", name, out)
+	}
+	return commit
+}
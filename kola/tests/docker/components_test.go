@@ -0,0 +1,88 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"testing"
+)
+
+func TestVersionCommit(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		out    string
+		commit string
+	}{
+		{
+			name:   "runc",
+			out:    "runc version 1.0.0-rc2\ncommit: 54296cf40ad8143b62dbcaa1d90e520a2136ddfe\nspec: 1.0.0-rc2-dev",
+			commit: "54296cf40ad8143b62dbcaa1d90e520a2136ddfe",
+		},
+		{
+			name:   "runc dev",
+			out:    "runc version 1.0.0-rc4+dev\ncommit: 3f2f8b84a77f73d38244dd690525642a72156c64\nspec: 1.0.0",
+			commit: "3f2f8b84a77f73d38244dd690525642a72156c64",
+		},
+		{
+			name:   "containerd 0.2",
+			out:    "containerd version 0.2.4 commit: 0366d7e9693c930cf18c0f50cc16acec064e96c5",
+			commit: "0366d7e9693c930cf18c0f50cc16acec064e96c5",
+		},
+		{
+			name:   "containerd 1.0",
+			out:    "containerd github.com/containerd/containerd v1.0.0 89623f28b87a6004d4b785663257362d1658a729",
+			commit: "89623f28b87a6004d4b785663257362d1658a729",
+		},
+		{
+			name:   "no commit",
+			out:    "runc version 1.0.0-rc2\nspec: 1.0.0-rc2-dev",
+			commit: "",
+		},
+	} {
+		if commit := versionCommit([]byte(tt.out)); commit != tt.commit {
+			t.Errorf("%s: got commit %q, expected %q", tt.name, commit, tt.commit)
+		}
+	}
+}
+
+func TestCompareAPIVersions(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		cmp  int
+		err  bool
+	}{
+		{"1.24", "1.24", 0, false},
+		{"1.12", "1.24", -1, false},
+		{"1.24", "1.12", 1, false},
+		{"1.9", "1.10", -1, false},
+		{"1.24", "1.24.0", 0, false},
+		{"1.24.1", "1.24", 1, false},
+		{"2", "1.40", 1, false},
+		{"1.x", "1.24", 0, true},
+		{"1.24", "", 0, true},
+	} {
+		cmp, err := compareAPIVersions(tt.a, tt.b)
+		if tt.err {
+			if err == nil {
+				t.Errorf("compareAPIVersions(%q, %q) succeeded, expected an error", tt.a, tt.b)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("compareAPIVersions(%q, %q) failed: %v", tt.a, tt.b, err)
+		} else if cmp != tt.cmp {
+			t.Errorf("compareAPIVersions(%q, %q) = %d, expected %d", tt.a, tt.b, cmp, tt.cmp)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/platform"
+)
+
+const (
+	defaultContainerTimeout = 5 * time.Minute
+
+	// timeoutExitStatus is the exit status of timeout(1) when the
+	// command times out.
+	timeoutExitStatus = 124
+)
+
+// ContainerExpectation describes the expected result of a `docker run`.
+type ContainerExpectation struct {
+	// ExitCode is the expected exit status of the container.
+	ExitCode int
+
+	// Stdout, if set, must equal the container's trimmed output.
+	Stdout string
+
+	// Timeout bounds the run; it defaults to 5 minutes.
+	Timeout time.Duration
+}
+
+// containerTracker names the containers a test starts so that their logs
+// can be collected if the test fails. Containers are removed by Cleanup,
+// so commands run through the tracker should not use `docker run --rm`.
+type containerTracker struct {
+	c cluster.TestCluster
+
+	// client is the docker client RunAndCheck uses, "docker" by
+	// default; tests of other client versions set it to their path.
+	client string
+
+	mu         sync.Mutex
+	containers []trackedContainer
+}
+
+type trackedContainer struct {
+	m    platform.Machine
+	name string
+}
+
+// trackContainers returns a containerTracker for the test c. Callers should
+// defer its Cleanup method.
+func trackContainers(c cluster.TestCluster) *containerTracker {
+	return &containerTracker{c: c, client: "docker"}
+}
+
+// track records a new container on m and returns the name to start it
+// with.
+func (t *containerTracker) track(m platform.Machine) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	name := fmt.Sprintf("kola-%d", len(t.containers))
+	t.containers = append(t.containers, trackedContainer{m: m, name: name})
+	return name
+}
+
+// SSH runs cmd on m like TestCluster.SSH, naming the container started by
+// the `docker run` in cmd so its logs can be fetched later.
+func (t *containerTracker) SSH(m platform.Machine, cmd string) ([]byte, error) {
+	if !strings.Contains(cmd, "docker run ") {
+		return nil, fmt.Errorf("no docker run in command %q", cmd)
+	}
+
+	cmd = strings.Replace(cmd, "docker run ", "docker run --name="+t.track(m)+" ", 1)
+	return t.c.SSH(m, cmd)
+}
+
+// Cleanup logs the output of every tracked container if the test has
+// failed, and then removes the containers. A container that cannot be
+// removed fails the test, since it would be left running for later tests
+// on the same machine.
+func (t *containerTracker) Cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, ctr := range t.containers {
+		if t.c.Failed() {
+			out, stderr, err := ctr.m.SSH("docker logs " + ctr.name)
+			if err != nil {
+				t.c.Logf("docker logs %s on %s failed: %v: %s", ctr.name, ctr.m.ID(), err, stderr)
+			} else {
+				t.c.Logf("docker logs %s on %s:\n%s\n%s", ctr.name, ctr.m.ID(), out, stderr)
+			}
+		}
+		if _, stderr, err := ctr.m.SSH("docker rm -f " + ctr.name); err != nil {
+			t.c.Errorf("docker rm -f %s on %s failed: %v: %s", ctr.name, ctr.m.ID(), err, stderr)
+		}
+	}
+	t.containers = nil
+}
+
+// RunAndCheck runs `docker run` with runArgs on m, tracking the container,
+// and checks the result against expect. It returns the container's output.
+func (t *containerTracker) RunAndCheck(m platform.Machine, runArgs []string, expect ContainerExpectation) ([]byte, error) {
+	return t.RunAndCheckWithInput(m, nil, runArgs, expect)
+}
+
+// RunAndCheckWithInput is like RunAndCheck, but connects stdin to the
+// container's standard input, which runArgs must request with -i.
+func (t *containerTracker) RunAndCheckWithInput(m platform.Machine, stdin io.Reader, runArgs []string, expect ContainerExpectation) ([]byte, error) {
+	timeout := expect.Timeout
+	if timeout == 0 {
+		timeout = defaultContainerTimeout
+	}
+
+	quoted := make([]string, len(runArgs))
+	for i, arg := range runArgs {
+		quoted[i] = platform.ShellQuote(arg)
+	}
+	cmd := fmt.Sprintf("timeout %d %s run --name=%s %s", int(timeout.Seconds()), t.client, t.track(m), strings.Join(quoted, " "))
+
+	var output []byte
+	var err error
+	if stdin != nil {
+		output, err = t.c.RunWithInput(m, cmd, stdin)
+	} else {
+		output, err = t.c.SSH(m, cmd)
+	}
+	status := 0
+	if err != nil {
+		var ok bool
+		if status, ok = platform.ExitStatus(err); !ok {
+			return output, fmt.Errorf("failed to run %q: %v", cmd, err)
+		}
+	}
+	if status == timeoutExitStatus && expect.ExitCode != timeoutExitStatus {
+		return output, fmt.Errorf("%q did not finish within %v: output: %q", cmd, timeout, output)
+	}
+	if status != expect.ExitCode {
+		return output, fmt.Errorf("%q exited with status %d, expected %d: output: %q", cmd, status, expect.ExitCode, output)
+	}
+	if expect.Stdout != "" && string(output) != expect.Stdout {
+		return output, fmt.Errorf("%q output %q, expected %q", cmd, output, expect.Stdout)
+	}
+	return output, nil
+}
@@ -15,16 +15,14 @@
 package docker
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
-	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"golang.org/x/crypto/ssh"
 	"golang.org/x/net/context"
 
 	"github.com/coreos/go-semver/semver"
@@ -37,24 +35,6 @@ import (
 	"github.com/coreos/mantle/util"
 )
 
-type simplifiedDockerInfo struct {
-	ServerVersion string
-	Driver        string
-	CgroupDriver  string
-	Runtimes      map[string]struct {
-		Path string `json:"path"`
-	}
-	ContainerdCommit struct {
-		ID       string
-		Expected string
-	}
-	RuncCommit struct {
-		ID       string
-		Expected string
-	}
-	SecurityOptions []string
-}
-
 func init() {
 	register.Register(&register.Test{
 		Run:         dockerNetwork,
@@ -76,11 +56,6 @@ systemd:
   units:
   - name: docker.service
     enable: true
-    dropins:
-      - name: 10-userns.conf
-        contents: |-
-          [Service]
-          Environment=DOCKER_OPTS=--userns-remap=dockremap
 storage:
   files:
   - filesystem: root
@@ -93,7 +68,9 @@ storage:
       inline: "dockremap:100000:65536"
 passwd:
   users:
-  - name: dockremap`),
+  - name: dockremap`).WithUnitEnvironment("docker.service", map[string]string{
+			"DOCKER_OPTS": "--userns-remap=dockremap",
+		}),
 	})
 
 	// This test covers all functionality that should be quick to run and can be
@@ -106,13 +83,19 @@ passwd:
 	// 'dockerBaseTests' implementation
 	// The primary goal of using subtests here is to make things quicker to run.
 	register.Register(&register.Test{
-		Run:         dockerBaseTests,
-		ClusterSize: 1,
-		Name:        `docker.base`,
+		Run:          dockerBaseTests,
+		ClusterSetup: dockerBaseSetup,
+		ClusterSize:  1,
+		Name:         `docker.base`,
+		Smoke:        true,
 	})
 
 	register.Register(&register.Test{
-		Run:         func(c cluster.TestCluster) { testDockerInfo("btrfs", c) },
+		Run: func(c cluster.TestCluster) {
+			// loop is a mount(8) option and not listed in /proc/mounts
+			c.AssertMount(c.Machines()[0], "/var/lib/docker", "btrfs", "discard")
+			testDockerInfo("btrfs", c)
+		},
 		ClusterSize: 1,
 		Name:        "docker.btrfs-storage",
 		// Note: copied verbatim from https://github.com/coreos/docs/blob/master/os/mounting-storage.md#creating-and-mounting-a-btrfs-volume-file
@@ -152,9 +135,10 @@ systemd:
 		// docker systemd unit.
 		// This test verifies backwards compatibility with that unit to ensure
 		// users who copied it into /etc aren't broken.
-		Name:        "docker.lib-coreos-dockerd-compat",
-		Run:         dockerBaseTests,
-		ClusterSize: 1,
+		Name:         "docker.lib-coreos-dockerd-compat",
+		Run:          dockerBaseTests,
+		ClusterSetup: dockerBaseSetup,
+		ClusterSize:  1,
 		UserData: conf.ContainerLinuxConfig(`
 systemd:
   units:
@@ -204,15 +188,97 @@ systemd:
 	})
 }
 
+// dockerImageSpec describes a docker image for buildDockerImage to build
+// on a machine.
+type dockerImageSpec struct {
+	// Base is the image to build from, scratch if empty.
+	Base string
+	// Binaries are host binaries to copy into the image along with the
+	// libraries they link against.
+	Binaries []string
+	// Run are commands to run while building the image, such as
+	// installing packages with the base image's package manager.
+	Run []string
+	// Dockerfile, if set, is used instead of one generated from the
+	// fields above. Binaries are still copied into the build context,
+	// under rootfs/.
+	Dockerfile string
+}
+
+// dockerfile returns the Dockerfile to build s with.
+func (s dockerImageSpec) dockerfile() string {
+	if s.Dockerfile != "" {
+		return s.Dockerfile
+	}
+
+	base := s.Base
+	if base == "" {
+		base = "scratch"
+	}
+	lines := []string{"FROM " + base}
+	if len(s.Binaries) > 0 {
+		lines = append(lines, "COPY rootfs /")
+	}
+	for _, cmd := range s.Run {
+		lines = append(lines, "RUN "+cmd)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// buildDockerImage builds the docker image described by spec on m and
+// tags it name.
+func buildDockerImage(c cluster.TestCluster, m platform.Machine, name string, spec dockerImageSpec) {
+	tmpdir := strings.TrimSpace(string(c.MustSSH(m, "mktemp -d")))
+	defer c.SSH(m, "sudo rm -rf "+tmpdir)
+
+	if output, err := c.RunWithInput(m, fmt.Sprintf("cat > %s/Dockerfile", tmpdir), strings.NewReader(spec.dockerfile())); err != nil {
+		c.Fatalf("failed to write %s Dockerfile: output: %q status: %q", name, output, err)
+	}
+
+	if len(spec.Binaries) > 0 {
+		cmd := `mkdir %s/rootfs && cd %s/rootfs;
+		        b=$(which %s); libs=$(sudo ldd $b | grep -o /lib'[^ ]*' | sort -u);
+		        sudo rsync -av --relative --copy-links $b $libs ./`
+		if output, err := c.SSH(m, fmt.Sprintf(cmd, tmpdir, tmpdir, strings.Join(spec.Binaries, " "))); err != nil {
+			c.Fatalf("failed to copy binaries into %s container: output: %q status: %q", name, output, err)
+		}
+	}
+
+	if output, err := c.SSH(m, fmt.Sprintf("sudo docker build -t %s %s", name, tmpdir)); err != nil {
+		c.Fatalf("failed to make %s container: output: %q status: %q", name, output, err)
+	}
+}
+
 // make a docker container out of binaries on the host
 func genDockerContainer(c cluster.TestCluster, m platform.Machine, name string, binnames []string) {
-	cmd := `tmpdir=$(mktemp -d); cd $tmpdir; echo -e "FROM scratch\nCOPY . /" > Dockerfile;
-	        b=$(which %s); libs=$(sudo ldd $b | grep -o /lib'[^ ]*' | sort -u);
-	        sudo rsync -av --relative --copy-links $b $libs ./;
-	        sudo docker build -t %s .`
+	buildDockerImage(c, m, name, dockerImageSpec{Binaries: binnames})
+}
 
-	if output, err := c.SSH(m, fmt.Sprintf(cmd, strings.Join(binnames, " "), name)); err != nil {
-		c.Fatalf("failed to make %s container: output: %q status: %q", name, output, err)
+// ensureDockerContainer makes a docker container out of binaries on the
+// host like genDockerContainer, unless an image named name already
+// exists, such as one built by dockerBaseSetup.
+func ensureDockerContainer(c cluster.TestCluster, m platform.Machine, name string, binnames []string) {
+	if _, err := c.SSH(m, fmt.Sprintf("docker image inspect %s >/dev/null", name)); err == nil {
+		return
+	}
+	genDockerContainer(c, m, name, binnames)
+}
+
+// dockerBaseContainers are the containers the dockerBaseTests subtests
+// use, by name.
+var dockerBaseContainers = map[string][]string{
+	"sleep":   {"sleep"},
+	"ping":    {"sh", "ping"},
+	"captest": {"capsh", "sh", "grep", "cat", "ls"},
+}
+
+// dockerBaseSetup builds the containers of dockerBaseTests once, so its
+// subtests don't each wait on docker build.
+func dockerBaseSetup(c cluster.TestCluster) {
+	for _, m := range c.Machines() {
+		for name, binnames := range dockerBaseContainers {
+			genDockerContainer(c, m, name, binnames)
+		}
 	}
 }
 
@@ -223,6 +289,23 @@ func dockerBaseTests(c cluster.TestCluster) {
 	c.Run("resources", dockerResources)
 	c.Run("networks-reliably", dockerNetworksReliably)
 	c.Run("user-no-caps", dockerUserNoCaps)
+	c.Run("single-layer", dockerSingleLayer)
+}
+
+// dockerSingleLayer checks that the containers built from host binaries,
+// with a single COPY onto scratch, have a single layer.
+func dockerSingleLayer(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	for name := range dockerBaseContainers {
+		info, err := InspectImage(m, name)
+		if err != nil {
+			c.Fatal(err)
+		}
+		if len(info.RootFS.Layers) != 1 {
+			c.Errorf("%s image has %d layers, expected 1: %v", name, len(info.RootFS.Layers), info.RootFS.Layers)
+		}
+	}
 }
 
 // using a simple container, exercise various docker options that set resource
@@ -231,19 +314,20 @@ func dockerBaseTests(c cluster.TestCluster) {
 func dockerResources(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "sleep", []string{"sleep"})
+	ensureDockerContainer(c, m, "sleep", dockerBaseContainers["sleep"])
 
-	dockerFmt := "docker run --rm %s sleep sleep 0.2"
+	containers := trackContainers(c)
+	defer containers.Cleanup()
 
-	dCmd := func(arg string) string {
-		return fmt.Sprintf(dockerFmt, arg)
+	dCmd := func(arg string) []string {
+		return append(strings.Fields(arg), "sleep", "sleep", "0.2")
 	}
 
 	ctx := context.Background()
 	wg := worker.NewWorkerGroup(ctx, 10)
 
 	// ref https://docs.docker.com/engine/reference/run/#runtime-constraints-on-resources
-	for _, dockerCmd := range []string{
+	for _, dockerArgs := range [][]string{
 		// must set memory when setting memory-swap
 		dCmd("--memory=10m --memory-swap=10m"),
 		dCmd("--memory-reservation=10m"),
@@ -266,15 +350,12 @@ func dockerResources(c cluster.TestCluster) {
 		dCmd("--shm-size=1m"),
 	} {
 		// lol closures
-		cmd := dockerCmd
+		args := dockerArgs
 
 		worker := func(ctx context.Context) error {
 			// TODO: pass context thru to SSH
-			output, err := c.SSH(m, cmd)
-			if err != nil {
-				return fmt.Errorf("failed to run %q: output: %q status: %q", cmd, output, err)
-			}
-			return nil
+			_, err := containers.RunAndCheck(m, args, ContainerExpectation{})
+			return err
 		}
 
 		if err := wg.Start(worker); err != nil {
@@ -297,20 +378,15 @@ func dockerNetwork(c cluster.TestCluster) {
 	genDockerContainer(c, src, "ncat", []string{"ncat"})
 	genDockerContainer(c, dest, "ncat", []string{"ncat"})
 
+	containers := trackContainers(c)
+	defer containers.Cleanup()
+
 	listener := func(ctx context.Context) error {
 		// Will block until a message is recieved
-		out, err := c.SSH(dest,
-			`echo "HELLO FROM SERVER" | docker run -i -p 9988:9988 ncat ncat --idle-timeout 20 --listen 0.0.0.0 9988`,
-		)
-		if err != nil {
-			return err
-		}
-
-		if !bytes.Equal(out, []byte("HELLO FROM CLIENT")) {
-			return fmt.Errorf("unexpected result from listener: %q", out)
-		}
-
-		return nil
+		_, err := containers.RunAndCheckWithInput(dest, strings.NewReader("HELLO FROM SERVER\n"),
+			[]string{"-i", "-p", "9988:9988", "ncat", "ncat", "--idle-timeout", "20", "--listen", "0.0.0.0", "9988"},
+			ContainerExpectation{Stdout: "HELLO FROM CLIENT", Timeout: time.Minute})
+		return err
 	}
 
 	talker := func(ctx context.Context) error {
@@ -321,8 +397,7 @@ func dockerNetwork(c cluster.TestCluster) {
 				break // socket is ready
 			}
 
-			exit, ok := err.(*ssh.ExitError)
-			if !ok || exit.Waitmsg.ExitStatus() != 1 { // 1 is the expected exit of grep -q
+			if status, ok := platform.ExitStatus(err); !ok || status != 1 { // 1 is the expected exit of grep -q
 				return err
 			}
 
@@ -334,17 +409,10 @@ func dockerNetwork(c cluster.TestCluster) {
 			}
 		}
 
-		srcCmd := fmt.Sprintf(`echo "HELLO FROM CLIENT" | docker run -i ncat ncat %s 9988`, dest.PrivateIP())
-		out, err := c.SSH(src, srcCmd)
-		if err != nil {
-			return err
-		}
-
-		if !bytes.Equal(out, []byte("HELLO FROM SERVER")) {
-			return fmt.Errorf(`unexpected result from listener: "%v"`, out)
-		}
-
-		return nil
+		_, err := containers.RunAndCheckWithInput(src, strings.NewReader("HELLO FROM CLIENT\n"),
+			[]string{"-i", "ncat", "ncat", dest.PrivateIP(), "9988"},
+			ContainerExpectation{Stdout: "HELLO FROM SERVER", Timeout: time.Minute})
+		return err
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
@@ -355,29 +423,77 @@ func dockerNetwork(c cluster.TestCluster) {
 	}
 }
 
+// oldClientsDir holds the old docker clients run by docker.oldclient.
+const oldClientsDir = "/usr/lib/kola/amd64"
+
 // Regression test for https://github.com/coreos/bugs/issues/1569 and
 // https://github.com/coreos/docker/pull/31
+//
+// Every old client binary installed as oldClientsDir/docker-<version> is
+// checked against the daemon.
 func dockerOldClient(c cluster.TestCluster) {
-	oldclient := "/usr/lib/kola/amd64/docker-1.9.1"
-	if _, err := os.Stat(oldclient); err != nil {
-		c.Skipf("Can't find old docker client to test: %v", err)
+	oldclients, err := filepath.Glob(filepath.Join(oldClientsDir, "docker-*"))
+	if err != nil {
+		c.Fatal(err)
+	}
+	if len(oldclients) == 0 {
+		c.Skipf("Can't find old docker clients to test in %s", oldClientsDir)
 	}
 
 	m, err := c.NewMachine(nil)
 	if err != nil {
 		c.Fatal(err)
 	}
-	c.DropFile(oldclient)
 
 	genDockerContainer(c, m, "echo", []string{"echo"})
 
-	output, err := c.SSH(m, "/home/core/docker-1.9.1 run echo echo 'IT WORKED'")
+	for _, oldclient := range oldclients {
+		oldclient := oldclient
+		name := filepath.Base(oldclient)
+		c.Run(name, func(c cluster.TestCluster) {
+			if err := c.DropFile(oldclient); err != nil {
+				c.Fatal(err)
+			}
+			testOldClient(c, m, "/home/core/"+name, strings.TrimPrefix(name, "docker-"))
+		})
+	}
+}
+
+// testOldClient checks that the docker client at path, which should be
+// the given version, negotiates an API version with the daemon on m and
+// can run containers.
+func testOldClient(c cluster.TestCluster, m platform.Machine, path, version string) {
+	v, err := GetDockerVersion(m, path)
 	if err != nil {
-		c.Fatalf("failed to run old docker client: %q status: %q", output, err)
+		c.Fatal(err)
+	}
+	if want, err := semver.NewVersion(version); err != nil {
+		c.Fatalf("invalid client version in file name: %v", err)
+	} else if got, err := semver.NewVersion(v.Client.Version); err != nil {
+		c.Fatalf("client reported invalid version %q: %v", v.Client.Version, err)
+	} else if !got.Equal(*want) {
+		c.Fatalf("client reported version %v, expected %v", got, want)
 	}
 
-	if !bytes.Equal(output, []byte("IT WORKED")) {
-		c.Fatalf("unexpected result from docker client: %q", output)
+	// the daemon must accept the old client's API version
+	if cmp, err := compareAPIVersions(v.Client.APIVersion, v.Server.APIVersion); err != nil {
+		c.Fatal(err)
+	} else if cmp > 0 {
+		c.Fatalf("client API %s is newer than daemon API %s", v.Client.APIVersion, v.Server.APIVersion)
+	}
+	if v.Server.MinAPIVersion != "" {
+		if cmp, err := compareAPIVersions(v.Client.APIVersion, v.Server.MinAPIVersion); err != nil {
+			c.Fatal(err)
+		} else if cmp < 0 {
+			c.Fatalf("client API %s is older than daemon minimum API %s", v.Client.APIVersion, v.Server.MinAPIVersion)
+		}
+	}
+
+	containers := trackContainers(c)
+	containers.client = path
+	defer containers.Cleanup()
+	if _, err := containers.RunAndCheck(m, []string{"echo", "echo", "IT WORKED"}, ContainerExpectation{Stdout: "IT WORKED"}); err != nil {
+		c.Fatalf("failed to run old docker client: %v", err)
 	}
 }
 
@@ -385,40 +501,64 @@ func dockerOldClient(c cluster.TestCluster) {
 func dockerUserns(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
+	c.AssertDropin(m, "docker.service", "10-kola-environment.conf", "[Service]\nEnvironment=\"DOCKER_OPTS=--userns-remap=dockremap\"\n")
+
 	genDockerContainer(c, m, "userns-test", []string{"echo", "sleep"})
 
+	containers := trackContainers(c)
+	defer containers.Cleanup()
+
 	_, err := c.SSH(m, `sudo setenforce 1`)
 	if err != nil {
 		c.Fatalf("could not enable selinux")
 	}
-	output, err := c.SSH(m, `docker run userns-test echo fj.fj`)
-	if err != nil {
-		c.Fatalf("failed to run echo under userns: output: %q status: %q", output, err)
-	}
-	if !bytes.Equal(output, []byte("fj.fj")) {
-		c.Fatalf("expected fj.fj, got %s", string(output))
+	c.AssertSELinuxMode(m, platform.SELinuxEnforcing)
+	if _, err := containers.RunAndCheck(m, []string{"userns-test", "echo", "fj.fj"}, ContainerExpectation{Stdout: "fj.fj"}); err != nil {
+		c.Fatalf("failed to run echo under userns: %v", err)
 	}
 
 	// And just in case, verify that a container really is userns remapped
-	_, err = c.SSH(m, `docker run -d --name=sleepy userns-test sleep 10000`)
+	id, err := c.SSH(m, `docker run -d --name=sleepy userns-test sleep 10000`)
 	if err != nil {
 		c.Fatalf("could not run sleep: %v", err)
 	}
-	uid_map, err := c.SSH(m, `until [[ "$(docker inspect -f {{.State.Running}} sleepy)" == "true" ]]; do sleep 0.1; done;
-		pid=$(docker inspect -f {{.State.Pid}} sleepy);
-		cat /proc/$pid/uid_map; docker kill sleepy &>/dev/null`)
+	defer c.SSH(m, `docker kill sleepy`)
+	out, err := c.SSH(m, `until [[ "$(docker inspect -f {{.State.Running}} sleepy)" == "true" ]]; do sleep 0.1; done;
+		docker inspect -f {{.State.Pid}} sleepy`)
+	if err != nil {
+		c.Fatalf("could not find sleep process: %v", err)
+	}
+	pid, err := strconv.Atoi(string(out))
+	if err != nil {
+		c.Fatalf("bad pid %q: %v", out, err)
+	}
+
+	uidMap, err := platform.UIDMap(m, pid)
 	if err != nil {
-		c.Fatalf("could not read uid mapping: %v", err)
+		c.Fatal(err)
+	}
+	if len(uidMap) != 1 || uidMap[0] != (platform.IDMapping{Inside: 0, Outside: 100000, Length: 65536}) {
+		c.Fatalf("unexpected userns mapping values: %+v", uidMap)
+	}
+
+	// root in the container is the remapped uid outside of it, and the
+	// process is in the container's cgroup
+	proc, err := platform.FindProcess(m, pid)
+	if err != nil {
+		c.Fatal(err)
 	}
-	// uid_map is of the form `$mappedNamespacePidStart   $realNamespacePidStart
-	// $rangeLength`. We expect `0     100000      65536`
-	mapParts := strings.Fields(strings.TrimSpace(string(uid_map)))
-	if len(mapParts) != 3 {
-		c.Fatalf("expected uid_map to have three parts, was: %s", string(uid_map))
+	if proc.UID != 100000 {
+		c.Fatalf("container process runs as uid %d, expected 100000", proc.UID)
 	}
-	if mapParts[0] != "0" && mapParts[1] != "100000" {
-		c.Fatalf("unexpected userns mapping values: %v", string(uid_map))
+	var inContainerCgroup bool
+	for _, cg := range proc.Cgroups {
+		inContainerCgroup = inContainerCgroup || strings.Contains(cg, string(id))
 	}
+	if !inContainerCgroup {
+		c.Fatalf("container process is not in a cgroup of container %s: %v", id, proc.Cgroups)
+	}
+
+	c.AssertNoSELinuxDenials(m)
 }
 
 // Regression test for https://github.com/coreos/bugs/issues/1785
@@ -426,7 +566,7 @@ func dockerUserns(c cluster.TestCluster) {
 func dockerNetworksReliably(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "ping", []string{"sh", "ping"})
+	ensureDockerContainer(c, m, "ping", dockerBaseContainers["ping"])
 
 	output, err := c.SSH(m, `for i in $(seq 1 100); do 
 		echo -n "$i: "
@@ -454,19 +594,21 @@ func dockerNetworksReliably(c cluster.TestCluster) {
 func dockerUserNoCaps(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	genDockerContainer(c, m, "captest", []string{"capsh", "sh", "grep", "cat", "ls"})
+	ensureDockerContainer(c, m, "captest", dockerBaseContainers["captest"])
 
-	output, err := c.SSH(m, `docker run --user 1000:1000 \
-		-v /root:/root \
+	containers := trackContainers(c)
+	defer containers.Cleanup()
+
+	output, err := containers.SSH(m, `docker run --user 1000:1000 \
 		captest sh -c \
-		'cat /proc/self/status | grep -E "Cap(Eff|Prm)"; ls /root &>/dev/null && echo "FAIL: could read root" || echo "PASS: err reading root"'`)
+		'cat /proc/self/status | grep -E "Cap(Eff|Prm)"'`)
 	if err != nil {
 		c.Fatalf("could not run container (we weren't even testing for that): %v: %q", err, string(output))
 	}
 
 	outputlines := strings.Split(string(output), "\n")
-	if len(outputlines) < 3 {
-		c.Fatalf("expected two lines of caps and an an error/succcess line. Got %q", string(output))
+	if len(outputlines) < 2 {
+		c.Fatalf("expected two lines of caps. Got %q", string(output))
 	}
 	cap1, cap2 := strings.Fields(outputlines[0]), strings.Fields(outputlines[1])
 	// The format of capabilities in /proc/*/status is e.g.: CapPrm:\t0000000000000000
@@ -478,10 +620,9 @@ func dockerUserNoCaps(c cluster.TestCluster) {
 		c.Fatalf("Permitted / effective capabilities were non-zero: %q", string(output))
 	}
 
-	// Finally, check for fail/success on reading /root
-	if !strings.HasPrefix(outputlines[len(outputlines)-1], "PASS: ") {
-		c.Fatalf("reading /root test failed: %q", string(output))
-	}
+	// Finally, check that the user can't read /root; ls exits 2 when it
+	// can't open a directory
+	c.AssertCmdFails(m, "docker run --rm --user 1000:1000 -v /root:/root captest ls /root", 2)
 }
 
 // dockerContainerdRestart ensures containerd will restart if it dies. It tests that containerd is running,
@@ -537,7 +678,7 @@ func dockerContainerdRestart(c cluster.TestCluster) {
 func testContainerdUp(c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	info, err := getDockerInfo(c, m)
+	info, err := GetDockerInfo(m)
 	if err != nil {
 		c.Fatal(err)
 	}
@@ -547,29 +688,13 @@ func testContainerdUp(c cluster.TestCluster) {
 	}
 }
 
-func getDockerInfo(c cluster.TestCluster, m platform.Machine) (simplifiedDockerInfo, error) {
-	dockerInfoJson, err := c.SSH(m, `curl -s --unix-socket /var/run/docker.sock http://docker/v1.24/info`)
-	if err != nil {
-		return simplifiedDockerInfo{}, fmt.Errorf("could not get dockerinfo: %v", err)
-	}
-
-	target := simplifiedDockerInfo{}
-
-	err = json.Unmarshal(dockerInfoJson, &target)
-	if err != nil {
-		return simplifiedDockerInfo{}, fmt.Errorf("could not unmarshal dockerInfo %q into known json: %v", string(dockerInfoJson), err)
-	}
-
-	return target, nil
-}
-
 // testDockerInfo test that docker info's output is as expected.  the expected
 // filesystem may be asserted as one of 'overlay', 'btrfs', 'devicemapper'
 // depending on how the machine was launched.
 func testDockerInfo(expectedFs string, c cluster.TestCluster) {
 	m := c.Machines()[0]
 
-	info, err := getDockerInfo(c, m)
+	info, err := GetDockerInfo(m)
 	if err != nil {
 		c.Fatal(err)
 	}
@@ -0,0 +1,61 @@
+// Copyright 2016 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"testing"
+)
+
+func TestDockerfile(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		spec       dockerImageSpec
+		dockerfile string
+	}{
+		{
+			name:       "empty",
+			spec:       dockerImageSpec{},
+			dockerfile: "FROM scratch\n",
+		},
+		{
+			name:       "binaries",
+			spec:       dockerImageSpec{Binaries: []string{"sleep"}},
+			dockerfile: "FROM scratch\nCOPY rootfs /\n",
+		},
+		{
+			name: "base and run",
+			spec: dockerImageSpec{
+				Base:     "alpine:3.6",
+				Binaries: []string{"ncat"},
+				Run:      []string{"apk add --no-cache iproute2", "ip -V"},
+			},
+			dockerfile: "FROM alpine:3.6\nCOPY rootfs /\nRUN apk add --no-cache iproute2\nRUN ip -V\n",
+		},
+		{
+			name: "dockerfile",
+			spec: dockerImageSpec{
+				Base:       "ignored",
+				Binaries:   []string{"sleep"},
+				Run:        []string{"ignored"},
+				Dockerfile: "FROM busybox\nCOPY rootfs/usr /usr\n",
+			},
+			dockerfile: "FROM busybox\nCOPY rootfs/usr /usr\n",
+		},
+	} {
+		if dockerfile := tt.spec.dockerfile(); dockerfile != tt.dockerfile {
+			t.Errorf("%s: got Dockerfile %q, expected %q", tt.name, dockerfile, tt.dockerfile)
+		}
+	}
+}
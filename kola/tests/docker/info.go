@@ -0,0 +1,170 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/mantle/platform"
+)
+
+// DockerInfo is the subset of the docker daemon's /info API response which
+// tests assert on.
+type DockerInfo struct {
+	ID              string
+	ServerVersion   string
+	OperatingSystem string
+	KernelVersion   string
+	Architecture    string
+	Driver          string
+	DriverStatus    [][2]string
+	CgroupDriver    string
+	LoggingDriver   string
+	DockerRootDir   string
+	DefaultRuntime  string
+	Runtimes        map[string]struct {
+		Path string `json:"path"`
+	}
+	Plugins struct {
+		Volume        []string
+		Network       []string
+		Authorization []string
+		Log           []string
+	}
+	Swarm struct {
+		NodeID           string
+		LocalNodeState   string
+		ControlAvailable bool
+	}
+	ContainerdCommit struct {
+		ID       string
+		Expected string
+	}
+	RuncCommit struct {
+		ID       string
+		Expected string
+	}
+	InitCommit struct {
+		ID       string
+		Expected string
+	}
+	SecurityOptions []string
+	Containers      int
+	Images          int
+}
+
+// GetDockerInfo queries the docker daemon on m over its socket and returns
+// the parsed result.
+func GetDockerInfo(m platform.Machine) (*DockerInfo, error) {
+	var info DockerInfo
+	if err := platform.SSHJSON(m, `curl -s --unix-socket /var/run/docker.sock http://docker/v1.24/info`, &info); err != nil {
+		return nil, fmt.Errorf("could not get docker info: %v", err)
+	}
+
+	return &info, nil
+}
+
+// ImageInfo is the subset of docker's image inspection output which tests
+// assert on.
+type ImageInfo struct {
+	ID           string `json:"Id"`
+	RepoTags     []string
+	RepoDigests  []string
+	Created      string
+	Size         int64
+	Architecture string
+	Os           string
+	Config       struct {
+		Env        []string
+		Cmd        []string
+		Entrypoint []string
+		Labels     map[string]string
+	}
+	RootFS struct {
+		Type   string
+		Layers []string
+	}
+}
+
+// InspectImage runs docker inspect on m for the given image and returns
+// the parsed result.
+func InspectImage(m platform.Machine, image string) (*ImageInfo, error) {
+	var infos []ImageInfo
+	if err := platform.SSHJSON(m, fmt.Sprintf("docker inspect --type=image %s", image), &infos); err != nil {
+		return nil, fmt.Errorf("could not inspect image %s: %v", image, err)
+	}
+	if len(infos) != 1 {
+		return nil, fmt.Errorf("expected one image named %s, got %d", image, len(infos))
+	}
+
+	return &infos[0], nil
+}
+
+// DockerVersion is the output of `docker version`, describing both the
+// client and the daemon it talked to.
+type DockerVersion struct {
+	Client DockerVersionInfo
+	Server DockerVersionInfo
+}
+
+// DockerVersionInfo describes one side of a docker client/daemon pair.
+type DockerVersionInfo struct {
+	Version       string
+	APIVersion    string `json:"ApiVersion"`
+	MinAPIVersion string `json:"MinAPIVersion"`
+	GitCommit     string
+	GoVersion     string
+	Os            string
+	Arch          string
+}
+
+// GetDockerVersion runs `version` with the given docker client binary on m
+// and returns the parsed result.
+func GetDockerVersion(m platform.Machine, client string) (*DockerVersion, error) {
+	var version DockerVersion
+	if err := platform.SSHJSON(m, fmt.Sprintf("%s version --format '{{json .}}'", client), &version); err != nil {
+		return nil, fmt.Errorf("could not get docker version from %s: %v", client, err)
+	}
+
+	return &version, nil
+}
+
+// compareAPIVersions compares docker API versions such as "1.24", returning
+// -1, 0, or 1 as a is older than, the same as, or newer than b.
+func compareAPIVersions(a, b string) (int, error) {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var an, bn int
+		var err error
+		if i < len(as) {
+			if an, err = strconv.Atoi(as[i]); err != nil {
+				return 0, fmt.Errorf("invalid API version %q", a)
+			}
+		}
+		if i < len(bs) {
+			if bn, err = strconv.Atoi(bs[i]); err != nil {
+				return 0, fmt.Errorf("invalid API version %q", b)
+			}
+		}
+		if an < bn {
+			return -1, nil
+		} else if an > bn {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,65 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/conf"
+	"github.com/coreos/mantle/platform/machine/qemu"
+)
+
+var remoteConfig = conf.Ignition(`{
+		          "ignition": {
+		              "version": "2.0.0"
+		          },
+		          "storage": {
+		              "files": [
+		                  {
+		                      "filesystem": "root",
+		                      "path": "/etc/remote-config",
+		                      "mode": 420,
+		                      "contents": {
+		                          "source": "data:,fetched"
+		                      }
+		                  }
+		              ]
+		          }
+		      }`)
+
+func init() {
+	register.Register(&register.Test{
+		Name:        "coreos.ignition.v2.remote",
+		Run:         remoteFetch,
+		ClusterSize: 0,
+		Platforms:   []string{"qemu"},
+	})
+}
+
+// remoteFetch boots a machine whose config is fetched over HTTP through a
+// config.replace pointer rather than passed in directly.
+func remoteFetch(c cluster.TestCluster) {
+	m, err := c.Cluster.(*qemu.Cluster).NewMachineWithOptions(remoteConfig, qemu.MachineOptions{
+		ServeIgnition: true,
+	})
+	if err != nil {
+		c.Fatalf("Cluster.NewMachineWithOptions: %v", err)
+	}
+
+	out := c.MustSSH(m, "cat /etc/remote-config")
+	if string(out) != "fetched" {
+		c.Fatalf("/etc/remote-config: expected %q, got %q", "fetched", out)
+	}
+}
@@ -21,12 +21,10 @@ import (
 	"time"
 
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/net/context"
 
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
 	"github.com/coreos/mantle/kola/tests/etcd"
-	"github.com/coreos/mantle/lang/worker"
 	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/platform/conf"
 	"github.com/coreos/mantle/util"
@@ -155,32 +153,22 @@ func locksmithCluster(c cluster.TestCluster) {
 		c.Fatalf("locksmithctl status: %q: %v", output, err)
 	}
 
-	ctx := context.Background()
-	wg := worker.NewWorkerGroup(ctx, len(machs))
-
 	// reboot all the things
-	for _, m := range machs {
-		worker := func(ctx context.Context) error {
-			cmd := "sudo systemctl stop sshd.socket && sudo locksmithctl send-need-reboot"
-			output, err := c.SSH(m, cmd)
-			if _, ok := err.(*ssh.ExitMissingError); ok {
-				err = nil // A terminated session is perfectly normal during reboot.
-			} else if err == io.EOF {
-				err = nil // Sometimes copying command output returns EOF here.
-			}
-			if err != nil {
-				return fmt.Errorf("failed to run %q: output: %q status: %q", cmd, output, err)
-			}
-
-			return platform.CheckMachine(m)
+	err = c.ForEachMachine(func(m platform.Machine) error {
+		cmd := "sudo systemctl stop sshd.socket && sudo locksmithctl send-need-reboot"
+		output, err := c.SSH(m, cmd)
+		if _, ok := err.(*ssh.ExitMissingError); ok {
+			err = nil // A terminated session is perfectly normal during reboot.
+		} else if err == io.EOF {
+			err = nil // Sometimes copying command output returns EOF here.
 		}
-
-		if err := wg.Start(worker); err != nil {
-			c.Fatal(wg.WaitError(err))
+		if err != nil {
+			return fmt.Errorf("failed to run %q: output: %q status: %q", cmd, output, err)
 		}
-	}
 
-	if err := wg.Wait(); err != nil {
+		return platform.CheckMachine(m)
+	})
+	if err != nil {
 		c.Fatal(err)
 	}
 }
@@ -0,0 +1,50 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ignition
+
+import (
+	"fmt"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+)
+
+var instanceMetadata = map[string]string{
+	"kola-test-key": "kola-test-value",
+}
+
+func init() {
+	register.Register(&register.Test{
+		Name:             "coreos.metadata.gce.attributes",
+		Run:              verifyGCEAttributes,
+		ClusterSize:      1,
+		Platforms:        []string{"gce"},
+		InstanceMetadata: instanceMetadata,
+	})
+}
+
+// verifyGCEAttributes checks that metadata set at launch can be read back
+// from the GCE metadata server.
+func verifyGCEAttributes(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	for key, value := range instanceMetadata {
+		cmd := fmt.Sprintf("curl -sf -H 'Metadata-Flavor: Google' http://metadata.google.internal/computeMetadata/v1/instance/attributes/%s", key)
+		out := c.MustSSH(m, cmd)
+		if string(out) != value {
+			c.Errorf("metadata %q: expected %q, got %q", key, value, out)
+		}
+	}
+}
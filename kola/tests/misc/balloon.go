@@ -0,0 +1,73 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/machine/qemu"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         Balloon,
+		ClusterSize: 0,
+		Platforms:   []string{"qemu"},
+		Name:        "coreos.qemu.balloon",
+	})
+}
+
+// Balloon checks that inflating a guest's memory balloon takes memory away
+// from the guest and deflating it gives the memory back, without a reboot.
+func Balloon(c cluster.TestCluster) {
+	qc := c.Cluster.(*qemu.Cluster)
+	m, err := qc.NewMachineWithOptions(nil, qemu.MachineOptions{
+		Balloon: true,
+	})
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	before, err := m.MemInfo()
+	if err != nil {
+		c.Fatal(err)
+	}
+	mib, err := qc.Memory(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	if err := qc.SetMemory(m, mib/2); err != nil {
+		c.Fatalf("inflating balloon: %v", err)
+	}
+	inflated, err := m.MemInfo()
+	if err != nil {
+		c.Fatal(err)
+	}
+	if inflated.Total > uint64(mib/2)<<20 {
+		c.Fatalf("guest has %d bytes of memory with the balloon inflated, expected at most %d", inflated.Total, uint64(mib/2)<<20)
+	}
+
+	if err := qc.SetMemory(m, mib); err != nil {
+		c.Fatalf("deflating balloon: %v", err)
+	}
+	deflated, err := m.MemInfo()
+	if err != nil {
+		c.Fatal(err)
+	}
+	if deflated.Total != before.Total {
+		c.Fatalf("guest has %d bytes of memory with the balloon deflated, expected %d", deflated.Total, before.Total)
+	}
+}
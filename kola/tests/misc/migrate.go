@@ -0,0 +1,68 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/machine/qemu"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         LiveMigrate,
+		ClusterSize: 1,
+		Platforms:   []string{"qemu"},
+		Name:        "coreos.qemu.migrate",
+	})
+}
+
+// LiveMigrate checks that a running guest survives a live migration to a
+// new QEMU process: SSH keeps working, the guest is not rebooted, and a
+// running process keeps making progress.
+func LiveMigrate(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	bootID := c.MustSSH(m, "cat /proc/sys/kernel/random/boot_id")
+	c.MustSSH(m, `sudo systemd-run --unit=counter sh -c 'i=0; while true; do echo $i > /tmp/counter; i=$((i+1)); sleep 1; done'`)
+
+	counter := func() int {
+		out := c.MustSSH(m, "cat /tmp/counter")
+		n, err := strconv.Atoi(string(out))
+		if err != nil {
+			c.Fatalf("parsing counter %q: %v", out, err)
+		}
+		return n
+	}
+
+	before := counter()
+
+	if err := c.Cluster.(*qemu.Cluster).MigrateMachine(m); err != nil {
+		c.Fatalf("MigrateMachine: %v", err)
+	}
+
+	if id := c.MustSSH(m, "cat /proc/sys/kernel/random/boot_id"); string(id) != string(bootID) {
+		c.Fatalf("machine rebooted during migration: boot id %q became %q", bootID, id)
+	}
+
+	after := counter()
+	c.Sleep(3 * time.Second)
+	if later := counter(); later <= after || after < before {
+		c.Fatalf("counter stopped making progress: %d, %d, %d", before, after, later)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         LoadModules,
+		ClusterSize: 1,
+		Name:        "coreos.kernel.modules",
+	})
+}
+
+// LoadModules verifies that the image ships modules which other features
+// rely on and that they can be loaded.
+func LoadModules(c cluster.TestCluster) {
+	m := c.Machines()[0]
+
+	for _, module := range []string{"overlay", "btrfs", "nf_conntrack"} {
+		if err := platform.LoadModule(m, module); err != nil {
+			c.Fatal(err)
+		}
+		c.AssertModuleLoaded(m, module)
+	}
+}
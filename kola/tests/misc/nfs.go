@@ -24,7 +24,6 @@ import (
 	"github.com/coreos/mantle/kola/cluster"
 	"github.com/coreos/mantle/kola/register"
 	"github.com/coreos/mantle/platform/conf"
-	"github.com/coreos/mantle/util"
 )
 
 var (
@@ -48,7 +47,7 @@ var (
 		WriteFiles: []config.File{
 			config.File{
 				Content: "/tmp	*(ro,insecure,all_squash,no_subtree_check,fsid=0)",
-				Path: "/etc/exports",
+				Path:    "/etc/exports",
 			},
 		},
 		Hostname: "nfs1",
@@ -122,20 +121,12 @@ func testNFS(c cluster.TestCluster, nfsversion int) {
 
 	c.Log("NFS client booted.")
 
-	checkmount := func() error {
-		status, err := c.SSH(m2, "systemctl is-active mnt.mount")
-		if err != nil || string(status) != "active" {
-			return fmt.Errorf("mnt.mount status is %q: %v", status, err)
-		}
-
-		c.Log("Got NFS mount.")
-		return nil
-	}
-
-	if err = util.Retry(10, 3*time.Second, checkmount); err != nil {
+	if err = m2.WaitForUnit("mnt.mount", "active", 30*time.Second); err != nil {
 		c.Fatal(err)
 	}
 
+	c.Log("Got NFS mount.")
+
 	_, err = c.SSH(m2, fmt.Sprintf("stat /mnt/%s", path.Base(string(tmp))))
 	if err != nil {
 		c.Fatalf("file %q does not exist", tmp)
@@ -0,0 +1,52 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/machine/qemu"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         NVMeDisks,
+		ClusterSize: 0,
+		Platforms:   []string{"qemu"},
+		Name:        "coreos.disk.nvme",
+	})
+}
+
+// NVMeDisks boots from an NVMe root disk with an NVMe data disk attached
+// and checks that both get the expected device names.
+func NVMeDisks(c cluster.TestCluster) {
+	options := qemu.MachineOptions{
+		NVMeRoot: true,
+		AdditionalDisks: []qemu.Disk{
+			{Size: "100M", Serial: "secondary", NVMe: true},
+		},
+	}
+	m, err := c.Cluster.(*qemu.Cluster).NewMachineWithOptions(nil, options)
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	c.MustSSH(m, "test -b /dev/nvme0n1 && test -b /dev/nvme1n1")
+	c.MustSSH(m, "test -L /dev/disk/by-id/nvme-QEMU_NVMe_Ctrl_secondary")
+
+	if out := c.MustSSH(m, "findmnt -no SOURCE /"); string(out) != "/dev/nvme0n1p9" {
+		c.Fatalf("root filesystem is on %q, not the NVMe disk", out)
+	}
+}
@@ -15,8 +15,6 @@
 package misc
 
 import (
-	"encoding/json"
-
 	"github.com/coreos/go-semver/semver"
 
 	"github.com/coreos/mantle/kola/cluster"
@@ -155,15 +153,9 @@ type blockdevice struct {
 // checkIfMountpointIsRaid will check if a given machine has a device of type
 // raid1 mounted at the given mountpoint. If it does not, the test is failed.
 func checkIfMountpointIsRaid(c cluster.TestCluster, m platform.Machine, mountpoint string) {
-	output, err := c.SSH(m, "lsblk --json")
-	if err != nil {
-		c.Fatalf("couldn't list block devices: %v", err)
-	}
-
 	l := lsblkOutput{}
-	err = json.Unmarshal(output, &l)
-	if err != nil {
-		c.Fatalf("couldn't unmarshal lsblk output: %v", err)
+	if err := c.SSHJSON(m, "lsblk --json", &l); err != nil {
+		c.Fatalf("couldn't list block devices: %v", err)
 	}
 
 	foundRoot := checkIfMountpointIsRaidWalker(c, l.Blockdevices, mountpoint)
@@ -24,6 +24,7 @@ func init() {
 		Run:         SelinuxEnforce,
 		ClusterSize: 1,
 		Name:        "coreos.selinux.enforce",
+		Smoke:       true,
 		Flags:       []register.Flag{register.NoEnableSelinux},
 	})
 }
@@ -0,0 +1,73 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/machine/qemu"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         StaticNetwork,
+		ClusterSize: 0,
+		Platforms:   []string{"qemu"},
+		Name:        "coreos.network.static",
+	})
+}
+
+// staticNetworkUnit configures the interface with the given MAC address
+// with a static address and no DHCP.
+const staticNetworkUnit = `[Match]
+MACAddress=%s
+
+[Network]
+DHCP=no
+Address=%s
+`
+
+// StaticNetwork configures a second interface, on a network without DHCP,
+// with a static address through networkd and checks the host is reachable
+// over it.
+func StaticNetwork(c cluster.TestCluster) {
+	qc := c.Cluster.(*qemu.Cluster)
+	m, err := qc.NewMachineWithOptions(nil, qemu.MachineOptions{StaticNetwork: true})
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	iface, err := qc.StaticInterface(m)
+	if err != nil {
+		c.Fatal(err)
+	}
+	addr := iface.DHCPv4[0]
+	host := qc.StaticNetwork()
+
+	// nothing should have configured the interface yet
+	out := c.MustSSH(m, "ip -4 -o addr show to "+(&net.IPNet{IP: host.IP.Mask(host.Mask), Mask: host.Mask}).String())
+	if len(out) != 0 {
+		c.Fatalf("static network was configured without a static config: %s", out)
+	}
+
+	unit := fmt.Sprintf(staticNetworkUnit, iface.HardwareAddr, addr.String())
+	c.MustSSH(m, fmt.Sprintf("echo '%s' | sudo tee /etc/systemd/network/50-static.network >/dev/null", unit))
+	c.MustSSH(m, "sudo systemctl restart systemd-networkd")
+
+	c.MustSSH(m, fmt.Sprintf("ping -c 1 -w 30 %s", host.IP))
+}
@@ -29,17 +29,20 @@ func init() {
 		Run:         RebootIntoUSRB,
 		ClusterSize: 1,
 		Name:        "coreos.update.reboot",
+		Destructive: true,
 	})
 	register.Register(&register.Test{
 		Run:         RecoverBadVerity,
 		ClusterSize: 1,
 		Name:        "coreos.update.badverity",
+		Destructive: true,
 		Flags:       []register.Flag{register.NoEmergencyShellCheck},
 	})
 	register.Register(&register.Test{
 		Run:         RecoverBadUsr,
 		ClusterSize: 1,
 		Name:        "coreos.update.badusr",
+		Destructive: true,
 		Flags:       []register.Flag{register.NoEmergencyShellCheck},
 	})
 }
@@ -169,7 +172,7 @@ func rebootWithEmergencyShellTimeout(c cluster.TestCluster, m platform.Machine)
 	if err := platform.StartReboot(m); err != nil {
 		c.Fatal(err)
 	}
-	time.Sleep(5 * time.Minute)
+	c.Sleep(5 * time.Minute)
 	if err := platform.CheckMachine(m); err != nil {
 		c.Fatal(err)
 	}
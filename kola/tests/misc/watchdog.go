@@ -0,0 +1,66 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package misc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/register"
+	"github.com/coreos/mantle/platform/machine/qemu"
+	"github.com/coreos/mantle/util"
+)
+
+func init() {
+	register.Register(&register.Test{
+		Run:         Watchdog,
+		ClusterSize: 0,
+		Platforms:   []string{"qemu"},
+		Name:        "coreos.qemu.watchdog",
+	})
+}
+
+// Watchdog checks that a guest which arms its watchdog and then stops
+// pinging it, as a hung guest would, is reset by QEMU.
+func Watchdog(c cluster.TestCluster) {
+	m, err := c.Cluster.(*qemu.Cluster).NewMachineWithOptions(nil, qemu.MachineOptions{
+		Watchdog: "reset",
+	})
+	if err != nil {
+		c.Fatal(err)
+	}
+
+	bootID := c.MustSSH(m, "cat /proc/sys/kernel/random/boot_id")
+
+	// closing the device without the magic 'V' leaves the watchdog
+	// running with nothing to ping it
+	c.MustSSH(m, "sudo sh -c 'echo > /dev/watchdog'")
+
+	// the i6300esb resets the guest after two 30 second stages
+	err = util.Retry(36, 5*time.Second, func() error {
+		id, _, err := m.SSH("cat /proc/sys/kernel/random/boot_id")
+		if err != nil {
+			return err
+		}
+		if string(id) == string(bootID) {
+			return fmt.Errorf("machine has not been reset")
+		}
+		return nil
+	})
+	if err != nil {
+		c.Fatalf("watchdog did not reset the machine: %v", err)
+	}
+}
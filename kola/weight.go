@@ -0,0 +1,80 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"sync"
+
+	"github.com/coreos/mantle/kola/register"
+)
+
+// weightLimiter bounds the total resource weight of the tests running at
+// once, so that a few heavy tests don't overcommit the host the way the
+// same number of light ones would not.
+type weightLimiter struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	capacity int // 0 means unlimited
+	used     int
+}
+
+func newWeightLimiter(capacity int) *weightLimiter {
+	l := &weightLimiter{capacity: capacity}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// acquire blocks until weight w fits within the limit and reserves it. It
+// returns the weight actually reserved, which must be passed to release;
+// a test heavier than the whole limit reserves all of it and runs alone.
+func (l *weightLimiter) acquire(w int) int {
+	if l.capacity <= 0 {
+		return 0
+	}
+	if w > l.capacity {
+		w = l.capacity
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for l.used+w > l.capacity {
+		l.cond.Wait()
+	}
+	l.used += w
+	return w
+}
+
+// release returns weight reserved by acquire.
+func (l *weightLimiter) release(w int) {
+	if w == 0 {
+		return
+	}
+	l.mu.Lock()
+	l.used -= w
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// testWeight returns the resource weight of t: its ResourceWeight if set,
+// or else one per machine it starts.
+func testWeight(t *register.Test) int {
+	if t.ResourceWeight > 0 {
+		return t.ResourceWeight
+	}
+	if t.ClusterSize > 1 {
+		return t.ClusterSize
+	}
+	return 1
+}
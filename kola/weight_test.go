@@ -0,0 +1,86 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kola
+
+import (
+	"testing"
+	"time"
+
+	"github.com/coreos/mantle/kola/register"
+)
+
+func TestWeightLimiterAcquire(t *testing.T) {
+	for _, tt := range []struct {
+		capacity int
+		weight   int
+		reserved int
+	}{
+		{0, 3, 0},
+		{-1, 3, 0},
+		{4, 1, 1},
+		{4, 4, 4},
+		{4, 9, 4},
+	} {
+		l := newWeightLimiter(tt.capacity)
+		if reserved := l.acquire(tt.weight); reserved != tt.reserved {
+			t.Errorf("capacity %d: acquire(%d) reserved %d, expected %d", tt.capacity, tt.weight, reserved, tt.reserved)
+		}
+		l.release(tt.reserved)
+		if l.used != 0 {
+			t.Errorf("capacity %d: %d still used after release", tt.capacity, l.used)
+		}
+	}
+}
+
+func TestWeightLimiterBlocks(t *testing.T) {
+	l := newWeightLimiter(3)
+	first := l.acquire(2)
+
+	acquired := make(chan int)
+	go func() {
+		acquired <- l.acquire(2)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire did not wait for weight beyond the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	l.release(first)
+	select {
+	case w := <-acquired:
+		l.release(w)
+	case <-time.After(5 * time.Second):
+		t.Fatal("acquire still waiting after weight was released")
+	}
+}
+
+func TestTestWeight(t *testing.T) {
+	for _, tt := range []struct {
+		test   register.Test
+		weight int
+	}{
+		{register.Test{}, 1},
+		{register.Test{ClusterSize: 1}, 1},
+		{register.Test{ClusterSize: 3}, 3},
+		{register.Test{ClusterSize: 3, ResourceWeight: 5}, 5},
+		{register.Test{ResourceWeight: 2}, 2},
+	} {
+		if w := testWeight(&tt.test); w != tt.weight {
+			t.Errorf("testWeight(%+v) = %d, expected %d", tt.test, w, tt.weight)
+		}
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/kms"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/sts"
 	"github.com/coreos/pkg/capnslog"
@@ -50,11 +51,17 @@ type Options struct {
 	AMI           string
 	InstanceType  string
 	SecurityGroup string
+
+	// RootVolumeKMSKey is the ID, ARN, or alias of a KMS key to encrypt
+	// instance root volumes with. Root volumes use the AMI's encryption
+	// settings if it is empty.
+	RootVolumeKMSKey string
 }
 
 type API struct {
 	session client.ConfigProvider
 	ec2     *ec2.EC2
+	kms     *kms.KMS
 	s3      *s3.S3
 	opts    *Options
 }
@@ -86,6 +93,7 @@ func New(opts *Options) (*API, error) {
 	api := &API{
 		session: sess,
 		ec2:     ec2.New(sess),
+		kms:     kms.New(sess),
 		s3:      s3.New(sess),
 		opts:    opts,
 	}
@@ -23,9 +23,30 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 
+	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/util"
 )
 
+// launchRetryDelay is the initial delay between instance launch attempts
+// while EC2 is throttling requests or out of capacity.
+const launchRetryDelay = 10 * time.Second
+
+// consoleTimeout bounds how long GetConsoleOutput retries requests and
+// waits for output.
+const consoleTimeout = 5 * time.Minute
+
+// isThrottled reports whether err is a transient EC2 error indicating
+// that the launch should be retried later.
+func isThrottled(err error) bool {
+	if awserr, ok := err.(awserr.Error); ok {
+		switch awserr.Code() {
+		case "InsufficientInstanceCapacity", "InstanceLimitExceeded", "RequestLimitExceeded", "Throttling":
+			return true
+		}
+	}
+	return false
+}
+
 func (a *API) AddKey(name, key string) error {
 	_, err := a.ec2.ImportKeyPair(&ec2.ImportKeyPairInput{
 		KeyName:           &name,
@@ -43,6 +64,10 @@ func (a *API) DeleteKey(name string) error {
 	return err
 }
 
+// MaxUserDataSize is the most user-data EC2 accepts for an instance,
+// before base64 encoding.
+const MaxUserDataSize = 16 * 1024
+
 // CreateInstances creates EC2 instances with a given name tag, optional ssh key name, user data. The image ID, instance type, and security group set in the API will be used. CreateInstances will block until all instances are running and have an IP address.
 func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*ec2.Instance, error) {
 	cnt := int64(count)
@@ -70,8 +95,32 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 		SecurityGroupIds: []*string{&sgId},
 		UserData:         ud,
 	}
+	if a.opts.RootVolumeKMSKey != "" {
+		root, err := a.rootDeviceName(a.opts.AMI)
+		if err != nil {
+			return nil, err
+		}
+		inst.BlockDeviceMappings = []*ec2.BlockDeviceMapping{
+			&ec2.BlockDeviceMapping{
+				DeviceName: aws.String(root),
+				Ebs: &ec2.EbsBlockDevice{
+					DeleteOnTermination: aws.Bool(true),
+					Encrypted:           aws.Bool(true),
+					KmsKeyId:            aws.String(a.opts.RootVolumeKMSKey),
+				},
+			},
+		}
+	}
 
-	reservations, err := a.ec2.RunInstances(&inst)
+	var reservations *ec2.Reservation
+	err = util.RetryWithBackoff(a.opts.LaunchTimeout, launchRetryDelay, isThrottled, func() error {
+		var err error
+		reservations, err = a.ec2.RunInstances(&inst)
+		if err != nil && isThrottled(err) {
+			plog.Infof("retrying instance launch: %v", err)
+		}
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("error running instances: %v", err)
 	}
@@ -110,7 +159,7 @@ func (a *API) CreateInstances(name, keyname, userdata string, count uint64) ([]*
 		select {
 		case <-after:
 			a.TerminateInstances(ids)
-			return nil, fmt.Errorf("timed out waiting for instances to run")
+			return nil, platform.BootError{Err: fmt.Errorf("timed out waiting for instances to run")}
 		default:
 		}
 
@@ -169,29 +218,37 @@ func (a *API) CreateTags(resources []string, tags map[string]string) error {
 	return err
 }
 
-func (a *API) GetConsoleOutput(instanceID string, wait bool) (string, error) {
+// GetConsoleOutput returns the console output of an instance. If wait is
+// set it polls until EC2 has output for the instance. Failed requests,
+// such as throttled ones, are retried, starting after interval and backing
+// off exponentially.
+func (a *API) GetConsoleOutput(instanceID string, wait bool, interval time.Duration) (string, error) {
 	var output string
-
-	err := util.Retry(60, 5*time.Second, func() error {
+	var decodeErr error
+	retryable := func(err error) bool {
+		return err != decodeErr
+	}
+	err := util.RetryWithBackoff(consoleTimeout, interval, retryable, func() error {
 		res, err := a.ec2.GetConsoleOutput(&ec2.GetConsoleOutputInput{
 			InstanceId: aws.String(instanceID),
 		})
 		if err != nil {
+			plog.Debugf("console request for %v failed, retrying: %v", instanceID, err)
 			return fmt.Errorf("couldn't get console output of %v: %v", instanceID, err)
 		}
 
 		if res.Output == nil {
-			if wait {
-				plog.Debugf("waiting for console for %v", instanceID)
-				return fmt.Errorf("timed out waiting for console output of %v", instanceID)
-			} else {
+			if !wait {
 				return nil
 			}
+			plog.Debugf("waiting for console for %v", instanceID)
+			return fmt.Errorf("timed out waiting for console output of %v", instanceID)
 		}
 
 		decoded, err := base64.StdEncoding.DecodeString(*res.Output)
 		if err != nil {
-			return fmt.Errorf("couldn't decode console output of %v: %v", instanceID, err)
+			decodeErr = fmt.Errorf("couldn't decode console output of %v: %v", instanceID, err)
+			return decodeErr
 		}
 
 		output = string(decoded)
@@ -201,6 +258,11 @@ func (a *API) GetConsoleOutput(instanceID string, wait bool) (string, error) {
 	return output, err
 }
 
+// InstanceConsoleURL returns the EC2 console page of the given instance.
+func (a *API) InstanceConsoleURL(instanceID string) string {
+	return fmt.Sprintf("https://console.aws.amazon.com/ec2/v2/home?region=%s#Instances:instanceId=%s", a.opts.Region, instanceID)
+}
+
 // getSecurityGroupID gets a security group matching the given name.
 // If the security group does not exist, it's created.
 func (a *API) getSecurityGroupID(name string) (string, error) {
@@ -655,3 +655,31 @@ func (a *API) PublishImage(imageID string) error {
 
 	return nil
 }
+
+// ImportImage imports a raw disk image stored at the given s3:// URL as an
+// HVM AMI named name, reusing any existing snapshot or AMI from a previous
+// import of the same name. It returns the AMI ID.
+func (a *API) ImportImage(name, sourceURL string) (string, error) {
+	amiName := name + "-hvm"
+	imageID, err := a.FindImage(amiName)
+	if err != nil {
+		return "", err
+	}
+	if imageID != "" {
+		plog.Infof("found existing image %v, reusing", imageID)
+		return imageID, nil
+	}
+
+	snapshot, err := a.FindSnapshot(name)
+	if err != nil {
+		return "", err
+	}
+	if snapshot == nil {
+		snapshot, err = a.CreateSnapshot(name, sourceURL, EC2ImageFormatRaw)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return a.CreateHVMImage(snapshot.SnapshotID, amiName, "kola import of "+sourceURL)
+}
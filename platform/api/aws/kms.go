@@ -0,0 +1,55 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package aws
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/kms"
+)
+
+// CheckKMSKey verifies that the KMS key, given as an ID, ARN, or alias,
+// exists, is enabled, and can be described with the API's credentials,
+// returning its ARN.
+func (a *API) CheckKMSKey(key string) (string, error) {
+	res, err := a.kms.DescribeKey(&kms.DescribeKeyInput{
+		KeyId: aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("describing KMS key %q: %v", key, err)
+	}
+	md := res.KeyMetadata
+	if state := aws.StringValue(md.KeyState); state != kms.KeyStateEnabled {
+		return "", fmt.Errorf("KMS key %q is %s, not %s", key, state, kms.KeyStateEnabled)
+	}
+	return aws.StringValue(md.Arn), nil
+}
+
+// rootDeviceName returns the name of the root device of the AMI, which
+// block device mappings must use to override its root volume.
+func (a *API) rootDeviceName(ami string) (string, error) {
+	res, err := a.ec2.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(ami)},
+	})
+	if err != nil {
+		return "", fmt.Errorf("describing %s: %v", ami, err)
+	}
+	if len(res.Images) == 0 || res.Images[0].RootDeviceName == nil {
+		return "", fmt.Errorf("no root device found for %s", ami)
+	}
+	return *res.Images[0].RootDeviceName, nil
+}
@@ -22,6 +22,7 @@ import (
 	"strings"
 
 	"github.com/coreos/pkg/capnslog"
+	"google.golang.org/api/cloudkms/v1"
 	"google.golang.org/api/compute/v1"
 
 	"github.com/coreos/mantle/auth"
@@ -41,9 +42,31 @@ type Options struct {
 	Network     string
 	JSONKeyFile string
 	ServiceAuth bool
+
+	// LocalSSDs is the number of local SSDs to attach to each instance.
+	// They appear in the guest as /dev/disk/by-id/google-local-ssd-<n>.
+	LocalSSDs int
+
+	// AdditionalDisks are persistent disks created with, attached to,
+	// and deleted with each instance. They appear in the guest as
+	// /dev/disk/by-id/google-kola-disk-<n>.
+	AdditionalDisks []Disk
+
+	// DiskKMSKey is the resource name of a Cloud KMS key, of the form
+	// projects/*/locations/*/keyRings/*/cryptoKeys/*, to encrypt the boot
+	// disk and additional persistent disks with. Disks use Google-managed
+	// encryption if it is empty.
+	DiskKMSKey string
+
 	*platform.Options
 }
 
+// Disk describes an additional persistent disk.
+type Disk struct {
+	SizeGB int64
+	Type   string // disk type such as "pd-standard"; defaults to Options.DiskType
+}
+
 type API struct {
 	client  *http.Client
 	compute *compute.Service
@@ -55,12 +78,15 @@ func New(opts *Options) (*API, error) {
 
 	// If the image name isn't a full api endpoint accept a name beginning
 	// with "projects/" to specify a different project from the instance.
-	// Also accept a short name and use instance project.
-	if strings.HasPrefix(opts.Image, "projects/") {
+	// Also accept a short name and use instance project. Image tarballs
+	// in Google Cloud Storage are left for ImportImage to handle.
+	switch {
+	case strings.HasPrefix(opts.Image, "gs://"):
+	case strings.HasPrefix(opts.Image, "projects/"):
 		opts.Image = endpointPrefix + opts.Image
-	} else if !strings.Contains(opts.Image, "/") {
+	case !strings.Contains(opts.Image, "/"):
 		opts.Image = fmt.Sprintf("%sprojects/%s/global/images/%s", endpointPrefix, opts.Project, opts.Image)
-	} else if !strings.HasPrefix(opts.Image, endpointPrefix) {
+	case !strings.HasPrefix(opts.Image, endpointPrefix):
 		return nil, fmt.Errorf("GCE Image argument must be the full api endpoint, begin with 'projects/', or use the short name")
 	}
 
@@ -90,6 +116,12 @@ func New(opts *Options) (*API, error) {
 		return nil, err
 	}
 
+	if opts.DiskKMSKey != "" {
+		if err := checkDiskKMSKey(client, opts.DiskKMSKey); err != nil {
+			return nil, err
+		}
+	}
+
 	api := &API{
 		client:  client,
 		compute: capi,
@@ -99,6 +131,26 @@ func New(opts *Options) (*API, error) {
 	return api, nil
 }
 
+// checkDiskKMSKey verifies that the Cloud KMS key exists and has an
+// enabled primary version, so that instance creation doesn't fail later.
+func checkDiskKMSKey(client *http.Client, key string) error {
+	kms, err := cloudkms.New(client)
+	if err != nil {
+		return err
+	}
+	ck, err := kms.Projects.Locations.KeyRings.CryptoKeys.Get(key).Do()
+	if err != nil {
+		return fmt.Errorf("getting KMS key %q: %v", key, err)
+	}
+	if ck.Purpose != "ENCRYPT_DECRYPT" {
+		return fmt.Errorf("KMS key %q has purpose %s, not ENCRYPT_DECRYPT", key, ck.Purpose)
+	}
+	if ck.Primary == nil || ck.Primary.State != "ENABLED" {
+		return fmt.Errorf("KMS key %q has no enabled primary version", key)
+	}
+	return nil
+}
+
 func (a *API) Client() *http.Client {
 	return a.client
 }
@@ -17,10 +17,17 @@ package gcloud
 import (
 	"crypto/rand"
 	"fmt"
+	"net/http"
+	"sort"
 	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh/agent"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/util"
 )
 
 func (a *API) vmname() string {
@@ -29,9 +36,25 @@ func (a *API) vmname() string {
 	return fmt.Sprintf("%s-%x", a.options.BaseName, b)
 }
 
+// MaxUserDataSize is the most user-data GCE accepts in an instance's
+// metadata.
+const MaxUserDataSize = 256 * 1024
+
+// diskEncryptionKey returns the Cloud KMS key for persistent disks.
+func (a *API) diskEncryptionKey() *compute.CustomerEncryptionKey {
+	return &compute.CustomerEncryptionKey{KmsKeyName: a.options.DiskKMSKey}
+}
+
 // Taken from: https://github.com/golang/build/blob/master/buildlet/gce.go
-func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Instance {
+func (a *API) mkinstance(userdata, name string, keys []*agent.Key, metadata map[string]string) *compute.Instance {
 	var metadataItems []*compute.MetadataItems
+	for _, key := range sortedKeys(metadata) {
+		value := metadata[key]
+		metadataItems = append(metadataItems, &compute.MetadataItems{
+			Key:   key,
+			Value: &value,
+		})
+	}
 	if len(keys) > 0 {
 		var sshKeys string
 		for i, key := range keys {
@@ -83,6 +106,39 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 			},
 		},
 	}
+	if a.options.DiskKMSKey != "" {
+		instance.Disks[0].DiskEncryptionKey = a.diskEncryptionKey()
+	}
+	for i, disk := range a.options.AdditionalDisks {
+		diskType := disk.Type
+		if diskType == "" {
+			diskType = a.options.DiskType
+		}
+		instance.Disks = append(instance.Disks, &compute.AttachedDisk{
+			AutoDelete: true,
+			DeviceName: fmt.Sprintf("kola-disk-%d", i),
+			Type:       "PERSISTENT",
+			InitializeParams: &compute.AttachedDiskInitializeParams{
+				DiskName:   fmt.Sprintf("%s-disk-%d", name, i),
+				DiskType:   "/zones/" + a.options.Zone + "/diskTypes/" + diskType,
+				DiskSizeGb: disk.SizeGB,
+			},
+		})
+		if a.options.DiskKMSKey != "" {
+			instance.Disks[len(instance.Disks)-1].DiskEncryptionKey = a.diskEncryptionKey()
+		}
+	}
+	for i := 0; i < a.options.LocalSSDs; i++ {
+		instance.Disks = append(instance.Disks, &compute.AttachedDisk{
+			AutoDelete: true,
+			DeviceName: fmt.Sprintf("local-ssd-%d", i),
+			Type:       "SCRATCH",
+			InitializeParams: &compute.AttachedDiskInitializeParams{
+				DiskType: "/zones/" + a.options.Zone + "/diskTypes/local-ssd",
+			},
+		})
+	}
+
 	// add cloud config
 	if userdata != "" {
 		instance.Metadata.Items = append(instance.Metadata.Items, &compute.MetadataItems{
@@ -95,24 +151,79 @@ func (a *API) mkinstance(userdata, name string, keys []*agent.Key) *compute.Inst
 
 }
 
-// CreateInstance creates a Google Compute Engine instance.
-func (a *API) CreateInstance(userdata string, keys []*agent.Key) (*compute.Instance, error) {
-	name := a.vmname()
-	inst := a.mkinstance(userdata, name, keys)
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
 
-	plog.Debugf("Creating instance %q", name)
+// launchRetryDelay is the initial delay between instance creation attempts
+// while GCE is throttling requests or out of capacity.
+const launchRetryDelay = 10 * time.Second
 
-	op, err := a.compute.Instances.Insert(a.options.Project, a.options.Zone, inst).Do()
-	if err != nil {
-		return nil, fmt.Errorf("failed to request new GCE instance: %v\n", err)
+// isThrottled reports whether err is a transient GCE error indicating
+// that instance creation should be retried later.
+func isThrottled(err error) bool {
+	if gerr, ok := err.(*googleapi.Error); ok && (gerr.Code == http.StatusTooManyRequests || gerr.Code == http.StatusServiceUnavailable) {
+		return true
+	}
+	// failed operations only report their error codes as text
+	for _, code := range []string{"RESOURCE_EXHAUSTED", "ZONE_RESOURCE_POOL_EXHAUSTED", "rateLimitExceeded"} {
+		if strings.Contains(err.Error(), code) {
+			return true
+		}
 	}
+	return false
+}
+
+// CreateInstance creates a Google Compute Engine instance. The items in
+// metadata are added to the instance metadata alongside the user data and
+// SSH keys.
+func (a *API) CreateInstance(userdata string, keys []*agent.Key, metadata map[string]string) (*compute.Instance, error) {
+	for _, key := range []string{"user-data", "ssh-keys"} {
+		if _, ok := metadata[key]; ok {
+			return nil, fmt.Errorf("metadata key %q is reserved", key)
+		}
+	}
+
+	var name string
+	create := func() error {
+		name = a.vmname()
+		inst := a.mkinstance(userdata, name, keys, metadata)
+
+		plog.Debugf("Creating instance %q", name)
 
-	doable := a.compute.ZoneOperations.Get(a.options.Project, a.options.Zone, op.Name)
-	if err := a.NewPending(op.Name, doable).Wait(); err != nil {
+		op, err := a.compute.Instances.Insert(a.options.Project, a.options.Zone, inst).Do()
+		if err != nil {
+			return fmt.Errorf("failed to request new GCE instance: %v", err)
+		}
+
+		doable := a.compute.ZoneOperations.Get(a.options.Project, a.options.Zone, op.Name)
+		if err := a.NewPending(op.Name, doable).Wait(); err != nil {
+			if _, ok := err.(timeoutError); ok {
+				// the instance may still come up; don't leak it
+				a.TerminateInstance(name)
+				return platform.BootError{Err: err}
+			}
+			return err
+		}
+		return nil
+	}
+	err := util.RetryWithBackoff(a.options.LaunchTimeout, launchRetryDelay, isThrottled, func() error {
+		err := create()
+		if err != nil && isThrottled(err) {
+			plog.Infof("retrying instance creation: %v", err)
+		}
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	inst, err = a.compute.Instances.Get(a.options.Project, a.options.Zone, name).Do()
+	inst, err := a.compute.Instances.Get(a.options.Project, a.options.Zone, name).Do()
 	if err != nil {
 		return nil, fmt.Errorf("failed getting instance %s details after creation: %v", name, err)
 	}
@@ -170,3 +281,8 @@ func InstanceIPs(inst *compute.Instance) (intIP, extIP string) {
 	}
 	return
 }
+
+// InstanceConsoleURL returns the Cloud Console page of the named instance.
+func (a *API) InstanceConsoleURL(name string) string {
+	return fmt.Sprintf("https://console.cloud.google.com/compute/instancesDetail/zones/%s/instances/%s?project=%s", a.options.Zone, name, a.options.Project)
+}
@@ -16,10 +16,12 @@ package gcloud
 
 import (
 	"fmt"
+	"net/http"
 	"strings"
 
 	"golang.org/x/net/context"
 	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
 )
 
 type DeprecationState string
@@ -153,3 +155,47 @@ func (a *API) DeleteImage(name string) (*Pending, error) {
 	opReq := a.compute.GlobalOperations.Get(a.options.Project, op.Name)
 	return a.NewPending(op.Name, opReq), nil
 }
+
+// ImportImage creates an image named name from the image tarball stored
+// at the given gs:// URL, reusing an existing image of the same name. It
+// returns the image's self link.
+func (a *API) ImportImage(name, sourceURL string) (string, error) {
+	// GCE image names are lowercase alphanumerics and dashes
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+
+	image, err := a.compute.Images.Get(a.options.Project, name).Do()
+	if err == nil {
+		plog.Infof("found existing image %v, reusing", name)
+		return image.SelfLink, nil
+	}
+	if gerr, ok := err.(*googleapi.Error); !ok || gerr.Code != http.StatusNotFound {
+		return "", fmt.Errorf("looking up image %v: %v", name, err)
+	}
+
+	source := strings.Replace(sourceURL, "gs://", "https://storage.googleapis.com/", 1)
+	_, pending, err := a.CreateImage(&ImageSpec{
+		Name:        name,
+		SourceImage: source,
+		Description: "kola import of " + sourceURL,
+	}, false)
+	if err != nil {
+		return "", fmt.Errorf("creating image %v: %v", name, err)
+	}
+	if err := pending.Wait(); err != nil {
+		return "", err
+	}
+
+	image, err = a.compute.Images.Get(a.options.Project, name).Do()
+	if err != nil {
+		return "", fmt.Errorf("looking up image %v: %v", name, err)
+	}
+	return image.SelfLink, nil
+}
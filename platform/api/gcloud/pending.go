@@ -35,6 +35,12 @@ type Pending struct {
 	do   doable
 }
 
+// timeoutError is returned by the default progress function when an
+// operation doesn't finish within Pending.Timeout.
+type timeoutError struct {
+	error
+}
+
 func (a *API) NewPending(desc string, do doable) *Pending {
 	pending := &Pending{
 		Interval: 10 * time.Second,
@@ -90,7 +96,7 @@ func (p *Pending) defaultProgress(desc string, elapsed time.Duration, op *comput
 	}
 
 	if p.Timeout > 0 && elapsed > p.Timeout {
-		return fmt.Errorf("Failed to wait for operation %q: %v", desc, err)
+		return timeoutError{fmt.Errorf("Failed to wait for operation %q: %v", desc, err)}
 	}
 
 	return nil
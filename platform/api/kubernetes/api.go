@@ -0,0 +1,215 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kubernetes runs Container Linux machines as KubeVirt virtual
+// machine instances in an existing Kubernetes cluster. It drives the
+// cluster with kubectl, which must be in $PATH, so no Kubernetes client
+// library is needed.
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/system/exec"
+	"github.com/coreos/mantle/util"
+)
+
+const (
+	// ignitionAnnotation passes an Ignition config to a KubeVirt VMI;
+	// KubeVirt's ExperimentalIgnitionSupport feature gate must be on.
+	ignitionAnnotation = "kubevirt.io/ignitiondata"
+
+	// consoleContainer is the virt-launcher sidecar which logs the
+	// guest's serial console, when KubeVirt is configured to add it.
+	consoleContainer = "guest-console-log"
+
+	vmiPollInterval = 5 * time.Second
+	vmiPollAttempts = 60
+)
+
+var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/kubernetes")
+
+type Options struct {
+	*platform.Options
+
+	// Kubeconfig and Context select the Kubernetes cluster; they
+	// default to kubectl's defaults.
+	Kubeconfig string
+	Context    string
+
+	// Namespace is where machines are created; it defaults to the
+	// context's namespace.
+	Namespace string
+
+	// ContainerDisk is a KubeVirt containerDisk image holding a
+	// Container Linux disk image.
+	ContainerDisk string
+
+	// Memory is the guest memory, e.g. "2Gi".
+	Memory string
+}
+
+type API struct {
+	opts *Options
+}
+
+// New checks that kubectl can reach the cluster and returns an API for it.
+func New(opts *Options) (*API, error) {
+	if opts.ContainerDisk == "" {
+		return nil, fmt.Errorf("a KubeVirt container disk image is required")
+	}
+	if opts.Memory == "" {
+		opts.Memory = "2Gi"
+	}
+
+	a := &API{opts: opts}
+	if _, err := a.kubectl(nil, "get", "virtualmachineinstances"); err != nil {
+		return nil, fmt.Errorf("listing KubeVirt VMIs failed, is KubeVirt installed? %v", err)
+	}
+	return a, nil
+}
+
+// kubectl runs kubectl with the configured cluster and namespace, passing
+// stdin if given, and returns its output.
+func (a *API) kubectl(stdin []byte, args ...string) ([]byte, error) {
+	var global []string
+	if a.opts.Kubeconfig != "" {
+		global = append(global, "--kubeconfig", a.opts.Kubeconfig)
+	}
+	if a.opts.Context != "" {
+		global = append(global, "--context", a.opts.Context)
+	}
+	if a.opts.Namespace != "" {
+		global = append(global, "--namespace", a.opts.Namespace)
+	}
+
+	cmd := exec.Command("kubectl", append(global, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("kubectl %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// CreateVMI starts a VMI named name booting the container disk with the
+// given Ignition config, and waits for it to be assigned an IP address,
+// which it returns.
+func (a *API) CreateVMI(name, ignition string) (string, error) {
+	vmi := map[string]interface{}{
+		"apiVersion": "kubevirt.io/v1",
+		"kind":       "VirtualMachineInstance",
+		"metadata": map[string]interface{}{
+			"name":        name,
+			"labels":      map[string]string{"app": "kola"},
+			"annotations": map[string]string{ignitionAnnotation: ignition},
+		},
+		"spec": map[string]interface{}{
+			"domain": map[string]interface{}{
+				"devices": map[string]interface{}{
+					"disks": []interface{}{
+						map[string]interface{}{
+							"name": "root",
+							"disk": map[string]string{"bus": "virtio"},
+						},
+					},
+				},
+				"resources": map[string]interface{}{
+					"requests": map[string]string{"memory": a.opts.Memory},
+				},
+			},
+			"volumes": []interface{}{
+				map[string]interface{}{
+					"name":          "root",
+					"containerDisk": map[string]string{"image": a.opts.ContainerDisk},
+				},
+			},
+		},
+	}
+	manifest, err := json.Marshal(vmi)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := a.kubectl(manifest, "create", "-f", "-"); err != nil {
+		return "", err
+	}
+
+	var ip string
+	err = util.Retry(vmiPollAttempts, vmiPollInterval, func() error {
+		ip, err = a.vmiIP(name)
+		return err
+	})
+	if err != nil {
+		a.DeleteVMI(name)
+		return "", err
+	}
+	return ip, nil
+}
+
+// vmiIP returns the IP address of a running VMI.
+func (a *API) vmiIP(name string) (string, error) {
+	out, err := a.kubectl(nil, "get", "virtualmachineinstance", name, "--output", "json")
+	if err != nil {
+		return "", err
+	}
+	var vmi struct {
+		Status struct {
+			Phase      string `json:"phase"`
+			Interfaces []struct {
+				IPAddress string `json:"ipAddress"`
+			} `json:"interfaces"`
+		} `json:"status"`
+	}
+	if err := json.Unmarshal(out, &vmi); err != nil {
+		return "", fmt.Errorf("parsing VMI %s: %v", name, err)
+	}
+	switch vmi.Status.Phase {
+	case "Failed", "Succeeded":
+		return "", fmt.Errorf("VMI %s stopped in phase %s", name, vmi.Status.Phase)
+	case "Running":
+		if len(vmi.Status.Interfaces) > 0 && vmi.Status.Interfaces[0].IPAddress != "" {
+			return vmi.Status.Interfaces[0].IPAddress, nil
+		}
+	}
+	plog.Debugf("waiting for VMI %s, phase %q", name, vmi.Status.Phase)
+	return "", fmt.Errorf("timed out waiting for VMI %s to get an IP address", name)
+}
+
+// DeleteVMI deletes the VMI and waits for it to go away.
+func (a *API) DeleteVMI(name string) error {
+	_, err := a.kubectl(nil, "delete", "virtualmachineinstance", name, "--ignore-not-found", "--wait")
+	return err
+}
+
+// GetConsoleOutput returns the serial console log of the VMI. It requires
+// KubeVirt's serial console log sidecar; without it an error is returned.
+func (a *API) GetConsoleOutput(name string) (string, error) {
+	out, err := a.kubectl(nil, "logs", "--selector", "vm.kubevirt.io/name="+name, "--container", consoleContainer, "--tail", "-1")
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
@@ -52,6 +52,10 @@ const (
 var (
 	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/api/packet")
 
+	// DefaultConsoleBanners are the GRUB banner, since the provisioning
+	// OS boots through iPXE, followed by the kernel's.
+	DefaultConsoleBanners = []string{"GNU GRUB", "Linux version"}
+
 	defaultInstallerImageBaseURL = map[string]string{
 		// HTTPS causes iPXE to fail on a "permission denied" error
 		"amd64-usr": "http://stable.release.core-os.net/amd64-usr/current",
@@ -99,6 +103,14 @@ type Options struct {
 	// Google Storage base URL for temporary uploads
 	// e.g. gs://users.developer.core-os.net/bovik/mantle
 	StorageURL string
+
+	// Banners which, in order, mark the start of the installed OS's boot
+	// in the console output, after that of the provisioning OS.
+	// Defaults to DefaultConsoleBanners.
+	ConsoleBanners []string
+	// How long to wait for the banners to show up in the console
+	// output before a device is deleted
+	ConsoleBannerTimeout time.Duration
 }
 
 type API struct {
@@ -228,13 +240,13 @@ func (a *API) CreateDevice(hostname string, conf *conf.Conf, console Console) (*
 	ipAddress := a.GetDeviceAddress(device, 4, true)
 	if ipAddress == "" {
 		a.DeleteDevice(deviceID)
-		return nil, fmt.Errorf("no public IP address found for %v", deviceID)
+		return nil, platform.BootError{Err: fmt.Errorf("no public IP address found for %v", deviceID)}
 	}
 
 	err = waitForInstall(ipAddress)
 	if err != nil {
 		a.DeleteDevice(deviceID)
-		return nil, fmt.Errorf("timed out waiting for coreos-install: %v", err)
+		return nil, platform.BootError{Err: fmt.Errorf("timed out waiting for coreos-install: %v", err)}
 	}
 
 	return device, nil
@@ -257,6 +269,11 @@ func (a *API) GetDeviceAddress(device *packngo.Device, family int, public bool)
 	return ""
 }
 
+// DeviceConsoleURL returns the Packet portal page of the given device.
+func (a *API) DeviceConsoleURL(deviceID string) string {
+	return fmt.Sprintf("https://app.packet.net/devices/%s", deviceID)
+}
+
 func (a *API) AddKey(name, key string) (string, error) {
 	sshKey, _, err := a.c.SSHKeys.Create(&packngo.SSHKeyCreateRequest{
 		Label: name,
@@ -520,7 +537,7 @@ func (a *API) waitForActive(deviceID string) (*packngo.Device, error) {
 			time.Sleep(launchPollInterval)
 		}
 	}
-	return nil, fmt.Errorf("timed out waiting for device")
+	return nil, platform.BootError{Err: fmt.Errorf("timed out waiting for device")}
 }
 
 // Connect to the discard port and wait for the connection to close,
@@ -16,9 +16,13 @@ package platform
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,18 +30,56 @@ import (
 	"github.com/satori/go.uuid"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/net/context"
 
+	"github.com/coreos/mantle/lang/worker"
 	"github.com/coreos/mantle/network"
 	"github.com/coreos/mantle/platform/conf"
 	"github.com/coreos/mantle/util"
 )
 
+// updateCACertsUnit rebuilds the system trust store after the CAs from
+// RuntimeConfig.TrustedCAs have been written, before anything which might
+// need them starts.
+const updateCACertsUnit = `[Unit]
+Description=Update trusted CA certificates for kola
+Before=docker.service containerd.service
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/usr/sbin/update-ca-certificates
+[Install]
+WantedBy=multi-user.target
+`
+
+// defaultMaxSSHSessions bounds concurrent SSH commands to one machine when
+// RuntimeConfig.MaxSSHSessions is unset. It stays below sshd's default
+// MaxStartups of 10 unauthenticated connections.
+const defaultMaxSSHSessions = 8
+
+// sshRetryDelay is how long SSH waits before rerunning a command whose
+// connection dropped, when RuntimeConfig.SSHRetries allows it.
+const sshRetryDelay = 2 * time.Second
+
+// defaultConsolePollInterval spaces console output requests when
+// RuntimeConfig.ConsolePollInterval is unset.
+const defaultConsolePollInterval = 5 * time.Second
+
+// Defaults for RuntimeConfig.DestroyWorkers and DestroyTimeout.
+const (
+	defaultDestroyWorkers = 10
+	defaultDestroyTimeout = 10 * time.Minute
+)
+
 type BaseCluster struct {
-	agent *network.SSHAgent
+	agent  *network.SSHAgent
+	dialer network.Dialer
 
 	machlock   sync.Mutex
-	machmap    map[string]Machine
+	machs      []Machine // in creation order
 	consolemap map[string]string
+	confs      map[string]*conf.Conf    // per machine ID, as rendered for it
+	sshSlots   map[string]chan struct{} // per machine ID, bounding concurrent SSH commands
 
 	name       string
 	rconf      *RuntimeConfig
@@ -49,6 +91,10 @@ func NewBaseCluster(basename string, rconf *RuntimeConfig, ctPlatform string) (*
 }
 
 func NewBaseClusterWithDialer(basename string, rconf *RuntimeConfig, ctPlatform string, dialer network.Dialer) (*BaseCluster, error) {
+	if rconf.NoSSHKeyInUserData && rconf.NoSSHKeyInMetadata {
+		return nil, fmt.Errorf("cannot disable SSH keys in both userdata and metadata")
+	}
+
 	agent, err := network.NewSSHAgent(dialer)
 	if err != nil {
 		return nil, err
@@ -56,8 +102,10 @@ func NewBaseClusterWithDialer(basename string, rconf *RuntimeConfig, ctPlatform
 
 	bc := &BaseCluster{
 		agent:      agent,
-		machmap:    make(map[string]Machine),
+		dialer:     dialer,
 		consolemap: make(map[string]string),
+		confs:      make(map[string]*conf.Conf),
+		sshSlots:   make(map[string]chan struct{}),
 		name:       fmt.Sprintf("%s-%s", basename, uuid.NewV4()),
 		rconf:      rconf,
 		ctPlatform: ctPlatform,
@@ -66,6 +114,12 @@ func NewBaseClusterWithDialer(basename string, rconf *RuntimeConfig, ctPlatform
 	return bc, nil
 }
 
+// Dial connects to address from the host side of the cluster's network,
+// such as the network namespace of a local cluster.
+func (bc *BaseCluster) Dial(network, address string) (net.Conn, error) {
+	return bc.dialer.Dial(network, address)
+}
+
 func (bc *BaseCluster) SSHClient(ip string) (*ssh.Client, error) {
 	sshClient, err := bc.agent.NewClient(ip)
 	if err != nil {
@@ -75,6 +129,24 @@ func (bc *BaseCluster) SSHClient(ip string) (*ssh.Client, error) {
 	return sshClient, nil
 }
 
+// SSHHost returns the address used to SSH to m: its DNS name if
+// RuntimeConfig.SSHByDNSName is set and the platform assigned one,
+// otherwise its IP.
+func (bc *BaseCluster) SSHHost(m Machine) string {
+	if bc.rconf.SSHByDNSName {
+		if name := m.DNSName(); name != "" {
+			return name
+		}
+	}
+	return m.IP()
+}
+
+// SSHAgentSocket returns the path of the socket of the SSH agent holding
+// the cluster's key, for use as SSH_AUTH_SOCK.
+func (bc *BaseCluster) SSHAgentSocket() string {
+	return bc.agent.Socket
+}
+
 func (bc *BaseCluster) UserSSHClient(ip, user string) (*ssh.Client, error) {
 	sshClient, err := bc.agent.NewUserClient(ip, user)
 	if err != nil {
@@ -97,48 +169,161 @@ func (bc *BaseCluster) PasswordSSHClient(ip string, user string, password string
 // stdout and stderr of the command and an error.
 // Leading and trailing whitespace is trimmed from each.
 func (bc *BaseCluster) SSH(m Machine, cmd string) ([]byte, []byte, error) {
+	return bc.SSHWithInput(m, cmd, nil)
+}
+
+// SSHWithInput runs cmd on m like SSH, with stdin, if not nil, connected
+// to its standard input. Commands without stdin are retried after
+// transport errors as RuntimeConfig.SSHRetries allows; stdin can't be
+// replayed.
+func (bc *BaseCluster) SSHWithInput(m Machine, cmd string, stdin io.Reader) ([]byte, []byte, error) {
 	var stdout bytes.Buffer
 	var stderr bytes.Buffer
-	client, err := bc.SSHClient(m.IP())
+	retry, err := bc.runSSH(m, cmd, stdin, &stdout, &stderr)
+	for i := 0; i < bc.rconf.SSHRetries && stdin == nil && retry; i++ {
+		time.Sleep(sshRetryDelay)
+		stdout.Reset()
+		stderr.Reset()
+		retry, err = bc.runSSH(m, cmd, nil, &stdout, &stderr)
+	}
+	outBytes := bytes.TrimSpace(stdout.Bytes())
+	errBytes := bytes.TrimSpace(stderr.Bytes())
+	return outBytes, errBytes, err
+}
+
+// SSHPipeOutput runs cmd on m like SSH, but writes its stdout and stderr
+// to the given writers as they are produced instead of buffering them.
+func (bc *BaseCluster) SSHPipeOutput(m Machine, cmd string, stdout, stderr io.Writer) error {
+	_, err := bc.runSSH(m, cmd, nil, stdout, stderr)
+	return err
+}
+
+// runSSH runs cmd on m over a new SSH connection with the given standard
+// streams. retry reports whether err came from the connection rather
+// than the command, so running it again may succeed.
+func (bc *BaseCluster) runSSH(m Machine, cmd string, stdin io.Reader, stdout, stderr io.Writer) (retry bool, err error) {
+	release := bc.acquireSSHSlot(m)
+	defer release()
+
+	client, err := bc.SSHClient(bc.SSHHost(m))
 	if err != nil {
-		return nil, nil, err
+		return true, err
 	}
 	defer client.Close()
 
+	return runSession(client, wrapShell(bc.rconf.SSHShell, cmd), stdin, stdout, stderr)
+}
+
+// runSession runs cmd in a new session on client like runSSH. A command
+// which exits with a status is never retried. One which ends without a
+// status (*ssh.ExitMissingError) is retried only if the connection went
+// with it, as with EOF or a reset; if the server is still answering,
+// the command itself was killed.
+func runSession(client *ssh.Client, cmd string, stdin io.Reader, stdout, stderr io.Writer) (retry bool, err error) {
 	session, err := client.NewSession()
 	if err != nil {
-		return nil, nil, err
+		return true, err
 	}
 	defer session.Close()
 
-	session.Stdout = &stdout
-	session.Stderr = &stderr
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
 	err = session.Run(cmd)
-	outBytes := bytes.TrimSpace(stdout.Bytes())
-	errBytes := bytes.TrimSpace(stderr.Bytes())
-	return outBytes, errBytes, err
+	switch err.(type) {
+	case nil, *ssh.ExitError:
+		return false, err
+	case *ssh.ExitMissingError:
+		return connLost(client), err
+	}
+	return true, err
 }
 
+// connLost reports whether client's connection is gone, by sending a
+// keepalive which any live server answers, even if only to refuse it.
+func connLost(client *ssh.Client) bool {
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
+	return err != nil
+}
+
+// acquireSSHSlot blocks until fewer than RuntimeConfig.MaxSSHSessions
+// commands are running on m through SSH, then reserves a slot until the
+// returned function is called.
+func (bc *BaseCluster) acquireSSHSlot(m Machine) (release func()) {
+	max := bc.rconf.MaxSSHSessions
+	if max < 0 {
+		return func() {}
+	} else if max == 0 {
+		max = defaultMaxSSHSessions
+	}
+
+	bc.machlock.Lock()
+	slots, ok := bc.sshSlots[m.ID()]
+	if !ok {
+		slots = make(chan struct{}, max)
+		bc.sshSlots[m.ID()] = slots
+	}
+	bc.machlock.Unlock()
+
+	slots <- struct{}{}
+	return func() { <-slots }
+}
+
+// wrapShell returns cmd to be run by shell, such as "bash", rather than the
+// remote user's login shell. An empty shell leaves cmd unchanged.
+func wrapShell(shell, cmd string) string {
+	if shell == "" {
+		return cmd
+	}
+	return shell + " -c " + ShellQuote(cmd)
+}
+
+// ShellQuote quotes s as a single word for a POSIX shell.
+func ShellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// Machines returns the active machines in the order they were added.
 func (bc *BaseCluster) Machines() []Machine {
 	bc.machlock.Lock()
 	defer bc.machlock.Unlock()
-	machs := make([]Machine, 0, len(bc.machmap))
-	for _, m := range bc.machmap {
-		machs = append(machs, m)
-	}
+	machs := make([]Machine, len(bc.machs))
+	copy(machs, bc.machs)
 	return machs
 }
 
 func (bc *BaseCluster) AddMach(m Machine) {
 	bc.machlock.Lock()
 	defer bc.machlock.Unlock()
-	bc.machmap[m.ID()] = m
+	bc.machs = append(bc.machs, m)
+}
+
+// SetMachineConfig records the config m was launched with, after key
+// injection and variable substitution, for MachineConfig.
+func (bc *BaseCluster) SetMachineConfig(m Machine, c *conf.Conf) {
+	bc.machlock.Lock()
+	defer bc.machlock.Unlock()
+	bc.confs[m.ID()] = c
+}
+
+// MachineConfig returns the config m was launched with, or nil if its
+// platform did not record it. It remains available after m is destroyed.
+func (bc *BaseCluster) MachineConfig(m Machine) *conf.Conf {
+	bc.machlock.Lock()
+	defer bc.machlock.Unlock()
+	return bc.confs[m.ID()]
 }
 
 func (bc *BaseCluster) DelMach(m Machine) {
 	bc.machlock.Lock()
 	defer bc.machlock.Unlock()
-	delete(bc.machmap, m.ID())
+	for i, mach := range bc.machs {
+		if mach.ID() == m.ID() {
+			bc.machs = append(bc.machs[:i], bc.machs[i+1:]...)
+			break
+		}
+	}
+	delete(bc.sshSlots, m.ID())
 	bc.consolemap[m.ID()] = m.ConsoleOutput()
 }
 
@@ -146,6 +331,71 @@ func (bc *BaseCluster) Keys() ([]*agent.Key, error) {
 	return bc.agent.List()
 }
 
+// BootError marks a machine which was provisioned but failed to come up,
+// as opposed to a failure to provision one at all.
+type BootError struct {
+	Err error
+}
+
+func (e BootError) Error() string {
+	return e.Err.Error()
+}
+
+// RetryBoot calls boot, which provisions a machine and waits for it to
+// come up, destroying it if it doesn't. Machines which fail to come up,
+// reported by boot returning a BootError, are replaced until one succeeds
+// or boot has been retried RuntimeConfig.BootRetries times. Any other
+// error is returned immediately. Errors from every attempt are returned.
+func (bc *BaseCluster) RetryBoot(boot func() (Machine, error)) (Machine, error) {
+	var errs multierror.Error
+	for attempt := 1; ; attempt++ {
+		m, err := boot()
+		if err == nil {
+			return m, nil
+		}
+		errs = append(errs, fmt.Errorf("boot attempt %d: %v", attempt, err))
+		if _, ok := err.(BootError); !ok || attempt > bc.rconf.BootRetries {
+			return nil, errs.AsError()
+		}
+	}
+}
+
+// UserDataBytes serializes c as user-data for a platform accepting at most
+// limit bytes of it, or any amount if limit is zero. User-data over the
+// limit is gzip-compressed if the platform accepts compressed user-data
+// and RuntimeConfig.NoCompressUserData isn't set.
+func (bc *BaseCluster) UserDataBytes(c *conf.Conf, limit int, compressible bool) ([]byte, error) {
+	return fitUserData(c.Bytes(), limit, compressible && !bc.rconf.NoCompressUserData)
+}
+
+// fitUserData returns data if it fits in limit bytes, or compressed if
+// compress is set and that fits, and an error explaining how to shrink it
+// otherwise.
+func fitUserData(data []byte, limit int, compress bool) ([]byte, error) {
+	if limit <= 0 || len(data) <= limit {
+		return data, nil
+	}
+	if !compress {
+		return nil, fmt.Errorf("user-data is %d bytes, over the platform's limit of %d bytes, and can't be compressed; shrink the config, e.g. by trusting fewer CAs", len(data), limit)
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() > limit {
+		return nil, fmt.Errorf("user-data is %d bytes, over the platform's limit of %d bytes even gzip-compressed to %d bytes; shrink the config, e.g. by trusting fewer CAs", len(data), limit, buf.Len())
+	}
+	return buf.Bytes(), nil
+}
+
 func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[string]string) (*conf.Conf, error) {
 	if userdata == nil {
 		userdata = conf.Ignition(`{"ignition": {"version": "2.0.0"}}`)
@@ -172,20 +422,96 @@ func (bc *BaseCluster) RenderUserData(userdata *conf.UserData, ignitionVars map[
 		conf.CopyKeys(keys)
 	}
 
+	if len(bc.rconf.TrustedCAs) > 0 && !conf.CanAddFiles() {
+		plog.Warningf("not adding trusted CAs to a machine whose config can't carry files, such as an Ignition v1 config or a script")
+	} else if len(bc.rconf.TrustedCAs) > 0 {
+		for i, ca := range bc.rconf.TrustedCAs {
+			path := fmt.Sprintf("/etc/ssl/certs/kola-ca-%d.pem", i)
+			if err := conf.AddFile(path, ca, 0644); err != nil {
+				return nil, fmt.Errorf("adding trusted CA: %v", err)
+			}
+		}
+		conf.AddSystemdUnit("kola-update-ca-certificates.service", updateCACertsUnit, true)
+	}
+
 	return conf, nil
 }
 
-// Destroy destroys each machine in the cluster and closes the SSH agent.
+// Destroy destroys the cluster's machines concurrently, up to
+// RuntimeConfig.DestroyWorkers at a time, starting with the most recently
+// created, so machines which depend on earlier ones start going first, and
+// then closes the SSH agent. A failure to destroy one machine does not stop
+// the others from being destroyed. Machines not destroyed within
+// RuntimeConfig.DestroyTimeout are abandoned and reported in the returned
+// error; their Destroy calls keep running in the background, and the agent
+// is only closed once they return.
 func (bc *BaseCluster) Destroy() error {
+	var errLock sync.Mutex
 	var err multierror.Error
+	addErr := func(e error) {
+		errLock.Lock()
+		err = append(err, e)
+		errLock.Unlock()
+	}
 
-	for _, m := range bc.Machines() {
-		if e := m.Destroy(); e != nil {
-			err = append(err, e)
+	workers := bc.rconf.DestroyWorkers
+	if workers <= 0 {
+		workers = defaultDestroyWorkers
+	}
+	timeout := bc.rconf.DestroyTimeout
+	if timeout <= 0 {
+		timeout = defaultDestroyTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// errors are collected here rather than returned to the group, which
+	// would stop destroying the remaining machines
+	// pending tracks every m.Destroy call, including abandoned ones,
+	// which may still be using the agent
+	var pending sync.WaitGroup
+	abandoned := false
+	abandon := func(m Machine) {
+		errLock.Lock()
+		abandoned = true
+		errLock.Unlock()
+		addErr(fmt.Errorf("abandoned machine %s: not destroyed within %v", m.ID(), timeout))
+	}
+	wg := worker.NewWorkerGroup(ctx, workers)
+	machs := bc.Machines()
+	for i := len(machs) - 1; i >= 0; i-- {
+		m := machs[i]
+		destroy := func(ctx context.Context) error {
+			done := make(chan error, 1)
+			pending.Add(1)
+			go func() {
+				defer pending.Done()
+				done <- m.Destroy()
+			}()
+			select {
+			case e := <-done:
+				if e != nil {
+					addErr(e)
+				}
+			case <-ctx.Done():
+				abandon(m)
+			}
+			return nil
+		}
+		if e := wg.Start(destroy); e != nil {
+			abandon(m)
 		}
 	}
-
-	if e := bc.agent.Close(); e != nil {
+	wg.Wait()
+
+	if abandoned {
+		go func() {
+			pending.Wait()
+			if e := bc.agent.Close(); e != nil {
+				plog.Errorf("closing SSH agent of cluster %s: %v", bc.Name(), e)
+			}
+		}()
+	} else if e := bc.agent.Close(); e != nil {
 		err = append(err, e)
 	}
 
@@ -224,6 +550,16 @@ func (bc *BaseCluster) RuntimeConf() RuntimeConfig {
 	return *bc.rconf
 }
 
+// ConsolePollInterval returns the least time between requests for a
+// machine's console output, RuntimeConfig.ConsolePollInterval or a
+// default.
+func (bc *BaseCluster) ConsolePollInterval() time.Duration {
+	if bc.rconf.ConsolePollInterval > 0 {
+		return bc.rconf.ConsolePollInterval
+	}
+	return defaultConsolePollInterval
+}
+
 func (bc *BaseCluster) ConsoleOutput() map[string]string {
 	ret := map[string]string{}
 	bc.machlock.Lock()
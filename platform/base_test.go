@@ -0,0 +1,411 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeMachine records the order in which machines are destroyed.
+type fakeMachine struct {
+	id        string
+	bc        *BaseCluster
+	destroyed *[]string
+	lock      *sync.Mutex // if set, guards destroyed
+	fail      bool
+	hang      chan struct{} // if set, Destroy blocks until it is closed
+}
+
+func (m *fakeMachine) ID() string                      { return m.id }
+func (m *fakeMachine) IP() string                      { return "" }
+func (m *fakeMachine) PrivateIP() string               { return "" }
+func (m *fakeMachine) DNSName() string                 { return "" }
+func (m *fakeMachine) SSHClient() (*ssh.Client, error) { return nil, fmt.Errorf("no ssh") }
+func (m *fakeMachine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return nil, fmt.Errorf("no ssh")
+}
+func (m *fakeMachine) SSH(cmd string) ([]byte, []byte, error) { return nil, nil, fmt.Errorf("no ssh") }
+func (m *fakeMachine) Reboot() error                          { return nil }
+func (m *fakeMachine) ConsoleOutput() string                  { return "" }
+
+func (m *fakeMachine) SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return nil, nil, fmt.Errorf("no ssh")
+}
+
+func (m *fakeMachine) WaitForUnit(unit, state string, timeout time.Duration) error {
+	return fmt.Errorf("no ssh")
+}
+
+func (m *fakeMachine) OSRelease() (map[string]string, error) {
+	return nil, fmt.Errorf("no ssh")
+}
+
+func (m *fakeMachine) MemInfo() (*MemInfo, error) {
+	return nil, fmt.Errorf("no ssh")
+}
+
+func (m *fakeMachine) DiskUsage(path string) (*DiskUsage, error) {
+	return nil, fmt.Errorf("no ssh")
+}
+
+func (m *fakeMachine) Destroy() error {
+	if m.hang != nil {
+		<-m.hang
+	}
+	if m.lock != nil {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+	}
+	*m.destroyed = append(*m.destroyed, m.id)
+	m.bc.DelMach(m)
+	if m.fail {
+		return fmt.Errorf("%s failed", m.id)
+	}
+	return nil
+}
+
+func TestDestroyOrder(t *testing.T) {
+	// a single worker destroys machines one at a time
+	bc, err := NewBaseCluster("test", &RuntimeConfig{DestroyWorkers: 1}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var destroyed []string
+	for _, id := range []string{"a", "b", "c", "d"} {
+		bc.AddMach(&fakeMachine{id: id, bc: bc, destroyed: &destroyed, fail: id == "c"})
+	}
+
+	var ids []string
+	for _, m := range bc.Machines() {
+		ids = append(ids, m.ID())
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b", "c", "d"}) {
+		t.Errorf("Machines() not in creation order: %v", ids)
+	}
+
+	if err := bc.Destroy(); err == nil {
+		t.Errorf("expected error from failed machine")
+	}
+	if !reflect.DeepEqual(destroyed, []string{"d", "c", "b", "a"}) {
+		t.Errorf("machines destroyed in wrong order: %v", destroyed)
+	}
+	if len(bc.Machines()) != 0 {
+		t.Errorf("machines left after Destroy: %v", bc.Machines())
+	}
+}
+
+func TestDestroyTimeout(t *testing.T) {
+	bc, err := NewBaseCluster("test", &RuntimeConfig{DestroyTimeout: 100 * time.Millisecond}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lock sync.Mutex
+	var destroyed []string
+	hang := make(chan struct{})
+	defer close(hang)
+	for _, id := range []string{"a", "b", "c"} {
+		m := &fakeMachine{id: id, bc: bc, destroyed: &destroyed, lock: &lock}
+		if id == "b" {
+			m.hang = hang
+		}
+		bc.AddMach(m)
+	}
+
+	start := time.Now()
+	if err := bc.Destroy(); err == nil {
+		t.Errorf("expected error from hung machine")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Destroy blocked for %v", elapsed)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	sort.Strings(destroyed)
+	if !reflect.DeepEqual(destroyed, []string{"a", "c"}) {
+		t.Errorf("expected a and c to be destroyed, got %v", destroyed)
+	}
+}
+
+func TestMachineConfig(t *testing.T) {
+	bc, err := NewBaseCluster("test", &RuntimeConfig{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := bc.RenderUserData(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var destroyed []string
+	m := &fakeMachine{id: "a", bc: bc, destroyed: &destroyed}
+	if bc.MachineConfig(m) != nil {
+		t.Errorf("config of unknown machine is not nil")
+	}
+	bc.SetMachineConfig(m, c)
+	bc.AddMach(m)
+	if err := bc.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if bc.MachineConfig(m) != c {
+		t.Errorf("config not retained after Destroy")
+	}
+	if !strings.Contains(bc.MachineConfig(m).String(), "ssh-rsa ") {
+		t.Errorf("rendered config lacks the injected SSH key: %s", c)
+	}
+}
+
+func TestWrapShell(t *testing.T) {
+	for _, tt := range []struct {
+		shell, cmd, want string
+	}{
+		{"", "echo hi", "echo hi"},
+		{"bash", "[[ -n x ]] && echo hi", "bash -c '[[ -n x ]] && echo hi'"},
+		{"sh", "echo 'hi there'", `sh -c 'echo '\''hi there'\'''`},
+	} {
+		if got := wrapShell(tt.shell, tt.cmd); got != tt.want {
+			t.Errorf("wrapShell(%q, %q) = %q, want %q", tt.shell, tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestSSHSlots(t *testing.T) {
+	bc, err := NewBaseCluster("test", &RuntimeConfig{MaxSSHSessions: 2}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bc.Destroy()
+
+	m := &fakeMachine{id: "a"}
+	release1 := bc.acquireSSHSlot(m)
+	release2 := bc.acquireSSHSlot(m)
+
+	acquired := make(chan func())
+	go func() {
+		acquired <- bc.acquireSSHSlot(m)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired more SSH slots than the limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// other machines are unaffected
+	bc.acquireSSHSlot(&fakeMachine{id: "b"})()
+
+	release1()
+	select {
+	case release3 := <-acquired:
+		release3()
+	case <-time.After(5 * time.Second):
+		t.Fatal("SSH slot not acquired after release")
+	}
+	release2()
+}
+
+func TestFitUserData(t *testing.T) {
+	data := []byte(strings.Repeat("compressible ", 100))
+
+	out, err := fitUserData(data, 0, false)
+	if err != nil || string(out) != string(data) {
+		t.Errorf("unlimited: got %d bytes, %v", len(out), err)
+	}
+	out, err = fitUserData(data, len(data), false)
+	if err != nil || string(out) != string(data) {
+		t.Errorf("at limit: got %d bytes, %v", len(out), err)
+	}
+
+	if _, err := fitUserData(data, 100, false); err == nil {
+		t.Error("uncompressible user-data over the limit was accepted")
+	}
+	out, err = fitUserData(data, 100, true)
+	if err != nil {
+		t.Fatalf("compressing: %v", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) {
+		t.Errorf("decompressed %q, expected %q", got, data)
+	}
+
+	if _, err := fitUserData(data, 10, true); err == nil {
+		t.Error("user-data over the limit even compressed was accepted")
+	}
+}
+
+// startSSHServer serves SSH on a local port, answering every command by
+// calling handle with the session's channel and the underlying
+// connection, and returns a client connected to it.
+func startSSHServer(t *testing.T, handle func(ch ssh.Channel, conn net.Conn)) *ssh.Client {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{NoClientAuth: true}
+	config.AddHostKey(signer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		defer l.Close()
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := ssh.NewServerConn(conn, config)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		for newChannel := range chans {
+			ch, chReqs, err := newChannel.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				for req := range chReqs {
+					req.Reply(req.Type == "exec", nil)
+					if req.Type == "exec" {
+						go handle(ch, conn)
+					}
+				}
+			}()
+		}
+	}()
+
+	client, err := ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{User: "core"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestRunSessionRetry(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		handle func(ch ssh.Channel, conn net.Conn)
+		err    bool
+		retry  bool
+	}{
+		{
+			name: "exit 0",
+			handle: func(ch ssh.Channel, conn net.Conn) {
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{0}))
+				ch.Close()
+			},
+		},
+		{
+			name: "exit 1",
+			handle: func(ch ssh.Channel, conn net.Conn) {
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{1}))
+				ch.Close()
+			},
+			err: true,
+		},
+		{
+			// the command is killed but the server is still up
+			name: "killed",
+			handle: func(ch ssh.Channel, conn net.Conn) {
+				ch.Close()
+			},
+			err: true,
+		},
+		{
+			// the connection drops in the middle of the command
+			name: "dropped",
+			handle: func(ch ssh.Channel, conn net.Conn) {
+				io.WriteString(ch, "partial output")
+				conn.Close()
+			},
+			err:   true,
+			retry: true,
+		},
+	} {
+		client := startSSHServer(t, tt.handle)
+		var stdout, stderr bytes.Buffer
+		retry, err := runSession(client, "true", nil, &stdout, &stderr)
+		client.Close()
+		if (err != nil) != tt.err {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if retry != tt.retry {
+			t.Errorf("%s: retry = %v, expected %v (error %v)", tt.name, retry, tt.retry, err)
+		}
+	}
+}
+
+func TestRetryBoot(t *testing.T) {
+	for _, tt := range []struct {
+		retries  int
+		failures int
+		err      error
+		attempts int
+		ok       bool
+	}{
+		{retries: 0, failures: 0, err: BootError{Err: fmt.Errorf("no IP")}, attempts: 1, ok: true},
+		{retries: 0, failures: 1, err: BootError{Err: fmt.Errorf("no IP")}, attempts: 1, ok: false},
+		{retries: 2, failures: 2, err: BootError{Err: fmt.Errorf("no IP")}, attempts: 3, ok: true},
+		{retries: 2, failures: 5, err: BootError{Err: fmt.Errorf("no IP")}, attempts: 3, ok: false},
+		{retries: 2, failures: 5, err: fmt.Errorf("no IP"), attempts: 1, ok: false},
+	} {
+		bc := &BaseCluster{rconf: &RuntimeConfig{BootRetries: tt.retries}}
+		attempts := 0
+		m, err := bc.RetryBoot(func() (Machine, error) {
+			attempts++
+			if attempts <= tt.failures {
+				return nil, tt.err
+			}
+			return &fakeMachine{id: "m"}, nil
+		})
+		if attempts != tt.attempts {
+			t.Errorf("%+v: made %d attempts", tt, attempts)
+		}
+		if tt.ok && (err != nil || m == nil) {
+			t.Errorf("%+v: got %v, %v", tt, m, err)
+		} else if !tt.ok && (err == nil || !strings.Contains(err.Error(), fmt.Sprintf("boot attempt %d: no IP", tt.attempts))) {
+			t.Errorf("%+v: got error %v", tt, err)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// BlockDevice describes a whole disk attached to a machine.
+type BlockDevice struct {
+	Name   string // kernel name, e.g. "sdb"
+	Size   int64  // in bytes
+	Serial string
+	Model  string
+}
+
+// BlockDevices lists the disks (not partitions) attached to m, so tests can
+// verify that extra devices requested at launch are present.
+func BlockDevices(m Machine) ([]BlockDevice, error) {
+	out, stderr, err := m.SSH("lsblk --json --bytes --nodeps --output NAME,SIZE,TYPE,SERIAL,MODEL")
+	if err != nil {
+		return nil, fmt.Errorf("lsblk failed: %v: %s", err, stderr)
+	}
+	return parseBlockDevices(out)
+}
+
+func parseBlockDevices(out []byte) ([]BlockDevice, error) {
+	var lsblk struct {
+		Blockdevices []struct {
+			Name   string      `json:"name"`
+			Size   json.Number `json:"size"`
+			Type   string      `json:"type"`
+			Serial *string     `json:"serial"`
+			Model  *string     `json:"model"`
+		} `json:"blockdevices"`
+	}
+	if err := json.Unmarshal(out, &lsblk); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal lsblk output: %v", err)
+	}
+
+	var devs []BlockDevice
+	for _, d := range lsblk.Blockdevices {
+		if d.Type != "disk" {
+			continue
+		}
+		size, err := d.Size.Int64()
+		if err != nil {
+			return nil, fmt.Errorf("invalid size %q for %s: %v", d.Size, d.Name, err)
+		}
+		dev := BlockDevice{Name: d.Name, Size: size}
+		if d.Serial != nil {
+			dev.Serial = strings.TrimSpace(*d.Serial)
+		}
+		if d.Model != nil {
+			dev.Model = strings.TrimSpace(*d.Model)
+		}
+		devs = append(devs, dev)
+	}
+	return devs, nil
+}
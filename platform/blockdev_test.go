@@ -0,0 +1,59 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseBlockDevices(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   string
+		want []BlockDevice
+	}{
+		{
+			name: "numeric sizes",
+			in: `{"blockdevices": [
+				{"name":"sda", "size":12884901888, "type":"disk", "serial":null, "model":"PersistentDisk  "},
+				{"name":"nvme0n1", "size":402653184000, "type":"disk", "serial":"local-ssd-0", "model":"nvme_card"},
+				{"name":"loop0", "size":1048576, "type":"loop", "serial":null, "model":null}
+			]}`,
+			want: []BlockDevice{
+				{Name: "sda", Size: 12884901888, Model: "PersistentDisk"},
+				{Name: "nvme0n1", Size: 402653184000, Serial: "local-ssd-0", Model: "nvme_card"},
+			},
+		},
+		{
+			name: "string sizes",
+			in:   `{"blockdevices": [{"name":"vda", "size":"8589934592", "type":"disk", "serial":null, "model":null}]}`,
+			want: []BlockDevice{{Name: "vda", Size: 8589934592}},
+		},
+	} {
+		got, err := parseBlockDevices([]byte(tt.in))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := parseBlockDevices([]byte(`{"blockdevices": [{"name":"sda", "size":"big", "type":"disk"}]}`)); err == nil {
+		t.Errorf("invalid size was accepted")
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GuestTime returns the time of m's system clock.
+func GuestTime(m Machine) (time.Time, error) {
+	out, stderr, err := m.SSH("date +%s.%N")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading time of %s: %v: %s", m.ID(), err, stderr)
+	}
+	return parseUnixTime(string(out))
+}
+
+// SetGuestTime sets m's system clock to t, e.g. to skew it before
+// checking that time synchronization corrects it. A running time
+// synchronization service may set it back at any moment.
+func SetGuestTime(m Machine, t time.Time) error {
+	cmd := fmt.Sprintf("sudo date -u -s @%d.%09d", t.Unix(), t.Nanosecond())
+	if out, stderr, err := m.SSH(cmd); err != nil {
+		return fmt.Errorf("setting time of %s: %v: %s%s", m.ID(), err, out, stderr)
+	}
+	return nil
+}
+
+// ClockSkew estimates how far m's system clock is ahead of the host's,
+// negative if it is behind. The guest time is compared with the host
+// time halfway through the command reading it, so the estimate is only
+// as accurate as half the command's round trip.
+func ClockSkew(m Machine) (time.Duration, error) {
+	start := time.Now()
+	guest, err := GuestTime(m)
+	if err != nil {
+		return 0, err
+	}
+	host := start.Add(time.Since(start) / 2)
+	return guest.Sub(host), nil
+}
+
+// parseUnixTime parses seconds since the epoch with an optional
+// fraction, as printed by `date +%s.%N`.
+func parseUnixTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	parts := strings.SplitN(s, ".", 2)
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad time %q", s)
+	}
+	var nsec int64
+	if len(parts) == 2 {
+		frac := parts[1]
+		if len(frac) == 0 || len(frac) > 9 {
+			return time.Time{}, fmt.Errorf("bad time %q", s)
+		}
+		frac += strings.Repeat("0", 9-len(frac))
+		if nsec, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, fmt.Errorf("bad time %q", s)
+		}
+	}
+	return time.Unix(sec, nsec), nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseUnixTime(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want time.Time
+	}{
+		{"1500000000.123456789\n", time.Unix(1500000000, 123456789)},
+		{"1500000000.5", time.Unix(1500000000, 500000000)},
+		{"1500000000", time.Unix(1500000000, 0)},
+	} {
+		got, err := parseUnixTime(tt.in)
+		if err != nil {
+			t.Errorf("parsing %q: %v", tt.in, err)
+		} else if !got.Equal(tt.want) {
+			t.Errorf("parsing %q: got %v, expected %v", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{"", "now", "1500000000.", "1500000000.1234567890"} {
+		if _, err := parseUnixTime(in); err == nil {
+			t.Errorf("parsed bad time %q", in)
+		}
+	}
+}
@@ -15,9 +15,13 @@
 package conf
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net/url"
+	"reflect"
+	"sort"
 	"strings"
 
 	ct "github.com/coreos/container-linux-config-transpiler/config"
@@ -31,6 +35,7 @@ import (
 	v21 "github.com/coreos/ignition/config/v2_1"
 	v21types "github.com/coreos/ignition/config/v2_1/types"
 	"github.com/coreos/pkg/capnslog"
+	"github.com/vincent-petithory/dataurl"
 	"golang.org/x/crypto/ssh/agent"
 )
 
@@ -51,6 +56,13 @@ var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/conf"
 type UserData struct {
 	kind kind
 	data string
+
+	// ignitionVersion is the Ignition spec version Container Linux
+	// configs are transpiled to; empty means the transpiler's default.
+	ignitionVersion string
+
+	// extensions modify the config after it is rendered.
+	extensions []func(*Conf) error
 }
 
 // Conf is a configuration for a Container Linux machine. It may be either a
@@ -125,6 +137,48 @@ func (u *UserData) Subst(old, new string) *UserData {
 	return &ret
 }
 
+// TargetIgnition returns a new UserData which renders Container Linux configs
+// as Ignition spec version "2.0" or "2.1" (the default). Transpiling for 2.0
+// fails if the config uses features that 2.0 lacks. It has no effect on
+// other kinds of userdata.
+func (u *UserData) TargetIgnition(version string) *UserData {
+	ret := *u
+	ret.ignitionVersion = version
+	return &ret
+}
+
+// withExtension returns a new UserData which applies f to its Conf once
+// rendered.
+func (u *UserData) withExtension(f func(*Conf) error) *UserData {
+	ret := *u
+	ret.extensions = append(append([]func(*Conf) error{}, u.extensions...), f)
+	return &ret
+}
+
+// WithSystemdDropin returns a new UserData which adds the dropin name with
+// contents to the systemd unit, as Conf.AddSystemdDropin does.
+func (u *UserData) WithSystemdDropin(unit, name, contents string) *UserData {
+	return u.withExtension(func(c *Conf) error {
+		return c.AddSystemdDropin(unit, name, contents)
+	})
+}
+
+// WithUnitEnvironment returns a new UserData which sets the environment
+// variables env for the systemd unit, as Conf.AddUnitEnvironment does.
+func (u *UserData) WithUnitEnvironment(unit string, env map[string]string) *UserData {
+	return u.withExtension(func(c *Conf) error {
+		return c.AddUnitEnvironment(unit, env)
+	})
+}
+
+// WithUnitCredential returns a new UserData which delivers a secret to the
+// systemd unit, as Conf.AddUnitCredential does.
+func (u *UserData) WithUnitCredential(unit, name, value string) *UserData {
+	return u.withExtension(func(c *Conf) error {
+		return c.AddUnitCredential(unit, name, value)
+	})
+}
+
 func (u *UserData) IsIgnition() bool {
 	return u.kind == kindIgnition
 }
@@ -136,7 +190,12 @@ func (u *UserData) Render(ctPlatform string) (*Conf, error) {
 
 	switch u.kind {
 	case kindEmpty:
-		// empty, noop
+		// there must be a config to extend
+		if len(u.extensions) > 0 {
+			c.ignitionV21 = &v21types.Config{
+				Ignition: v21types.Ignition{Version: "2.1.0"},
+			}
+		}
 	case kindCloudConfig:
 		var err error
 		c.cloudconfig, err = cci.NewCloudConfig(u.data)
@@ -192,14 +251,178 @@ func (u *UserData) Render(ctPlatform string) (*Conf, error) {
 			plog.Warningf("rendering Container Linux config: %s", report)
 		}
 
-		c.ignitionV21 = &ignc
+		switch u.ignitionVersion {
+		case "", "2.1":
+			c.ignitionV21 = &ignc
+		case "2.0":
+			ignc2, err := convertToV2(ignc)
+			if err != nil {
+				return nil, fmt.Errorf("rendering Container Linux config: %v", err)
+			}
+			c.ignitionV2 = &ignc2
+		default:
+			return nil, fmt.Errorf("unsupported Ignition version %q for Container Linux config", u.ignitionVersion)
+		}
 	default:
 		panic("invalid kind")
 	}
 
+	for _, extend := range u.extensions {
+		if err := extend(c); err != nil {
+			return nil, err
+		}
+	}
+
 	return c, nil
 }
 
+// convertToV2 expresses a transpiled config as Ignition 2.0. It fails if the
+// config sets any field which 2.0 lacks.
+func convertToV2(cfg v21types.Config) (v2types.Config, error) {
+	buf, err := json.Marshal(cfg)
+	if err != nil {
+		return v2types.Config{}, err
+	}
+	var tree map[string]interface{}
+	if err := json.Unmarshal(buf, &tree); err != nil {
+		return v2types.Config{}, err
+	}
+	pruneEmpty(tree)
+	tree["ignition"] = map[string]interface{}{"version": "2.0.0"}
+	if buf, err = json.Marshal(tree); err != nil {
+		return v2types.Config{}, err
+	}
+
+	if err := checkFields(tree, reflect.TypeOf(v2types.Config{}), ""); err != nil {
+		return v2types.Config{}, fmt.Errorf("config cannot be expressed as Ignition 2.0: %v", err)
+	}
+
+	ignc, report, err := v2.Parse(buf)
+	if err != nil {
+		return v2types.Config{}, fmt.Errorf("config is not valid Ignition 2.0: %v: %s", err, report)
+	}
+	return ignc, nil
+}
+
+// checkFields returns an error if the decoded JSON value v has an object
+// key which doesn't name a field of the corresponding struct in t, the way
+// encoding/json matches them, so that fields of a newer spec version aren't
+// silently dropped.
+func checkFields(v interface{}, t reflect.Type, path string) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			for key, value := range v {
+				field, ok := jsonField(t, key)
+				if !ok {
+					return fmt.Errorf("unknown field %q", path+key)
+				}
+				if err := checkFields(value, field.Type, path+key+"."); err != nil {
+					return err
+				}
+			}
+		case reflect.Map:
+			for key, value := range v {
+				if err := checkFields(value, t.Elem(), path+key+"."); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		if t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			for i, elem := range v {
+				if err := checkFields(elem, t.Elem(), fmt.Sprintf("%s%d.", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonField finds the field of struct type t, including those of embedded
+// structs, which encoding/json decodes key into.
+func jsonField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		name := f.Name
+		if tag != "" {
+			name = tag
+		}
+		if f.Anonymous && tag == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				if sf, ok := jsonField(ft, key); ok {
+					return sf, true
+				}
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if strings.EqualFold(name, key) {
+			return f, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// pruneEmpty recursively removes null values and empty objects, arrays, and
+// strings from a decoded JSON object, so that unset fields of a newer spec
+// version aren't mistaken for unsupported ones.
+func pruneEmpty(obj map[string]interface{}) {
+	for key, value := range obj {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			pruneEmpty(v)
+			if len(v) == 0 {
+				delete(obj, key)
+			}
+		case []interface{}:
+			for _, elem := range v {
+				if m, ok := elem.(map[string]interface{}); ok {
+					pruneEmpty(m)
+				}
+			}
+			if len(v) == 0 {
+				delete(obj, key)
+			}
+		case string:
+			if v == "" {
+				delete(obj, key)
+			}
+		case nil:
+			delete(obj, key)
+		}
+	}
+}
+
+// IgnitionVersion returns the Ignition spec version of the config, "1",
+// "2.0", or "2.1", or an empty string if it isn't an Ignition config.
+func (c *Conf) IgnitionVersion() string {
+	switch {
+	case c.ignitionV1 != nil:
+		return "1"
+	case c.ignitionV2 != nil:
+		return "2.0"
+	case c.ignitionV21 != nil:
+		return "2.1"
+	}
+	return ""
+}
+
 // String returns the string representation of the userdata in Conf.
 func (c *Conf) String() string {
 	if c.ignitionV1 != nil {
@@ -274,6 +497,168 @@ func (c *Conf) AddSystemdUnit(name, contents string, enable bool) {
 	}
 }
 
+func (c *Conf) addSystemdDropinV2(unit, name, contents string) {
+	dropin := v2types.SystemdUnitDropIn{
+		Name:     v2types.SystemdUnitDropInName(name),
+		Contents: contents,
+	}
+	for i, u := range c.ignitionV2.Systemd.Units {
+		if string(u.Name) == unit {
+			c.ignitionV2.Systemd.Units[i].DropIns = append(u.DropIns, dropin)
+			return
+		}
+	}
+	c.ignitionV2.Systemd.Units = append(c.ignitionV2.Systemd.Units, v2types.SystemdUnit{
+		Name:    v2types.SystemdUnitName(unit),
+		DropIns: []v2types.SystemdUnitDropIn{dropin},
+	})
+}
+
+func (c *Conf) addSystemdDropinV21(unit, name, contents string) {
+	dropin := v21types.Dropin{
+		Name:     name,
+		Contents: contents,
+	}
+	for i, u := range c.ignitionV21.Systemd.Units {
+		if u.Name == unit {
+			c.ignitionV21.Systemd.Units[i].Dropins = append(u.Dropins, dropin)
+			return
+		}
+	}
+	c.ignitionV21.Systemd.Units = append(c.ignitionV21.Systemd.Units, v21types.Unit{
+		Name:    unit,
+		Dropins: []v21types.Dropin{dropin},
+	})
+}
+
+func (c *Conf) addSystemdDropinCloudConfig(unit, name, contents string) {
+	dropin := cci.UnitDropIn{
+		Name:    name,
+		Content: contents,
+	}
+	for i, u := range c.cloudconfig.CoreOS.Units {
+		if u.Name == unit {
+			c.cloudconfig.CoreOS.Units[i].DropIns = append(u.DropIns, dropin)
+			return
+		}
+	}
+	c.cloudconfig.CoreOS.Units = append(c.cloudconfig.CoreOS.Units, cci.Unit{
+		Name:    unit,
+		DropIns: []cci.UnitDropIn{dropin},
+	})
+}
+
+// AddSystemdDropin adds the dropin name with the given contents to the
+// systemd unit, which need not otherwise be in the configuration. Ignition
+// v1 configs and scripts are not supported.
+func (c *Conf) AddSystemdDropin(unit, name, contents string) error {
+	if c.ignitionV2 != nil {
+		c.addSystemdDropinV2(unit, name, contents)
+	} else if c.ignitionV21 != nil {
+		c.addSystemdDropinV21(unit, name, contents)
+	} else if c.cloudconfig != nil {
+		c.addSystemdDropinCloudConfig(unit, name, contents)
+	} else if c.ignitionV1 != nil || c.script != "" {
+		return fmt.Errorf("adding dropins is not supported for this config type")
+	}
+	return nil
+}
+
+// AddUnitEnvironment sets the environment variables env for the systemd
+// unit with a dropin. It may be used once per unit.
+func (c *Conf) AddUnitEnvironment(unit string, env map[string]string) error {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var contents bytes.Buffer
+	contents.WriteString("[Service]\n")
+	for _, k := range keys {
+		fmt.Fprintf(&contents, "Environment=%s\n", systemdQuote(k+"="+env[k]))
+	}
+	return c.AddSystemdDropin(unit, "10-kola-environment.conf", contents.String())
+}
+
+// AddUnitCredential writes the secret value to a file readable only by
+// root, and points the systemd unit at it the way systemd's own
+// credentials do: the file is $CREDENTIALS_DIRECTORY/name in the unit's
+// environment.
+func (c *Conf) AddUnitCredential(unit, name, value string) error {
+	dir := "/etc/kola/credentials/" + unit
+	if err := c.AddFile(dir+"/"+name, value, 0400); err != nil {
+		return err
+	}
+	return c.AddSystemdDropin(unit, "10-kola-credential-"+name+".conf", fmt.Sprintf("[Service]\nEnvironment=CREDENTIALS_DIRECTORY=%s\n", dir))
+}
+
+// systemdQuote quotes s as a single word in a systemd unit setting.
+func systemdQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%")
+	return `"` + r.Replace(s) + `"`
+}
+
+func (c *Conf) addFileV2(path, contents string, mode int) error {
+	u, err := url.Parse(dataurl.EncodeBytes([]byte(contents)))
+	if err != nil {
+		return err
+	}
+	c.ignitionV2.Storage.Files = append(c.ignitionV2.Storage.Files, v2types.File{
+		Filesystem: "root",
+		Path:       v2types.Path(path),
+		Contents: v2types.FileContents{
+			Source: v2types.Url(*u),
+		},
+		Mode: v2types.FileMode(mode),
+	})
+	return nil
+}
+
+func (c *Conf) addFileV21(path, contents string, mode int) {
+	c.ignitionV21.Storage.Files = append(c.ignitionV21.Storage.Files, v21types.File{
+		Node: v21types.Node{
+			Filesystem: "root",
+			Path:       path,
+		},
+		FileEmbedded1: v21types.FileEmbedded1{
+			Contents: v21types.FileContents{
+				Source: dataurl.EncodeBytes([]byte(contents)),
+			},
+			Mode: mode,
+		},
+	})
+}
+
+func (c *Conf) addFileCloudConfig(path, contents string, mode int) {
+	c.cloudconfig.WriteFiles = append(c.cloudconfig.WriteFiles, cci.File{
+		Content:            contents,
+		Path:               path,
+		RawFilePermissions: fmt.Sprintf("%#o", mode),
+	})
+}
+
+// AddFile adds a file to the configuration, to be written to path on the
+// root filesystem with the given contents and permissions. Ignition v1
+// configs and scripts are not supported.
+func (c *Conf) AddFile(path, contents string, mode int) error {
+	if c.ignitionV2 != nil {
+		return c.addFileV2(path, contents, mode)
+	} else if c.ignitionV21 != nil {
+		c.addFileV21(path, contents, mode)
+	} else if c.cloudconfig != nil {
+		c.addFileCloudConfig(path, contents, mode)
+	} else if !c.CanAddFiles() {
+		return fmt.Errorf("adding files is not supported for this config type")
+	}
+	return nil
+}
+
+// CanAddFiles reports whether AddFile supports the config's type.
+func (c *Conf) CanAddFiles() bool {
+	return c.ignitionV1 == nil && c.script == ""
+}
+
 func (c *Conf) copyKeysIgnitionV1(keys []*agent.Key) {
 	c.ignitionV1.Passwd.Users = append(c.ignitionV1.Passwd.Users, v1types.User{
 		Name:              "core",
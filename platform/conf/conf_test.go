@@ -15,10 +15,14 @@
 package conf
 
 import (
+	"encoding/json"
 	"net"
+	"reflect"
 	"strings"
 	"testing"
 
+	v2types "github.com/coreos/ignition/config/v2_0/types"
+
 	"github.com/coreos/mantle/network"
 )
 
@@ -58,3 +62,175 @@ func TestConfCopyKey(t *testing.T) {
 		}
 	}
 }
+
+func TestConfAddFile(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(""),
+		Ignition(`{ "ignition": { "version": "2.1.0" } }`),
+		Ignition(`{ "ignition": { "version": "2.0.0" } }`),
+		CloudConfig("#cloud-config"),
+	}
+
+	for i, tt := range tests {
+		conf, err := tt.Render("")
+		if err != nil {
+			t.Errorf("failed to parse config %d: %v", i, err)
+			continue
+		}
+
+		if err := conf.AddFile("/etc/kola-test", "hello", 0644); err != nil {
+			t.Errorf("failed to add file to config %d: %v", i, err)
+			continue
+		}
+
+		str := conf.String()
+
+		if !strings.Contains(str, "/etc/kola-test") {
+			t.Errorf("file not found in config %d: %s", i, str)
+		}
+	}
+
+	conf, err := Ignition(`{ "ignitionVersion": 1 }`).Render("")
+	if err != nil {
+		t.Fatalf("failed to parse v1 config: %v", err)
+	}
+	if conf.CanAddFiles() {
+		t.Errorf("Ignition v1 config claims to support adding files")
+	}
+	if err := conf.AddFile("/etc/kola-test", "hello", 0644); err == nil {
+		t.Errorf("adding a file to an Ignition v1 config succeeded")
+	}
+}
+
+func TestTargetIgnition(t *testing.T) {
+	clc := ContainerLinuxConfig(`
+systemd:
+  units:
+    - name: kola.service
+      enable: true
+      contents: |
+        [Service]
+        ExecStart=/bin/true
+        [Install]
+        WantedBy=multi-user.target
+storage:
+  files:
+    - path: /etc/kola
+      filesystem: root
+      mode: 0644
+      contents:
+        inline: hello
+`)
+
+	for _, tt := range []struct {
+		version string
+		want    string
+	}{
+		{"", "2.1"},
+		{"2.1", "2.1"},
+		{"2.0", "2.0"},
+	} {
+		conf, err := clc.TargetIgnition(tt.version).Render("")
+		if err != nil {
+			t.Errorf("rendering for %q: %v", tt.version, err)
+			continue
+		}
+		if got := conf.IgnitionVersion(); got != tt.want {
+			t.Errorf("rendering for %q produced version %q, want %q", tt.version, got, tt.want)
+		}
+		str := conf.String()
+		if !strings.Contains(str, "/etc/kola") || !strings.Contains(str, "kola.service") {
+			t.Errorf("rendering for %q lost content: %s", tt.version, str)
+		}
+	}
+
+	// links were added in Ignition 2.1
+	links := ContainerLinuxConfig(`
+storage:
+  links:
+    - path: /etc/kola-link
+      filesystem: root
+      target: /etc/kola
+`)
+	if _, err := links.TargetIgnition("2.0").Render(""); err == nil {
+		t.Errorf("config with links rendered as Ignition 2.0")
+	}
+
+	if _, err := clc.TargetIgnition("3.0").Render(""); err == nil {
+		t.Errorf("rendering for an unsupported version succeeded")
+	}
+}
+
+func TestCheckFields(t *testing.T) {
+	for _, tt := range []struct {
+		config string
+		ok     bool
+	}{
+		{`{"ignition": {"version": "2.0.0"}, "storage": {"files": [{"filesystem": "root", "path": "/etc/kola"}]}}`, true},
+		{`{"Ignition": {"Version": "2.0.0"}}`, true},
+		{`{"storage": {"links": [{"path": "/etc/kola"}]}}`, false},
+		{`{"storage": {"files": [{"path": "/etc/kola", "overwrite": true}]}}`, false},
+		{`{"systemd": {"units": [{"name": "kola.service", "dropins": [{"name": "a.conf", "unknown": "x"}]}]}}`, false},
+	} {
+		var tree map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.config), &tree); err != nil {
+			t.Fatal(err)
+		}
+		err := checkFields(tree, reflect.TypeOf(v2types.Config{}), "")
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.config, err)
+		} else if !tt.ok && err == nil {
+			t.Errorf("%s: unknown field not detected", tt.config)
+		}
+	}
+}
+
+func TestConfAddSystemdDropin(t *testing.T) {
+	tests := []*UserData{
+		ContainerLinuxConfig(`
+systemd:
+  units:
+    - name: docker.service
+      enable: true
+`),
+		Ignition(`{ "ignition": { "version": "2.1.0" } }`),
+		Ignition(`{ "ignition": { "version": "2.0.0" } }`),
+		CloudConfig("#cloud-config"),
+		Empty(),
+	}
+
+	for i, tt := range tests {
+		ud := tt.WithUnitEnvironment("docker.service", map[string]string{
+			"DOCKER_OPTS": "--userns-remap=dockremap",
+		}).WithUnitCredential("docker.service", "token", "hunter2")
+		conf, err := ud.Render("")
+		if err != nil {
+			t.Errorf("failed to render config %d: %v", i, err)
+			continue
+		}
+
+		str := conf.String()
+		for _, want := range []string{
+			"10-kola-environment.conf",
+			`Environment=\"DOCKER_OPTS=--userns-remap=dockremap\"`,
+			"/etc/kola/credentials/docker.service/token",
+			"CREDENTIALS_DIRECTORY=/etc/kola/credentials/docker.service",
+		} {
+			// cloud-config is YAML, so quotes aren't escaped
+			if conf.cloudconfig != nil {
+				want = strings.Replace(want, `\"`, `"`, -1)
+			}
+			if !strings.Contains(str, want) {
+				t.Errorf("%q not found in config %d: %s", want, i, str)
+			}
+		}
+	}
+
+	conf, err := Ignition(`{ "ignitionVersion": 1 }`).Render("")
+	if err != nil {
+		t.Fatalf("failed to parse v1 config: %v", err)
+	}
+	if err := conf.AddSystemdDropin("docker.service", "10-kola.conf", "[Service]\n"); err == nil {
+		t.Errorf("adding a dropin to an Ignition v1 config succeeded")
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// truncatedNote prefixes console output that has been cut down to size.
+const truncatedNote = "[... %d bytes of console output truncated ...]\n"
+
+// TruncateConsole returns at most the last max bytes of console output,
+// noting how much was dropped. If max is not positive the output is
+// returned unchanged.
+func TruncateConsole(output string, max int) string {
+	if max <= 0 || len(output) <= max {
+		return output
+	}
+	dropped := len(output) - max
+	return fmt.Sprintf(truncatedNote, dropped) + output[dropped:]
+}
+
+// ReadConsole reads the console log at path, keeping only the last max
+// bytes without reading the rest of the file into memory. If max is not
+// positive the whole file is read.
+func ReadConsole(path string, max int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	var dropped int64
+	if max > 0 && st.Size() > int64(max) {
+		dropped = st.Size() - int64(max)
+		if _, err := f.Seek(dropped, io.SeekStart); err != nil {
+			return "", err
+		}
+	}
+
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	if dropped > 0 {
+		return fmt.Sprintf(truncatedNote, dropped) + string(buf), nil
+	}
+	return string(buf), nil
+}
+
+// ConsoleBuffer accumulates streamed console output, discarding the
+// oldest data once it holds more than max bytes.
+type ConsoleBuffer struct {
+	max     int
+	buf     []byte
+	dropped int
+}
+
+// NewConsoleBuffer returns an io.Writer which retains at most the last max
+// bytes written to it. If max is not positive everything is retained.
+func NewConsoleBuffer(max int) *ConsoleBuffer {
+	return &ConsoleBuffer{max: max}
+}
+
+func (c *ConsoleBuffer) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	// trim in batches so we don't copy on every write
+	if c.max > 0 && len(c.buf) > 2*c.max {
+		n := len(c.buf) - c.max
+		c.dropped += n
+		c.buf = append(c.buf[:0], c.buf[n:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the retained console output, noting any truncation.
+func (c *ConsoleBuffer) String() string {
+	dropped := c.dropped
+	buf := c.buf
+	if c.max > 0 && len(buf) > c.max {
+		dropped += len(buf) - c.max
+		buf = buf[len(buf)-c.max:]
+	}
+	if dropped > 0 {
+		return fmt.Sprintf(truncatedNote, dropped) + string(buf)
+	}
+	return string(buf)
+}
@@ -0,0 +1,73 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTruncateConsole(t *testing.T) {
+	if out := TruncateConsole("hello", 0); out != "hello" {
+		t.Errorf("unlimited: got %q", out)
+	}
+	if out := TruncateConsole("hello", 5); out != "hello" {
+		t.Errorf("at limit: got %q", out)
+	}
+	out := TruncateConsole("hello world", 5)
+	if !strings.HasSuffix(out, "world") || !strings.Contains(out, "6 bytes") {
+		t.Errorf("over limit: got %q", out)
+	}
+}
+
+func TestReadConsole(t *testing.T) {
+	dir, err := ioutil.TempDir("", "console")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "console.txt")
+	if err := ioutil.WriteFile(path, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ReadConsole(path, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != TruncateConsole("hello world", 5) {
+		t.Errorf("got %q", out)
+	}
+}
+
+func TestConsoleBuffer(t *testing.T) {
+	buf := NewConsoleBuffer(4)
+	for _, s := range []string{"ab", "cd", "ef", "gh", "ij"} {
+		buf.Write([]byte(s))
+	}
+	if out := buf.String(); out != TruncateConsole("abcdefghij", 4) {
+		t.Errorf("got %q", out)
+	}
+
+	buf = NewConsoleBuffer(0)
+	buf.Write([]byte("abcdefghij"))
+	if out := buf.String(); out != "abcdefghij" {
+		t.Errorf("unlimited: got %q", out)
+	}
+}
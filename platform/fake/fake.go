@@ -0,0 +1,350 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fake provides a platform.Cluster whose machines run no
+// commands, answering them from scripted responses instead. It lets the
+// logic of kola tests be unit tested without provisioning anything.
+package fake
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"regexp"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/conf"
+)
+
+// Response is the scripted result of a command.
+type Response struct {
+	Stdout []byte
+	Stderr []byte
+
+	// ExitStatus, if nonzero, fails the command with an *ExitError.
+	ExitStatus int
+
+	// Err, if set, is returned as is, such as to simulate a dropped
+	// connection.
+	Err error
+}
+
+// ExitError is the error of a command whose Response has a nonzero
+// ExitStatus. Like *ssh.ExitError, it reports the status from
+// ExitStatus, so platform.ExitStatus understands both.
+type ExitError struct {
+	Status int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("Process exited with status %d", e.Status)
+}
+
+// ExitStatus returns the command's exit status.
+func (e *ExitError) ExitStatus() int {
+	return e.Status
+}
+
+// Command is a command run on a Machine.
+type Command struct {
+	Cmd   string
+	Stdin []byte // nil unless run with SSHWithInput
+}
+
+// script maps commands to responses. Later responses take precedence.
+type script struct {
+	mu        sync.Mutex
+	responses []scripted
+}
+
+type scripted struct {
+	match    *regexp.Regexp
+	response Response
+}
+
+func (s *script) add(pattern string, r Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.responses = append(s.responses, scripted{
+		match:    regexp.MustCompile("^(?:" + pattern + ")$"),
+		response: r,
+	})
+}
+
+func (s *script) find(cmd string) (Response, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.responses) - 1; i >= 0; i-- {
+		if s.responses[i].match.MatchString(cmd) {
+			return s.responses[i].response, true
+		}
+	}
+	return Response{}, false
+}
+
+// Cluster is a platform.Cluster of fake machines. Commands are answered
+// from responses scripted on the machine running them, then from those
+// scripted on the cluster.
+type Cluster struct {
+	*platform.BaseCluster
+
+	// Capabilities are reported by Supports.
+	Capabilities platform.Capabilities
+
+	script script
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewCluster creates an empty fake cluster. rconf may be nil.
+func NewCluster(rconf *platform.RuntimeConfig) (*Cluster, error) {
+	if rconf == nil {
+		rconf = &platform.RuntimeConfig{}
+	}
+	bc, err := platform.NewBaseCluster("fake", rconf, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Cluster{BaseCluster: bc}, nil
+}
+
+// Respond scripts the response to commands fully matching the regular
+// expression pattern on every machine of the cluster.
+func (c *Cluster) Respond(pattern string, r Response) {
+	c.script.add(pattern, r)
+}
+
+// NewMachine creates a fake machine, rendering userdata as a real
+// platform would.
+func (c *Cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	return c.AddMachine(userdata)
+}
+
+// AddMachine creates a fake machine like NewMachine, returning it as a
+// *Machine so responses can be scripted on it.
+func (c *Cluster) AddMachine(userdata *conf.UserData) (*Machine, error) {
+	c.mu.Lock()
+	c.next++
+	n := c.next
+	c.mu.Unlock()
+
+	m := &Machine{
+		id:      fmt.Sprintf("fake-%d", n),
+		ip:      fmt.Sprintf("10.0.0.%d", n),
+		cluster: c,
+	}
+
+	rendered, err := c.RenderUserData(userdata, map[string]string{
+		"$public_ipv4":  m.ip,
+		"$private_ipv4": m.ip,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.SetMachineConfig(m, rendered)
+	c.AddMach(m)
+	return m, nil
+}
+
+// GetDiscoveryURL returns a placeholder URL without contacting a
+// discovery service.
+func (c *Cluster) GetDiscoveryURL(size int) (string, error) {
+	return fmt.Sprintf("https://discovery.invalid/%s/%d", c.Name(), size), nil
+}
+
+// Supports reports whether c is in Capabilities.
+func (c *Cluster) Supports(cap platform.Capability) bool {
+	return c.Capabilities.Has(cap)
+}
+
+// SSH runs cmd on m, answering it from the scripted responses without
+// connecting to anything.
+func (c *Cluster) SSH(m platform.Machine, cmd string) ([]byte, []byte, error) {
+	return m.SSH(cmd)
+}
+
+// SSHWithInput runs cmd on m like SSH, recording stdin with the command.
+func (c *Cluster) SSHWithInput(m platform.Machine, cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return m.SSHWithInput(cmd, stdin)
+}
+
+// PutDir copies localDir to remoteDir on m like platform.PutDir. The
+// archive is recorded as the stdin of the tar command run on m.
+func (c *Cluster) PutDir(m platform.Machine, localDir, remoteDir string, followSymlinks bool) error {
+	return platform.PutDir(m, localDir, remoteDir, followSymlinks)
+}
+
+// GetDir copies remoteDir on m to localDir like platform.GetDir,
+// extracting the archive scripted as the tar command's stdout.
+func (c *Cluster) GetDir(m platform.Machine, remoteDir, localDir string, followSymlinks bool) error {
+	return platform.GetDir(m, remoteDir, localDir, followSymlinks)
+}
+
+// SSHPipeOutput runs cmd on m like SSH, then writes its scripted output.
+func (c *Cluster) SSHPipeOutput(m platform.Machine, cmd string, stdout, stderr io.Writer) error {
+	out, errOut, err := m.SSH(cmd)
+	stdout.Write(out)
+	stderr.Write(errOut)
+	return err
+}
+
+// Dial fails; a fake cluster has no network.
+func (c *Cluster) Dial(network, address string) (net.Conn, error) {
+	return nil, fmt.Errorf("fake cluster %s has no network", c.Name())
+}
+
+// Machine is a fake platform.Machine which records the commands run on
+// it and answers them from scripted responses. Commands with no scripted
+// response fail.
+type Machine struct {
+	id      string
+	ip      string
+	cluster *Cluster
+	script  script
+
+	mu       sync.Mutex
+	commands []Command
+	reboots  int
+	console  string
+}
+
+func (m *Machine) ID() string {
+	return m.id
+}
+
+func (m *Machine) IP() string {
+	return m.ip
+}
+
+func (m *Machine) PrivateIP() string {
+	return m.ip
+}
+
+func (m *Machine) DNSName() string {
+	return ""
+}
+
+func (m *Machine) SSHClient() (*ssh.Client, error) {
+	return nil, fmt.Errorf("fake machine %s has no SSH server", m.id)
+}
+
+func (m *Machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return nil, fmt.Errorf("fake machine %s has no SSH server", m.id)
+}
+
+func (m *Machine) SSH(cmd string) ([]byte, []byte, error) {
+	return m.run(Command{Cmd: cmd})
+}
+
+func (m *Machine) SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	in, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return nil, nil, err
+	}
+	if in == nil {
+		in = []byte{}
+	}
+	return m.run(Command{Cmd: cmd, Stdin: in})
+}
+
+func (m *Machine) run(c Command) ([]byte, []byte, error) {
+	m.mu.Lock()
+	m.commands = append(m.commands, c)
+	m.mu.Unlock()
+
+	r, ok := m.script.find(c.Cmd)
+	if !ok {
+		r, ok = m.cluster.script.find(c.Cmd)
+	}
+	if !ok {
+		return nil, nil, fmt.Errorf("no response scripted for %q on %s", c.Cmd, m.id)
+	}
+
+	if r.Err != nil {
+		return r.Stdout, r.Stderr, r.Err
+	}
+	if r.ExitStatus != 0 {
+		return r.Stdout, r.Stderr, &ExitError{Status: r.ExitStatus}
+	}
+	return r.Stdout, r.Stderr, nil
+}
+
+func (m *Machine) WaitForUnit(unit, state string, timeout time.Duration) error {
+	return m.cluster.WaitForUnit(m, unit, state, timeout)
+}
+
+func (m *Machine) OSRelease() (map[string]string, error) {
+	return m.cluster.OSRelease(m)
+}
+
+func (m *Machine) MemInfo() (*platform.MemInfo, error) {
+	return m.cluster.MemInfo(m)
+}
+
+func (m *Machine) DiskUsage(path string) (*platform.DiskUsage, error) {
+	return m.cluster.DiskUsage(m, path)
+}
+
+// Reboot counts the reboot; see Reboots.
+func (m *Machine) Reboot() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reboots++
+	return nil
+}
+
+func (m *Machine) Destroy() error {
+	m.cluster.DelMach(m)
+	return nil
+}
+
+// ConsoleOutput returns the output set by SetConsole.
+func (m *Machine) ConsoleOutput() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.console
+}
+
+// Respond scripts the response to commands fully matching the regular
+// expression pattern on m, overriding the cluster's responses.
+func (m *Machine) Respond(pattern string, r Response) {
+	m.script.add(pattern, r)
+}
+
+// SetConsole sets the console output the machine reports.
+func (m *Machine) SetConsole(console string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.console = console
+}
+
+// Commands returns the commands run on m so far, in order.
+func (m *Machine) Commands() []Command {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Command(nil), m.commands...)
+}
+
+// Reboots returns how many times m has been rebooted.
+func (m *Machine) Reboots() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.reboots
+}
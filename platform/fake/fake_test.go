@@ -0,0 +1,148 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fake_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/coreos/mantle/harness"
+	"github.com/coreos/mantle/kola/cluster"
+	"github.com/coreos/mantle/kola/testhelpers"
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/fake"
+)
+
+func TestScriptedResponses(t *testing.T) {
+	c, err := fake.NewCluster(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy()
+
+	m, err := c.AddMachine(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Respond("uname -r", fake.Response{Stdout: []byte("4.14.11-coreos\n")})
+	c.Respond("false", fake.Response{ExitStatus: 1})
+	m.Respond("uname -.*", fake.Response{Stdout: []byte("4.15.0-coreos\n")})
+
+	v, err := c.KernelVersion(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "4.15.0" {
+		t.Errorf("machine response did not override cluster's: got kernel %v", v)
+	}
+
+	_, _, err = m.SSH("false")
+	if status, ok := platform.ExitStatus(err); !ok || status != 1 {
+		t.Errorf("expected exit status 1, got %v", err)
+	}
+
+	if _, _, err := m.SSH("true"); err == nil {
+		t.Errorf("unscripted command succeeded")
+	}
+
+	var cmds []string
+	for _, cmd := range m.Commands() {
+		cmds = append(cmds, cmd.Cmd)
+	}
+	if !reflect.DeepEqual(cmds, []string{"uname -r", "false", "true"}) {
+		t.Errorf("unexpected commands recorded: %q", cmds)
+	}
+}
+
+func TestRunWithFakeCluster(t *testing.T) {
+	c, err := fake.NewCluster(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy()
+
+	m, err := c.AddMachine(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Respond("ls /root", fake.Response{ExitStatus: 2})
+
+	err = testhelpers.Run("denied", c, func(tc cluster.TestCluster) {
+		tc.AssertCmdFails(tc.Machines()[0], "ls /root", 2)
+	})
+	if err != nil {
+		t.Errorf("expected test to pass: %v", err)
+	}
+
+	err = testhelpers.Run("wrong-status", c, func(tc cluster.TestCluster) {
+		tc.AssertCmdFails(tc.Machines()[0], "ls /root", 1)
+	})
+	if err != harness.SuiteFailed {
+		t.Errorf("expected test to fail, got %v", err)
+	}
+}
+
+func TestDirTransfer(t *testing.T) {
+	c, err := fake.NewCluster(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Destroy()
+
+	m, err := c.AddMachine(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Respond("sudo mkdir -p .*", fake.Response{})
+	m.Respond("sudo tar -x .*", fake.Response{})
+
+	src, err := ioutil.TempDir("", "fake-src-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	if err := ioutil.WriteFile(filepath.Join(src, "file"), []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.PutDir(m, src, "/var/lib/data", false); err != nil {
+		t.Fatal(err)
+	}
+
+	cmds := m.Commands()
+	if len(cmds) != 2 || cmds[1].Stdin == nil {
+		t.Fatalf("archive not sent to tar: %+v", cmds)
+	}
+
+	// serve the archive back to GetDir
+	m.Respond("sudo tar -c .*", fake.Response{Stdout: cmds[1].Stdin})
+	dst, err := ioutil.TempDir("", "fake-dst-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	if err := c.GetDir(m, "/var/lib/data", dst, false); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dst, "file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "contents" {
+		t.Errorf("copied file contains %q", got)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package image describes where a Container Linux disk image comes from
+// so that each platform can resolve it to something it can boot.
+package image
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/mantle/sdk"
+	"github.com/coreos/mantle/util"
+)
+
+var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/image")
+
+// Scheme identifies the kind of location an image Source refers to.
+type Scheme string
+
+const (
+	Local Scheme = "file"
+	HTTP  Scheme = "http"
+	S3    Scheme = "s3"
+	GCS   Scheme = "gs"
+)
+
+// Source is the location of a disk image: a local path, an http(s) URL,
+// or an object in S3 or Google Cloud Storage.
+type Source struct {
+	Scheme Scheme
+	// Location is the local path for Local sources and the full URL
+	// for all others.
+	Location string
+}
+
+// ParseSource parses s into a Source. Strings without a recognized URL
+// scheme are treated as local paths.
+func ParseSource(s string) (*Source, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty image source")
+	}
+
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" {
+		return &Source{Scheme: Local, Location: s}, nil
+	}
+
+	var scheme Scheme
+	switch u.Scheme {
+	case "file":
+		return &Source{Scheme: Local, Location: u.Path}, nil
+	case "http", "https":
+		scheme = HTTP
+	case "s3":
+		scheme = S3
+	case "gs":
+		scheme = GCS
+	default:
+		return nil, fmt.Errorf("unsupported image source scheme %q", u.Scheme)
+	}
+
+	if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+		return nil, fmt.Errorf("image source %q is missing a host or path", s)
+	}
+
+	return &Source{Scheme: scheme, Location: s}, nil
+}
+
+// IsLocal reports whether the source refers to a file on this host.
+func (s *Source) IsLocal() bool {
+	return s.Scheme == Local
+}
+
+// Name returns a name for the image derived from its location which is
+// stable across runs, suitable for naming cached copies or imported
+// cloud images.
+func (s *Source) Name() string {
+	base := path.Base(s.Location)
+	for _, ext := range []string{".bz2", ".gz", ".bin", ".img", ".raw", ".vmdk"} {
+		base = strings.TrimSuffix(base, ext)
+	}
+	sum := sha256.Sum256([]byte(s.Location))
+	return fmt.Sprintf("%s-%x", base, sum[:6])
+}
+
+func (s *Source) String() string {
+	return s.Location
+}
+
+// Fetch resolves the source to a file on the local host. Local sources
+// are returned as is. HTTP and GCS sources are downloaded into cacheDir,
+// resuming any partial download, and bzip2 compressed images are
+// decompressed. S3 sources can only be imported by the AWS platform.
+func (s *Source) Fetch(cacheDir string, client *http.Client) (string, error) {
+	switch s.Scheme {
+	case Local:
+		return s.Location, nil
+	case HTTP, GCS:
+	default:
+		return "", fmt.Errorf("cannot fetch %s image source %q to the local host", s.Scheme, s.Location)
+	}
+
+	dir := filepath.Join(cacheDir, s.Name())
+	file := filepath.Join(dir, path.Base(s.Location))
+	if err := sdk.DownloadFile(file, s.Location, client); err != nil {
+		return "", fmt.Errorf("downloading %s: %v", s.Location, err)
+	}
+
+	if !strings.HasSuffix(file, ".bz2") {
+		return file, nil
+	}
+
+	unpacked := strings.TrimSuffix(file, ".bz2")
+	if _, err := os.Stat(unpacked); err == nil {
+		plog.Infof("Using cached %s", unpacked)
+		return unpacked, nil
+	}
+	plog.Infof("Decompressing %s", file)
+	tmp := unpacked + ".tmp"
+	if err := util.Bunzip2File(tmp, file); err != nil {
+		return "", fmt.Errorf("decompressing %s: %v", file, err)
+	}
+	if err := os.Rename(tmp, unpacked); err != nil {
+		return "", err
+	}
+	return unpacked, nil
+}
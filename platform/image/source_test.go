@@ -0,0 +1,65 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package image
+
+import (
+	"testing"
+)
+
+func TestParseSource(t *testing.T) {
+	for _, tt := range []struct {
+		in     string
+		scheme Scheme
+		loc    string
+		err    bool
+	}{
+		{in: "coreos_production_image.bin", scheme: Local, loc: "coreos_production_image.bin"},
+		{in: "/tmp/image.bin", scheme: Local, loc: "/tmp/image.bin"},
+		{in: "file:///tmp/image.bin", scheme: Local, loc: "/tmp/image.bin"},
+		{in: "https://example.com/image.bin.bz2", scheme: HTTP, loc: "https://example.com/image.bin.bz2"},
+		{in: "http://example.com/image.bin", scheme: HTTP, loc: "http://example.com/image.bin"},
+		{in: "s3://bucket/image.vmdk", scheme: S3, loc: "s3://bucket/image.vmdk"},
+		{in: "gs://bucket/dir/image.tar.gz", scheme: GCS, loc: "gs://bucket/dir/image.tar.gz"},
+		{in: "gs://bucket", err: true},
+		{in: "ftp://example.com/image.bin", err: true},
+		{in: "", err: true},
+	} {
+		src, err := ParseSource(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("ParseSource(%q): expected error, got %+v", tt.in, src)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSource(%q): unexpected error: %v", tt.in, err)
+			continue
+		}
+		if src.Scheme != tt.scheme || src.Location != tt.loc {
+			t.Errorf("ParseSource(%q): got %q %q, expected %q %q", tt.in, src.Scheme, src.Location, tt.scheme, tt.loc)
+		}
+	}
+}
+
+func TestSourceName(t *testing.T) {
+	a, _ := ParseSource("https://example.com/a/coreos_production_image.bin.bz2")
+	b, _ := ParseSource("https://example.com/b/coreos_production_image.bin.bz2")
+	if a.Name() == b.Name() {
+		t.Errorf("different sources share the name %q", a.Name())
+	}
+	if c, _ := ParseSource(a.Location); a.Name() != c.Name() {
+		t.Errorf("source name is not stable")
+	}
+}
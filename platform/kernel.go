@@ -0,0 +1,136 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+// oemGrubConfig is sourced by Container Linux's GRUB config from the OEM
+// partition, and may extend the kernel command line with linux_append.
+const oemGrubConfig = "/usr/share/oem/grub.cfg"
+
+// AppendKernelArgs adds args to m's kernel command line through the OEM
+// partition's GRUB config, then reboots m so they take effect and checks
+// that they did.
+func AppendKernelArgs(m Machine, args ...string) error {
+	line := fmt.Sprintf(`set linux_append="$linux_append %s"`, strings.Join(args, " "))
+	cmd := fmt.Sprintf("echo %s | sudo tee -a %s >/dev/null", ShellQuote(line), oemGrubConfig)
+	if out, stderr, err := m.SSH(cmd); err != nil {
+		return fmt.Errorf("updating %s on %s: %v: %s%s", oemGrubConfig, m.ID(), err, out, stderr)
+	}
+
+	if err := m.Reboot(); err != nil {
+		return fmt.Errorf("rebooting %s to apply kernel arguments: %v", m.ID(), err)
+	}
+
+	cmdline, stderr, err := m.SSH("cat /proc/cmdline")
+	if err != nil {
+		return fmt.Errorf("reading kernel command line of %s: %v: %s", m.ID(), err, stderr)
+	}
+	have := parseKernelCmdline(string(cmdline))
+	for _, arg := range args {
+		if !containsString(have, arg) {
+			return fmt.Errorf("kernel argument %q missing from command line of %s: %s", arg, m.ID(), cmdline)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// KernelVersion returns the version of the kernel running on m, without
+// any local suffix such as "-coreos".
+func (bc *BaseCluster) KernelVersion(m Machine) (*semver.Version, error) {
+	out, stderr, err := m.SSH("uname -r")
+	if err != nil {
+		return nil, fmt.Errorf("reading kernel version: %v: %s", err, stderr)
+	}
+	return parseKernelVersion(string(out))
+}
+
+// KernelCmdline returns the arguments on the command line of the kernel
+// running on m.
+func (bc *BaseCluster) KernelCmdline(m Machine) ([]string, error) {
+	out, stderr, err := m.SSH("cat /proc/cmdline")
+	if err != nil {
+		return nil, fmt.Errorf("reading kernel command line: %v: %s", err, stderr)
+	}
+	return parseKernelCmdline(string(out)), nil
+}
+
+// parseKernelVersion parses a kernel release such as "4.14.11-coreos" or
+// "4.9" as a semantic version, ignoring the local suffix so that versions
+// compare by their numbers alone.
+func parseKernelVersion(release string) (*semver.Version, error) {
+	release = strings.TrimSpace(release)
+	numbers := release
+	if i := strings.IndexAny(numbers, "-+_"); i >= 0 {
+		numbers = numbers[:i]
+	}
+	parts := strings.Split(numbers, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("malformed kernel version %q", release)
+	}
+	var v [3]int64
+	for i, part := range parts {
+		n, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed kernel version %q", release)
+		}
+		v[i] = n
+	}
+	return &semver.Version{Major: v[0], Minor: v[1], Patch: v[2]}, nil
+}
+
+// parseKernelCmdline splits a kernel command line into arguments. Like
+// the kernel, it allows double quotes around values containing spaces,
+// and removes them.
+func parseKernelCmdline(cmdline string) []string {
+	var args []string
+	var arg []byte
+	inArg, quoted := false, false
+	for i := 0; i < len(cmdline); i++ {
+		ch := cmdline[i]
+		switch {
+		case ch == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && (ch == ' ' || ch == '\t' || ch == '\n'):
+			if inArg {
+				args = append(args, string(arg))
+				arg, inArg = arg[:0], false
+			}
+		default:
+			arg = append(arg, ch)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, string(arg))
+	}
+	return args
+}
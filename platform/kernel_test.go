@@ -0,0 +1,63 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/coreos/go-semver/semver"
+)
+
+func TestParseKernelVersion(t *testing.T) {
+	for _, tt := range []struct {
+		release string
+		want    semver.Version
+	}{
+		{"4.14.11-coreos\n", semver.Version{Major: 4, Minor: 14, Patch: 11}},
+		{"4.9.0-rc3", semver.Version{Major: 4, Minor: 9}},
+		{"4.9", semver.Version{Major: 4, Minor: 9}},
+		{"5.10.1+", semver.Version{Major: 5, Minor: 10, Patch: 1}},
+	} {
+		got, err := parseKernelVersion(tt.release)
+		if err != nil {
+			t.Errorf("parsing %q: %v", tt.release, err)
+			continue
+		}
+		if *got != tt.want {
+			t.Errorf("parsing %q: got %v, want %v", tt.release, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "4", "four.nine", "4.9.1.2"} {
+		if _, err := parseKernelVersion(bad); err == nil {
+			t.Errorf("parsed malformed kernel version %q", bad)
+		}
+	}
+}
+
+func TestParseKernelCmdline(t *testing.T) {
+	cmdline := `BOOT_IMAGE=/coreos/vmlinuz-a mount.usr=PARTUUID=7130c94a console=ttyS0,115200n8  dyndbg="file drivers/usb/* +p" coreos.first_boot=detected` + "\n"
+	want := []string{
+		"BOOT_IMAGE=/coreos/vmlinuz-a",
+		"mount.usr=PARTUUID=7130c94a",
+		"console=ttyS0,115200n8",
+		"dyndbg=file drivers/usb/* +p",
+		"coreos.first_boot=detected",
+	}
+	if got := parseKernelCmdline(cmdline); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// captureStopper lets a running capture be stopped as a Destructor.
+type captureStopper func()
+
+func (stop captureStopper) Destroy() error {
+	stop()
+	return nil
+}
+
+// StartCapture runs tcpdump on the cluster bridge in the cluster's network
+// namespace, writing a pcap file to the cluster's output directory. The
+// capture runs until stop is called or the cluster is destroyed.
+func (lc *LocalCluster) StartCapture() (stop func(), err error) {
+	lc.captureLock.Lock()
+	lc.captures++
+	path := filepath.Join(lc.RuntimeConf().OutputDir, fmt.Sprintf("br0-%d.pcap", lc.captures))
+	lc.captureLock.Unlock()
+
+	// -U writes each packet out as it arrives, so nothing is lost when
+	// tcpdump is killed.
+	cmd := lc.NewCommand("tcpdump", "-i", "br0", "-U", "-w", path)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting tcpdump: %v", err)
+	}
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			if err := cmd.Kill(); err != nil {
+				plog.Errorf("stopping tcpdump: %v", err)
+			}
+		})
+	}
+
+	lc.captureLock.Lock()
+	lc.AddDestructor(captureStopper(stop))
+	lc.captureLock.Unlock()
+
+	return stop, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// cpuPeriod is the cpu.max scheduling period, in microseconds.
+	cpuPeriod = 100000
+
+	cgroupRemoveRetries = 50
+	cgroupRemoveDelay   = 100 * time.Millisecond
+)
+
+// CgroupOptions limits the host resources used by a local cluster's
+// virtual machines, by running them in a cgroup v2 of their own.
+type CgroupOptions struct {
+	// Parent is the cgroup under which each cluster's cgroup is
+	// created, e.g. "/sys/fs/cgroup/kola". No cgroup is used if it is
+	// empty. The memory and cpu controllers are enabled in it.
+	Parent string
+
+	// MemoryLimit is the most memory, in bytes, the cluster's processes
+	// may use together before the kernel OOM kills one; 0 for no limit.
+	MemoryLimit int64
+
+	// CPULimit is how many CPUs worth of time the cluster's processes
+	// may use together; 0 for no limit.
+	CPULimit float64
+}
+
+// cgroup is a cgroup v2 created for a cluster.
+type cgroup struct {
+	path string
+}
+
+// newCgroup creates the cgroup name under opts.Parent with the limits of
+// opts.
+func newCgroup(opts CgroupOptions, name string) (*cgroup, error) {
+	if err := os.MkdirAll(opts.Parent, 0755); err != nil {
+		return nil, fmt.Errorf("creating cgroup %s: %v", opts.Parent, err)
+	}
+	if err := writeCgroupFile(opts.Parent, "cgroup.subtree_control", "+memory +cpu"); err != nil {
+		return nil, err
+	}
+
+	cg := &cgroup{path: filepath.Join(opts.Parent, name)}
+	if err := os.Mkdir(cg.path, 0755); err != nil {
+		return nil, fmt.Errorf("creating cgroup %s: %v", cg.path, err)
+	}
+	if opts.MemoryLimit > 0 {
+		if err := writeCgroupFile(cg.path, "memory.max", strconv.FormatInt(opts.MemoryLimit, 10)); err != nil {
+			cg.Destroy()
+			return nil, err
+		}
+		// don't let swap hide the limit, if the host has swap accounting
+		if _, err := os.Stat(filepath.Join(cg.path, "memory.swap.max")); err == nil {
+			if err := writeCgroupFile(cg.path, "memory.swap.max", "0"); err != nil {
+				cg.Destroy()
+				return nil, err
+			}
+		}
+	}
+	if opts.CPULimit > 0 {
+		if err := writeCgroupFile(cg.path, "cpu.max", cpuMax(opts.CPULimit)); err != nil {
+			cg.Destroy()
+			return nil, err
+		}
+	}
+	return cg, nil
+}
+
+// procsPath returns the path of the file which a process writes its pid
+// to in order to join the cgroup.
+func (cg *cgroup) procsPath() string {
+	return filepath.Join(cg.path, "cgroup.procs")
+}
+
+// OOMKills returns how many of the cgroup's processes have been killed
+// for exceeding its memory limit.
+func (cg *cgroup) OOMKills() (uint64, error) {
+	events, err := ioutil.ReadFile(filepath.Join(cg.path, "memory.events"))
+	if err != nil {
+		return 0, err
+	}
+	return parseOOMKills(events)
+}
+
+// Destroy removes the cgroup, waiting briefly for killed processes to
+// exit it.
+func (cg *cgroup) Destroy() error {
+	var err error
+	for i := 0; i < cgroupRemoveRetries; i++ {
+		err = syscall.Rmdir(cg.path)
+		if err != syscall.EBUSY {
+			break
+		}
+		time.Sleep(cgroupRemoveDelay)
+	}
+	if err != nil && err != syscall.ENOENT {
+		return fmt.Errorf("removing cgroup %s: %v", cg.path, err)
+	}
+	return nil
+}
+
+func writeCgroupFile(dir, name, value string) error {
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("setting %s of cgroup %s to %q: %v", name, dir, value, err)
+	}
+	return nil
+}
+
+// cpuMax formats a limit of cpus CPUs for cpu.max.
+func cpuMax(cpus float64) string {
+	return fmt.Sprintf("%d %d", int64(cpus*cpuPeriod), cpuPeriod)
+}
+
+func parseOOMKills(events []byte) (uint64, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(events))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return strconv.ParseUint(fields[1], 10, 64)
+		}
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"testing"
+)
+
+func TestCPUMax(t *testing.T) {
+	for _, tt := range []struct {
+		cpus float64
+		want string
+	}{
+		{1, "100000 100000"},
+		{2, "200000 100000"},
+		{0.5, "50000 100000"},
+		{1.25, "125000 100000"},
+	} {
+		if got := cpuMax(tt.cpus); got != tt.want {
+			t.Errorf("cpuMax(%v) = %q, expected %q", tt.cpus, got, tt.want)
+		}
+	}
+}
+
+func TestParseOOMKills(t *testing.T) {
+	for _, tt := range []struct {
+		events string
+		want   uint64
+		ok     bool
+	}{
+		{"low 0\nhigh 0\nmax 12\noom 3\noom_kill 2\n", 2, true},
+		{"low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\noom_group_kill 0\n", 0, true},
+		// kernels before 4.13 don't report oom_kill
+		{"low 0\nhigh 0\nmax 0\noom 0\n", 0, true},
+		{"", 0, true},
+		{"oom_kill lots\n", 0, false},
+	} {
+		got, err := parseOOMKills([]byte(tt.events))
+		if (err == nil) != tt.ok {
+			t.Errorf("parseOOMKills(%q): unexpected error %v", tt.events, err)
+		} else if got != tt.want {
+			t.Errorf("parseOOMKills(%q) = %d, expected %d", tt.events, got, tt.want)
+		}
+	}
+}
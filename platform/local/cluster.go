@@ -17,10 +17,12 @@ package local
 import (
 	"fmt"
 	"math/rand"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/coreos/go-omaha/omaha"
 	"github.com/vishvananda/netlink"
@@ -41,10 +43,15 @@ type LocalCluster struct {
 	NTPServer   *ntp.Server
 	OmahaServer *omaha.TrivialServer
 	SimpleEtcd  *SimpleEtcd
+	ConfigSrv   *ConfigServer
 	nshandle    netns.NsHandle
+	cgroup      *cgroup
+
+	captureLock sync.Mutex
+	captures    int
 }
 
-func NewLocalCluster(basename string, rconf *platform.RuntimeConfig) (*LocalCluster, error) {
+func NewLocalCluster(basename string, rconf *platform.RuntimeConfig, dhcp DHCPOptions, cgroupOpts CgroupOptions) (*LocalCluster, error) {
 	lc := &LocalCluster{}
 
 	var err error
@@ -70,7 +77,7 @@ func NewLocalCluster(basename string, rconf *platform.RuntimeConfig) (*LocalClus
 	}
 	defer nsExit()
 
-	lc.Dnsmasq, err = NewDnsmasq()
+	lc.Dnsmasq, err = NewDnsmasq(dhcp)
 	if err != nil {
 		lc.Destroy()
 		return nil, err
@@ -84,6 +91,13 @@ func NewLocalCluster(basename string, rconf *platform.RuntimeConfig) (*LocalClus
 	}
 	lc.AddDestructor(lc.SimpleEtcd)
 
+	lc.ConfigSrv, err = NewConfigServer()
+	if err != nil {
+		lc.Destroy()
+		return nil, err
+	}
+	lc.AddDestructor(lc.ConfigSrv)
+
 	lc.NTPServer, err = ntp.NewServer(":123")
 	if err != nil {
 		lc.Destroy()
@@ -100,6 +114,16 @@ func NewLocalCluster(basename string, rconf *platform.RuntimeConfig) (*LocalClus
 	lc.AddDestructor(lc.OmahaServer)
 	go lc.OmahaServer.Serve()
 
+	// added last so it is removed after the machines in it are gone
+	if cgroupOpts.Parent != "" {
+		lc.cgroup, err = newCgroup(cgroupOpts, lc.Name())
+		if err != nil {
+			lc.Destroy()
+			return nil, err
+		}
+		lc.AddDestructor(lc.cgroup)
+	}
+
 	return lc, nil
 }
 
@@ -108,17 +132,59 @@ func (lc *LocalCluster) NewCommand(name string, arg ...string) exec.Cmd {
 	return cmd
 }
 
-func (lc *LocalCluster) etcdEndpoint() string {
+// NewCgroupCommand is like NewCommand, but for a host process, such as a
+// virtual machine, which starts in the cluster's cgroup if it has one, so
+// none of its memory or CPU time escapes the cgroup's limits.
+func (lc *LocalCluster) NewCgroupCommand(name string, arg ...string) exec.Cmd {
+	if lc.cgroup == nil {
+		return lc.NewCommand(name, arg...)
+	}
+	// the shell joins the cgroup, then execs name in its place
+	shArgs := []string{"-c", `echo $$ > "$0" && exec "$@"`, lc.cgroup.procsPath(), name}
+	return lc.NewCommand("sh", append(shArgs, arg...)...)
+}
+
+// HostOOMKills returns how many processes in the cluster's cgroup the
+// kernel has killed for exceeding its memory limit.
+func (lc *LocalCluster) HostOOMKills() (uint64, error) {
+	if lc.cgroup == nil {
+		return 0, nil
+	}
+	return lc.cgroup.OOMKills()
+}
+
+// RunInNamespace runs a host command inside the cluster's network
+// namespace, where it can see the cluster bridge and machine taps, and
+// returns its combined output.
+func (lc *LocalCluster) RunInNamespace(cmd string, args ...string) ([]byte, error) {
+	out, err := lc.NewCommand(cmd, args...).CombinedOutput()
+	if err != nil {
+		return out, fmt.Errorf("%s failed: %v: %s", cmd, err, out)
+	}
+	return out, nil
+}
+
+func (lc *LocalCluster) bridgeIP() net.IP {
 	// hackydoo
 	bridge := "br0"
 	for _, seg := range lc.Dnsmasq.Segments {
 		if bridge == seg.BridgeName {
-			return fmt.Sprintf("http://%s:%d", seg.BridgeIf.DHCPv4[0].IP, lc.SimpleEtcd.Port)
+			return seg.BridgeIf.DHCPv4[0].IP
 		}
 	}
 	panic("Not a valid bridge!")
 }
 
+func (lc *LocalCluster) etcdEndpoint() string {
+	return fmt.Sprintf("http://%s:%d", lc.bridgeIP(), lc.SimpleEtcd.Port)
+}
+
+// ConfigURL returns the URL guests use to fetch the config served by
+// ConfigSrv under name.
+func (lc *LocalCluster) ConfigURL(name string) string {
+	return fmt.Sprintf("http://%s:%d/%s", lc.bridgeIP(), lc.ConfigSrv.Port, name)
+}
+
 func (lc *LocalCluster) GetDiscoveryURL(size int) (string, error) {
 	baseURL := fmt.Sprintf("%v/v2/keys/discovery/%v", lc.etcdEndpoint(), rand.Int())
 
@@ -0,0 +1,78 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// ConfigServer serves machine configs over HTTP so guests can fetch them
+// remotely, e.g. through Ignition's config.replace.
+type ConfigServer struct {
+	Port     int
+	listener net.Listener
+
+	mu      sync.Mutex
+	configs map[string][]byte
+}
+
+func NewConfigServer() (*ConfigServer, error) {
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return nil, err
+	}
+
+	cs := &ConfigServer{
+		Port:     l.Addr().(*net.TCPAddr).Port,
+		listener: l,
+		configs:  make(map[string][]byte),
+	}
+	go http.Serve(l, cs)
+
+	return cs, nil
+}
+
+// Add serves data at /name, replacing anything previously served there.
+func (cs *ConfigServer) Add(name string, data []byte) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.configs[name] = data
+}
+
+// Remove stops serving /name; requests for it will get a 404.
+func (cs *ConfigServer) Remove(name string) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	delete(cs.configs, name)
+}
+
+func (cs *ConfigServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cs.mu.Lock()
+	data, ok := cs.configs[strings.TrimPrefix(r.URL.Path, "/")]
+	cs.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+func (cs *ConfigServer) Destroy() error {
+	return cs.listener.Close()
+}
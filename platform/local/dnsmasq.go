@@ -18,6 +18,7 @@ import (
 	"fmt"
 	"net"
 	"text/template"
+	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/vishvananda/netlink"
@@ -40,15 +41,43 @@ type Segment struct {
 	nextIf     int
 }
 
+// DHCPOptions customizes the DHCP service of a local cluster. The zero
+// value keeps the defaults.
+type DHCPOptions struct {
+	// LeaseTime is the lifetime of DHCPv4 leases, at least two
+	// minutes. Zero keeps dnsmasq's default of one hour.
+	LeaseTime time.Duration
+
+	// FirstHost is the last octet of the first address handed out on
+	// each 10.x.0.0/24 segment; later machines get consecutive
+	// addresses. Zero selects the default of 2.
+	FirstHost byte
+}
+
+// LeaseSeconds returns LeaseTime in the form dnsmasq expects.
+func (o DHCPOptions) LeaseSeconds() int {
+	return int(o.LeaseTime / time.Second)
+}
+
 type Dnsmasq struct {
 	Segments []*Segment
-	dnsmasq  *exec.ExecCmd
+	DHCP     DHCPOptions
+
+	// Static is a segment dnsmasq doesn't serve DHCP on, for testing
+	// static network configuration. Its interfaces' DHCPv4 and DHCPv6
+	// addresses are reserved for them, but guests must configure them.
+	Static *Segment
+
+	dnsmasq *exec.ExecCmd
 }
 
 const (
 	numInterfaces = 16
 	numSegments   = 3
 
+	defaultFirstHost = 2
+	minLeaseTime     = 2 * time.Minute
+
 	debugConfig = `
 log-queries
 log-dhcp
@@ -70,6 +99,10 @@ no-resolv
 no-hosts
 enable-ra
 
+{{with .Static}}
+no-dhcp-interface={{.BridgeName}}
+{{end}}
+
 # point NTP at this host (0.0.0.0 and :: are special)
 dhcp-option=option:ntp-server,0.0.0.0
 dhcp-option=option6:ntp-server,[::]
@@ -78,7 +111,7 @@ dhcp-option=option6:ntp-server,[::]
 domain={{.BridgeName}}.local
 
 {{range .BridgeIf.DHCPv4}}
-dhcp-range={{.IP}},static
+dhcp-range={{.IP}},static{{if $.DHCP.LeaseTime}},{{$.DHCP.LeaseSeconds}}{{end}}
 {{end}}
 
 {{range .BridgeIf.DHCPv6}}
@@ -108,13 +141,13 @@ func newInterface(s, i byte) *Interface {
 	}
 }
 
-func newSegment(s byte) (*Segment, error) {
+func newSegment(s, firstHost byte) (*Segment, error) {
 	seg := &Segment{
 		BridgeName: fmt.Sprintf("br%d", s),
 		BridgeIf:   newInterface(s, 1),
 	}
 
-	for i := byte(2); i < 2+numInterfaces; i++ {
+	for i := firstHost; i < firstHost+numInterfaces; i++ {
 		seg.Interfaces = append(seg.Interfaces, newInterface(s, i))
 	}
 
@@ -150,16 +183,32 @@ func newSegment(s byte) (*Segment, error) {
 	return seg, nil
 }
 
-func NewDnsmasq() (*Dnsmasq, error) {
-	dm := &Dnsmasq{}
+func NewDnsmasq(opts DHCPOptions) (*Dnsmasq, error) {
+	if opts.LeaseTime != 0 && opts.LeaseTime < minLeaseTime {
+		return nil, fmt.Errorf("DHCP lease time %v is below dnsmasq's minimum of %v", opts.LeaseTime, minLeaseTime)
+	}
+	if opts.FirstHost == 0 {
+		opts.FirstHost = defaultFirstHost
+	}
+	if opts.FirstHost < defaultFirstHost || int(opts.FirstHost)+numInterfaces > 255 {
+		return nil, fmt.Errorf("DHCP first host %d must be between %d and %d", opts.FirstHost, defaultFirstHost, 255-numInterfaces)
+	}
+
+	dm := &Dnsmasq{DHCP: opts}
 	for s := byte(0); s < numSegments; s++ {
-		seg, err := newSegment(s)
+		seg, err := newSegment(s, opts.FirstHost)
 		if err != nil {
 			return nil, fmt.Errorf("Network setup failed: %v", err)
 		}
 		dm.Segments = append(dm.Segments, seg)
 	}
 
+	static, err := newSegment(numSegments, opts.FirstHost)
+	if err != nil {
+		return nil, fmt.Errorf("Network setup failed: %v", err)
+	}
+	dm.Static = static
+
 	// setup lo
 	lo, err := netlink.LinkByName("lo")
 	if err != nil {
@@ -208,7 +257,8 @@ func NewDnsmasq() (*Dnsmasq, error) {
 }
 
 func (dm *Dnsmasq) GetInterface(bridge string) (in *Interface) {
-	for _, seg := range dm.Segments {
+	segments := append([]*Segment{dm.Static}, dm.Segments...)
+	for _, seg := range segments {
 		if bridge == seg.BridgeName {
 			if seg.nextIf >= len(seg.Interfaces) {
 				panic("Not enough interfaces!")
@@ -0,0 +1,136 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// verifiedImage is an image file held open since its signature was
+// checked, with the size and modification time it had then.
+type verifiedImage struct {
+	file    *os.File
+	size    int64
+	modTime time.Time
+}
+
+var (
+	verifiedLock   sync.Mutex
+	verifiedImages = map[[3]string]*verifiedImage{}
+)
+
+// VerifyImage checks the detached OpenPGP signature at sigPath of the
+// image at imagePath against the keys in the keyring at keyringPath,
+// which may be armored or binary, and returns the image opened read-only.
+// Use the returned file, or /proc/<pid>/fd/<fd> from other processes,
+// rather than reopening imagePath, which may since have been replaced.
+//
+// Verified images are kept open and their signatures only checked again
+// if they are modified in place, since clusters are created for each test;
+// the returned file is shared and must not be closed.
+func VerifyImage(imagePath, sigPath, keyringPath string) (*os.File, error) {
+	key := [3]string{imagePath, sigPath, keyringPath}
+
+	verifiedLock.Lock()
+	defer verifiedLock.Unlock()
+	if v, ok := verifiedImages[key]; ok {
+		info, err := v.file.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if info.Size() == v.size && info.ModTime().Equal(v.modTime) {
+			return v.file, nil
+		}
+		plog.Warningf("image %s changed since it was verified", imagePath)
+		delete(verifiedImages, key)
+		v.file.Close()
+	}
+
+	keyring, err := readKeyring(keyringPath)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	v := &verifiedImage{file: image}
+	if err := v.verify(keyring, sigPath); err != nil {
+		image.Close()
+		return nil, fmt.Errorf("image %s failed verification with signature %s: %v", imagePath, sigPath, err)
+	}
+
+	verifiedImages[key] = v
+	return image, nil
+}
+
+// verify checks v's file against the detached signature at sigPath,
+// recording the file's size and modification time from before reading it.
+func (v *verifiedImage) verify(keyring openpgp.EntityList, sigPath string) error {
+	info, err := v.file.Stat()
+	if err != nil {
+		return err
+	}
+	v.size, v.modTime = info.Size(), info.ModTime()
+
+	sig, err := os.Open(sigPath)
+	if err != nil {
+		return err
+	}
+	defer sig.Close()
+
+	signer, err := openpgp.CheckDetachedSignature(keyring, v.file, sig)
+	if err != nil {
+		// retry an armored signature from the start of both files
+		if _, err := v.file.Seek(0, 0); err != nil {
+			return err
+		}
+		if _, err := sig.Seek(0, 0); err != nil {
+			return err
+		}
+		if signer, err = openpgp.CheckArmoredDetachedSignature(keyring, v.file, sig); err != nil {
+			return err
+		}
+	}
+	if _, err := v.file.Seek(0, 0); err != nil {
+		return err
+	}
+	plog.Infof("image %s verified, signed by key %X", v.file.Name(), signer.PrimaryKey.KeyId)
+	return nil
+}
+
+// readKeyring reads an armored or binary OpenPGP keyring.
+func readKeyring(path string) (openpgp.EntityList, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keyring, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err != nil {
+		keyring, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading keyring %s: %v", path, err)
+	}
+	return keyring, nil
+}
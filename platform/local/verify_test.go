@@ -0,0 +1,128 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package local
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestVerifyImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mantle-verify-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	signer, err := openpgp.NewEntity("kola", "", "kola@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := openpgp.NewEntity("other", "", "other@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeKeyring := func(name string, e *openpgp.Entity) string {
+		// SerializePrivate self-signs the new entity's identities
+		var buf bytes.Buffer
+		if err := e.SerializePrivate(ioutil.Discard, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	keyring := writeKeyring("keyring", signer)
+	otherKeyring := writeKeyring("other-keyring", other)
+
+	image := filepath.Join(dir, "image.bin")
+	content := []byte("a disk image")
+	if err := ioutil.WriteFile(image, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	var sig, armoredSig bytes.Buffer
+	if err := openpgp.DetachSign(&sig, signer, bytes.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.ArmoredDetachSign(&armoredSig, signer, bytes.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+	sigPath := filepath.Join(dir, "image.bin.sig")
+	armoredSigPath := filepath.Join(dir, "image.bin.asc")
+	if err := ioutil.WriteFile(sigPath, sig.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(armoredSigPath, armoredSig.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sigPath := range []string{sigPath, armoredSigPath} {
+		if _, err := VerifyImage(image, sigPath, keyring); err != nil {
+			t.Errorf("verifying with %s: %v", sigPath, err)
+		}
+		if _, err := VerifyImage(image, sigPath, otherKeyring); err == nil {
+			t.Errorf("verified %s against the wrong key", sigPath)
+		}
+	}
+
+	// replacing the image doesn't change what was verified
+	f, err := VerifyImage(image, sigPath, keyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "other-keyring"), image); err != nil {
+		t.Fatal(err)
+	}
+	if f2, err := VerifyImage(image, sigPath, keyring); err != nil || f2 != f {
+		t.Errorf("replaced image not served from the verified file: %v", err)
+	}
+	got, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("verified file contains %q, expected %q", got, content)
+	}
+
+	// modifying the verified file in place is noticed
+	image2 := filepath.Join(dir, "image2.bin")
+	if err := ioutil.WriteFile(image2, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyImage(image2, sigPath, keyring); err != nil {
+		t.Fatal(err)
+	}
+	w, err := os.OpenFile(image2, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(" with changes")); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if _, err := VerifyImage(image2, sigPath, keyring); err == nil {
+		t.Errorf("verified an image modified after its signature was checked")
+	}
+}
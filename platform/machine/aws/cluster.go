@@ -18,12 +18,21 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/coreos/pkg/multierror"
+
 	ctplatform "github.com/coreos/container-linux-config-transpiler/config/platform"
 	"github.com/coreos/mantle/platform"
 	"github.com/coreos/mantle/platform/api/aws"
 	"github.com/coreos/mantle/platform/conf"
 )
 
+// capabilities are the optional platform features this backend provides.
+var capabilities = platform.Capabilities{
+	platform.CapConsole,
+	platform.CapMetadata,
+	platform.CapMetadataSSHKey,
+}
+
 type cluster struct {
 	*platform.BaseCluster
 	api *aws.API
@@ -41,6 +50,12 @@ func NewCluster(opts *aws.Options, rconf *platform.RuntimeConfig) (platform.Clus
 		return nil, err
 	}
 
+	if opts.RootVolumeKMSKey != "" {
+		if _, err := api.CheckKMSKey(opts.RootVolumeKMSKey); err != nil {
+			return nil, err
+		}
+	}
+
 	bc, err := platform.NewBaseCluster(opts.BaseName, rconf, ctplatform.EC2)
 	if err != nil {
 		return nil, err
@@ -74,11 +89,26 @@ func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
+	// Ignition and coreos-cloudinit both read gzip-compressed user-data
+	// on EC2.
+	ud, err := ac.UserDataBytes(conf, aws.MaxUserDataSize, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return ac.RetryBoot(func() (platform.Machine, error) {
+		return ac.boot(conf, ud)
+	})
+}
+
+// boot launches an instance with conf, serialized as ud, and waits for it
+// to come up, destroying it if it doesn't.
+func (ac *cluster) boot(conf *conf.Conf, ud []byte) (platform.Machine, error) {
 	var keyname string
 	if !ac.RuntimeConf().NoSSHKeyInMetadata {
 		keyname = ac.Name()
 	}
-	instances, err := ac.api.CreateInstances(ac.Name(), keyname, conf.String(), 1)
+	instances, err := ac.api.CreateInstances(ac.Name(), keyname, string(ud), 1)
 	if err != nil {
 		return nil, err
 	}
@@ -107,20 +137,31 @@ func (ac *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 
 	if err := platform.StartMachine(mach, mach.journal, ac.RuntimeConf()); err != nil {
 		mach.Destroy()
-		return nil, err
+		return nil, platform.BootError{Err: err}
 	}
 
+	ac.SetMachineConfig(mach, conf)
 	ac.AddMach(mach)
 
 	return mach, nil
 }
 
 func (ac *cluster) Destroy() error {
+	var err multierror.Error
+
+	if e := ac.BaseCluster.Destroy(); e != nil {
+		err = append(err, e)
+	}
+
 	if !ac.RuntimeConf().NoSSHKeyInMetadata {
-		if err := ac.api.DeleteKey(ac.Name()); err != nil {
-			return err
+		if e := ac.api.DeleteKey(ac.Name()); e != nil {
+			err = append(err, e)
 		}
 	}
 
-	return ac.BaseCluster.Destroy()
+	return err.AsError()
+}
+
+func (ac *cluster) Supports(c platform.Capability) bool {
+	return capabilities.Has(c)
 }
@@ -15,8 +15,11 @@
 package aws
 
 import (
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"golang.org/x/crypto/ssh"
@@ -30,6 +33,12 @@ type machine struct {
 	dir     string
 	journal *platform.Journal
 	console string
+
+	// the latest console output read while the instance runs, and
+	// when, to space out requests
+	snapshotMu   sync.Mutex
+	snapshot     string
+	snapshotTime time.Time
 }
 
 func (am *machine) ID() string {
@@ -44,18 +53,45 @@ func (am *machine) PrivateIP() string {
 	return *am.mach.PrivateIpAddress
 }
 
+func (am *machine) DNSName() string {
+	if am.mach.PublicDnsName == nil {
+		return ""
+	}
+	return *am.mach.PublicDnsName
+}
+
 func (am *machine) SSHClient() (*ssh.Client, error) {
-	return am.cluster.SSHClient(am.IP())
+	return am.cluster.SSHClient(am.cluster.SSHHost(am))
 }
 
 func (am *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
-	return am.cluster.PasswordSSHClient(am.IP(), user, password)
+	return am.cluster.PasswordSSHClient(am.cluster.SSHHost(am), user, password)
 }
 
 func (am *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return am.cluster.SSH(am, cmd)
 }
 
+func (am *machine) SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return am.cluster.SSHWithInput(am, cmd, stdin)
+}
+
+func (am *machine) DiskUsage(path string) (*platform.DiskUsage, error) {
+	return am.cluster.DiskUsage(am, path)
+}
+
+func (am *machine) MemInfo() (*platform.MemInfo, error) {
+	return am.cluster.MemInfo(am)
+}
+
+func (am *machine) OSRelease() (map[string]string, error) {
+	return am.cluster.OSRelease(am)
+}
+
+func (am *machine) WaitForUnit(unit, state string, timeout time.Duration) error {
+	return am.cluster.WaitForUnit(am, unit, state, timeout)
+}
+
 func (m *machine) Reboot() error {
 	return platform.RebootMachine(m, m.journal, m.cluster.RuntimeConf())
 }
@@ -85,12 +121,41 @@ func (am *machine) ConsoleOutput() string {
 	return am.console
 }
 
+// ConsoleSnapshot returns am's console output so far, while it is
+// running. EC2 rate limits console requests, so output less than the
+// cluster's ConsolePollInterval old is reused rather than fetched again.
+func (am *machine) ConsoleSnapshot() (string, error) {
+	am.snapshotMu.Lock()
+	if !am.snapshotTime.IsZero() && time.Since(am.snapshotTime) < am.cluster.ConsolePollInterval() {
+		defer am.snapshotMu.Unlock()
+		return am.snapshot, nil
+	}
+	am.snapshotMu.Unlock()
+
+	// don't hold the lock while requests are retried
+	console, err := am.cluster.api.GetConsoleOutput(am.ID(), false, am.cluster.ConsolePollInterval())
+	if err != nil {
+		return "", err
+	}
+
+	am.snapshotMu.Lock()
+	defer am.snapshotMu.Unlock()
+	am.snapshot = platform.TruncateConsole(console, am.cluster.RuntimeConf().MaxConsoleSize)
+	am.snapshotTime = time.Now()
+	return am.snapshot, nil
+}
+
+func (am *machine) ConsoleURL() string {
+	return am.cluster.api.InstanceConsoleURL(am.ID())
+}
+
 func (am *machine) saveConsole() error {
 	var err error
-	am.console, err = am.cluster.api.GetConsoleOutput(am.ID(), true)
+	am.console, err = am.cluster.api.GetConsoleOutput(am.ID(), true, am.cluster.ConsolePollInterval())
 	if err != nil {
 		return err
 	}
+	am.console = platform.TruncateConsole(am.console, am.cluster.RuntimeConf().MaxConsoleSize)
 
 	path := filepath.Join(am.dir, "console.txt")
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
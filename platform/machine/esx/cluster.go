@@ -31,6 +31,11 @@ var (
 	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/machine/esx")
 )
 
+// capabilities are the optional platform features this backend provides.
+var capabilities = platform.Capabilities{
+	platform.CapConsole,
+}
+
 type cluster struct {
 	*platform.BaseCluster
 	api *esx.API
@@ -113,7 +118,12 @@ ExecStart=/usr/bin/bash -c 'echo "COREOS_ESX_IPV4_PRIVATE_0=$(ip addr show ens19
 		return nil, err
 	}
 
+	ec.SetMachineConfig(mach, conf)
 	ec.AddMach(mach)
 
 	return mach, nil
 }
+
+func (ec *cluster) Supports(c platform.Capability) bool {
+	return capabilities.Has(c)
+}
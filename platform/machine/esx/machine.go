@@ -16,8 +16,10 @@ package esx
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
@@ -45,18 +47,42 @@ func (em *machine) PrivateIP() string {
 	return em.mach.IPAddress
 }
 
+func (em *machine) DNSName() string {
+	return ""
+}
+
 func (em *machine) SSHClient() (*ssh.Client, error) {
-	return em.cluster.SSHClient(em.IP())
+	return em.cluster.SSHClient(em.cluster.SSHHost(em))
 }
 
 func (em *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
-	return em.cluster.PasswordSSHClient(em.IP(), user, password)
+	return em.cluster.PasswordSSHClient(em.cluster.SSHHost(em), user, password)
 }
 
 func (em *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return em.cluster.SSH(em, cmd)
 }
 
+func (em *machine) SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return em.cluster.SSHWithInput(em, cmd, stdin)
+}
+
+func (em *machine) DiskUsage(path string) (*platform.DiskUsage, error) {
+	return em.cluster.DiskUsage(em, path)
+}
+
+func (em *machine) MemInfo() (*platform.MemInfo, error) {
+	return em.cluster.MemInfo(em)
+}
+
+func (em *machine) OSRelease() (map[string]string, error) {
+	return em.cluster.OSRelease(em)
+}
+
+func (em *machine) WaitForUnit(unit, state string, timeout time.Duration) error {
+	return em.cluster.WaitForUnit(em, unit, state, timeout)
+}
+
 func (m *machine) Reboot() error {
 	return platform.RebootMachine(m, m.journal, m.cluster.RuntimeConf())
 }
@@ -95,6 +121,7 @@ func (em *machine) saveConsole() error {
 	if err != nil {
 		return err
 	}
+	em.console = platform.TruncateConsole(em.console, em.cluster.RuntimeConf().MaxConsoleSize)
 
 	path := filepath.Join(em.dir, "console.txt")
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
@@ -29,6 +29,13 @@ import (
 	"github.com/coreos/mantle/platform/conf"
 )
 
+// capabilities are the optional platform features this backend provides.
+var capabilities = platform.Capabilities{
+	platform.CapConsole,
+	platform.CapMetadata,
+	platform.CapMetadataSSHKey,
+}
+
 type cluster struct {
 	*platform.BaseCluster
 	api *gcloud.API
@@ -67,6 +74,12 @@ func (gc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
+	// GCE metadata must be text, so user-data can't be compressed.
+	ud, err := gc.UserDataBytes(conf, gcloud.MaxUserDataSize, false)
+	if err != nil {
+		return nil, err
+	}
+
 	var keys []*agent.Key
 	if !gc.RuntimeConf().NoSSHKeyInMetadata {
 		keys, err = gc.Keys()
@@ -75,7 +88,15 @@ func (gc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		}
 	}
 
-	instance, err := gc.api.CreateInstance(conf.String(), keys)
+	return gc.RetryBoot(func() (platform.Machine, error) {
+		return gc.boot(conf, ud, keys)
+	})
+}
+
+// boot creates an instance with conf, serialized as ud, and waits for it
+// to come up, destroying it if it doesn't.
+func (gc *cluster) boot(conf *conf.Conf, ud []byte, keys []*agent.Key) (platform.Machine, error) {
+	instance, err := gc.api.CreateInstance(string(ud), keys, gc.RuntimeConf().InstanceMetadata)
 	if err != nil {
 		return nil, err
 	}
@@ -108,10 +129,15 @@ func (gc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 
 	if err := platform.StartMachine(gm, gm.journal, gc.RuntimeConf()); err != nil {
 		gm.Destroy()
-		return nil, err
+		return nil, platform.BootError{Err: err}
 	}
 
+	gc.SetMachineConfig(gm, conf)
 	gc.AddMach(gm)
 
 	return gm, nil
 }
+
+func (gc *cluster) Supports(c platform.Capability) bool {
+	return capabilities.Has(c)
+}
@@ -15,8 +15,10 @@
 package gcloud
 
 import (
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
@@ -45,18 +47,43 @@ func (gm *machine) PrivateIP() string {
 	return gm.intIP
 }
 
+// DNSName returns an empty string; GCE only assigns internal DNS names.
+func (gm *machine) DNSName() string {
+	return ""
+}
+
 func (gm *machine) SSHClient() (*ssh.Client, error) {
-	return gm.gc.SSHClient(gm.IP())
+	return gm.gc.SSHClient(gm.gc.SSHHost(gm))
 }
 
 func (gm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
-	return gm.gc.PasswordSSHClient(gm.IP(), user, password)
+	return gm.gc.PasswordSSHClient(gm.gc.SSHHost(gm), user, password)
 }
 
 func (gm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return gm.gc.SSH(gm, cmd)
 }
 
+func (gm *machine) SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return gm.gc.SSHWithInput(gm, cmd, stdin)
+}
+
+func (gm *machine) DiskUsage(path string) (*platform.DiskUsage, error) {
+	return gm.gc.DiskUsage(gm, path)
+}
+
+func (gm *machine) MemInfo() (*platform.MemInfo, error) {
+	return gm.gc.MemInfo(gm)
+}
+
+func (gm *machine) OSRelease() (map[string]string, error) {
+	return gm.gc.OSRelease(gm)
+}
+
+func (gm *machine) WaitForUnit(unit, state string, timeout time.Duration) error {
+	return gm.gc.WaitForUnit(gm, unit, state, timeout)
+}
+
 func (m *machine) Reboot() error {
 	return platform.RebootMachine(m, m.journal, m.gc.RuntimeConf())
 }
@@ -92,6 +119,7 @@ func (gm *machine) saveConsole() error {
 	if err != nil {
 		return err
 	}
+	gm.console = platform.TruncateConsole(gm.console, gm.gc.RuntimeConf().MaxConsoleSize)
 
 	path := filepath.Join(gm.dir, "console.txt")
 	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0644)
@@ -103,3 +131,7 @@ func (gm *machine) saveConsole() error {
 
 	return nil
 }
+
+func (gm *machine) ConsoleURL() string {
+	return gm.gc.api.InstanceConsoleURL(gm.name)
+}
@@ -0,0 +1,132 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package kubernetes is a kola backend running each machine as a KubeVirt
+// virtual machine instance in a Kubernetes cluster, so CI can reuse
+// existing Kubernetes infrastructure. Machines are reached over SSH at
+// their pod IP, so kola must run where pod IPs are routable, such as in a
+// pod of the same cluster. Files can be copied with platform.PutDir and
+// GetDir over SSH, and the console is read from KubeVirt's serial console
+// log. Instance metadata is not supported.
+package kubernetes
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/platform/api/kubernetes"
+	"github.com/coreos/mantle/platform/conf"
+)
+
+var (
+	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/machine/kubernetes")
+)
+
+// capabilities are the optional platform features this backend provides.
+var capabilities = platform.Capabilities{
+	platform.CapConsole,
+}
+
+type cluster struct {
+	*platform.BaseCluster
+	api *kubernetes.API
+}
+
+// NewCluster creates an instance of a Cluster suitable for spawning
+// KubeVirt virtual machines in a Kubernetes cluster.
+func NewCluster(opts *kubernetes.Options, rconf *platform.RuntimeConfig) (platform.Cluster, error) {
+	api, err := kubernetes.New(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	bc, err := platform.NewBaseCluster(opts.BaseName, rconf, "")
+	if err != nil {
+		return nil, err
+	}
+
+	kc := &cluster{
+		BaseCluster: bc,
+		api:         api,
+	}
+
+	return kc, nil
+}
+
+// vmname returns a unique name which is a valid Kubernetes object name.
+func (kc *cluster) vmname() string {
+	b := make([]byte, 5)
+	rand.Read(b)
+	return fmt.Sprintf("%s-%x", strings.ToLower(kc.Name()), b)
+}
+
+func (kc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error) {
+	// the IP isn't known until the VMI is running
+	conf, err := kc.RenderUserData(userdata, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !conf.IsIgnition() {
+		return nil, fmt.Errorf("the kubernetes platform only supports Ignition configs")
+	}
+
+	name := kc.vmname()
+	ip, err := kc.api.CreateVMI(name, conf.String())
+	if err != nil {
+		return nil, err
+	}
+
+	mach := &machine{
+		cluster: kc,
+		name:    name,
+		ip:      ip,
+	}
+
+	mach.dir = filepath.Join(kc.RuntimeConf().OutputDir, mach.ID())
+	if err := os.Mkdir(mach.dir, 0777); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	confPath := filepath.Join(mach.dir, "user-data")
+	if err := conf.WriteFile(confPath); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if mach.journal, err = platform.NewJournal(mach.dir); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(mach, mach.journal, kc.RuntimeConf()); err != nil {
+		mach.Destroy()
+		return nil, err
+	}
+
+	kc.SetMachineConfig(mach, conf)
+	kc.AddMach(mach)
+
+	return mach, nil
+}
+
+func (kc *cluster) Supports(c platform.Capability) bool {
+	return capabilities.Has(c)
+}
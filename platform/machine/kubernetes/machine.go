@@ -0,0 +1,135 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kubernetes
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/pkg/multierror"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/platform"
+)
+
+type machine struct {
+	cluster *cluster
+	name    string
+	ip      string
+	dir     string
+	journal *platform.Journal
+	console string
+}
+
+func (km *machine) ID() string {
+	return km.name
+}
+
+func (km *machine) IP() string {
+	return km.ip
+}
+
+func (km *machine) PrivateIP() string {
+	return km.ip
+}
+
+func (km *machine) DNSName() string {
+	return ""
+}
+
+func (km *machine) SSHClient() (*ssh.Client, error) {
+	return km.cluster.SSHClient(km.cluster.SSHHost(km))
+}
+
+func (km *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
+	return km.cluster.PasswordSSHClient(km.cluster.SSHHost(km), user, password)
+}
+
+func (km *machine) SSH(cmd string) ([]byte, []byte, error) {
+	return km.cluster.SSH(km, cmd)
+}
+
+func (km *machine) SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return km.cluster.SSHWithInput(km, cmd, stdin)
+}
+
+func (km *machine) DiskUsage(path string) (*platform.DiskUsage, error) {
+	return km.cluster.DiskUsage(km, path)
+}
+
+func (km *machine) MemInfo() (*platform.MemInfo, error) {
+	return km.cluster.MemInfo(km)
+}
+
+func (km *machine) OSRelease() (map[string]string, error) {
+	return km.cluster.OSRelease(km)
+}
+
+func (km *machine) WaitForUnit(unit, state string, timeout time.Duration) error {
+	return km.cluster.WaitForUnit(km, unit, state, timeout)
+}
+
+func (km *machine) Reboot() error {
+	return platform.RebootMachine(km, km.journal, km.cluster.RuntimeConf())
+}
+
+// Destroy deletes the VMI even if stopping the journal or saving the
+// console fails, returning every error.
+func (km *machine) Destroy() error {
+	var err multierror.Error
+
+	if km.journal != nil {
+		if e := km.journal.Destroy(); e != nil {
+			err = append(err, e)
+		}
+	}
+
+	// the console log goes away with the VMI's pod
+	if e := km.saveConsole(); e != nil {
+		plog.Warningf("saving console of %s: %v", km.ID(), e)
+	}
+
+	if e := km.cluster.api.DeleteVMI(km.name); e != nil {
+		err = append(err, e)
+	}
+
+	km.cluster.DelMach(km)
+
+	return err.AsError()
+}
+
+func (km *machine) ConsoleOutput() string {
+	return km.console
+}
+
+func (km *machine) saveConsole() error {
+	console, err := km.cluster.api.GetConsoleOutput(km.name)
+	if err != nil {
+		return err
+	}
+	km.console = platform.TruncateConsole(console, km.cluster.RuntimeConf().MaxConsoleSize)
+
+	if km.dir == "" {
+		return nil
+	}
+	path := filepath.Join(km.dir, "console.txt")
+	if err := ioutil.WriteFile(path, []byte(km.console), 0666); err != nil {
+		return fmt.Errorf("failed writing console to file: %v", err)
+	}
+	return nil
+}
@@ -19,8 +19,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/coreos/pkg/capnslog"
+	"github.com/coreos/pkg/multierror"
 
 	ctplatform "github.com/coreos/container-linux-config-transpiler/config/platform"
 	"github.com/coreos/mantle/platform"
@@ -32,10 +34,20 @@ var (
 	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform/machine/packet")
 )
 
+// capabilities are the optional platform features this backend provides.
+var capabilities = platform.Capabilities{
+	platform.CapConsole,
+	platform.CapMetadata,
+	platform.CapMetadataSSHKey,
+}
+
 type cluster struct {
 	*platform.BaseCluster
 	api      *packet.API
 	sshKeyID string
+
+	consoleBanners       []string
+	consoleBannerTimeout time.Duration
 }
 
 func NewCluster(opts *packet.Options, rconf *platform.RuntimeConfig) (platform.Cluster, error) {
@@ -62,10 +74,17 @@ func NewCluster(opts *packet.Options, rconf *platform.RuntimeConfig) (platform.C
 		}
 	}
 
+	banners := opts.ConsoleBanners
+	if len(banners) == 0 {
+		banners = packet.DefaultConsoleBanners
+	}
+
 	pc := &cluster{
-		BaseCluster: bc,
-		api:         api,
-		sshKeyID:    keyID,
+		BaseCluster:          bc,
+		api:                  api,
+		sshKeyID:             keyID,
+		consoleBanners:       banners,
+		consoleBannerTimeout: opts.ConsoleBannerTimeout,
 	}
 
 	return pc, nil
@@ -80,6 +99,14 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		return nil, err
 	}
 
+	return pc.RetryBoot(func() (platform.Machine, error) {
+		return pc.boot(conf)
+	})
+}
+
+// boot creates a device with conf and waits for it to come up, destroying
+// it if it doesn't.
+func (pc *cluster) boot(conf *conf.Conf) (platform.Machine, error) {
 	vmname := pc.vmname()
 	// Stream the console somewhere temporary until we have a machine ID
 	consolePath := filepath.Join(pc.RuntimeConf().OutputDir, "console-"+vmname+".txt")
@@ -94,6 +121,7 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 		cons = &console{
 			pc:   pc,
 			f:    f,
+			buf:  platform.NewConsoleBuffer(pc.RuntimeConf().MaxConsoleSize),
 			done: make(chan interface{}),
 		}
 		pcons = cons
@@ -143,9 +171,10 @@ func (pc *cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 
 	if err := platform.StartMachine(mach, mach.journal, pc.RuntimeConf()); err != nil {
 		mach.Destroy()
-		return nil, err
+		return nil, platform.BootError{Err: err}
 	}
 
+	pc.SetMachineConfig(mach, conf)
 	pc.AddMach(mach)
 
 	return mach, nil
@@ -158,11 +187,21 @@ func (pc *cluster) vmname() string {
 }
 
 func (pc *cluster) Destroy() error {
+	var err multierror.Error
+
+	if e := pc.BaseCluster.Destroy(); e != nil {
+		err = append(err, e)
+	}
+
 	if pc.sshKeyID != "" {
-		if err := pc.api.DeleteKey(pc.sshKeyID); err != nil {
-			return err
+		if e := pc.api.DeleteKey(pc.sshKeyID); e != nil {
+			err = append(err, e)
 		}
 	}
 
-	return pc.BaseCluster.Destroy()
+	return err.AsError()
+}
+
+func (pc *cluster) Supports(c platform.Capability) bool {
+	return capabilities.Has(c)
 }
@@ -15,17 +15,22 @@
 package packet
 
 import (
-	"bytes"
 	"os"
+	"strings"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
+
+	"github.com/coreos/mantle/platform"
 )
 
 type console struct {
 	pc   *cluster
 	f    *os.File
-	buf  bytes.Buffer
+	buf  *platform.ConsoleBuffer
 	done chan interface{}
+	mu   sync.Mutex // protects buf
 }
 
 func (c *console) SSHClient(ip, user string) (*ssh.Client, error) {
@@ -33,7 +38,9 @@ func (c *console) SSHClient(ip, user string) (*ssh.Client, error) {
 }
 
 func (c *console) Write(p []byte) (int, error) {
+	c.mu.Lock()
 	c.buf.Write(p)
+	c.mu.Unlock()
 	return c.f.Write(p)
 }
 
@@ -42,7 +49,54 @@ func (c *console) Close() error {
 	return c.f.Close()
 }
 
+// Output waits for the console session to end and returns its output.
 func (c *console) Output() string {
 	<-c.done
+	return c.snapshot()
+}
+
+// snapshot returns the output received so far.
+func (c *console) snapshot() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.buf.String()
 }
+
+// closed reports whether the console session has ended.
+func (c *console) closed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// waitForBanners polls the console output until it contains banners or
+// the session ends, giving up after timeout.
+func (c *console) waitForBanners(banners []string, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if _, ok := findBanners(c.snapshot(), banners); ok {
+			return true
+		}
+		if c.closed() || !time.Now().Before(deadline) {
+			return false
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// findBanners returns output from the last of banners on, if all of them
+// appear in order.
+func findBanners(output string, banners []string) (string, bool) {
+	start := 0
+	for _, banner := range banners {
+		idx := strings.Index(output[start:], banner)
+		if idx == -1 {
+			return output, false
+		}
+		start += idx
+	}
+	return output[start:], true
+}
@@ -15,7 +15,8 @@
 package packet
 
 import (
-	"strings"
+	"io"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
@@ -44,23 +45,54 @@ func (pm *machine) PrivateIP() string {
 	return pm.privateIP
 }
 
+// DNSName returns an empty string; Packet does not assign DNS names.
+func (pm *machine) DNSName() string {
+	return ""
+}
+
 func (pm *machine) SSHClient() (*ssh.Client, error) {
-	return pm.cluster.SSHClient(pm.IP())
+	return pm.cluster.SSHClient(pm.cluster.SSHHost(pm))
 }
 
 func (pm *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
-	return pm.cluster.PasswordSSHClient(pm.IP(), user, password)
+	return pm.cluster.PasswordSSHClient(pm.cluster.SSHHost(pm), user, password)
 }
 
 func (pm *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return pm.cluster.SSH(pm, cmd)
 }
 
+func (pm *machine) SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return pm.cluster.SSHWithInput(pm, cmd, stdin)
+}
+
+func (pm *machine) DiskUsage(path string) (*platform.DiskUsage, error) {
+	return pm.cluster.DiskUsage(pm, path)
+}
+
+func (pm *machine) MemInfo() (*platform.MemInfo, error) {
+	return pm.cluster.MemInfo(pm)
+}
+
+func (pm *machine) OSRelease() (map[string]string, error) {
+	return pm.cluster.OSRelease(pm)
+}
+
+func (pm *machine) WaitForUnit(unit, state string, timeout time.Duration) error {
+	return pm.cluster.WaitForUnit(pm, unit, state, timeout)
+}
+
 func (m *machine) Reboot() error {
 	return platform.RebootMachine(m, m.journal, m.cluster.RuntimeConf())
 }
 
 func (pm *machine) Destroy() error {
+	// The console session ends when the device is deleted, so give
+	// output which lags behind the machine a chance to arrive first.
+	if pm.console != nil && pm.cluster.consoleBannerTimeout > 0 {
+		pm.console.waitForBanners(pm.cluster.consoleBanners, pm.cluster.consoleBannerTimeout)
+	}
+
 	if err := pm.cluster.api.DeleteDevice(pm.ID()); err != nil {
 		return err
 	}
@@ -79,19 +111,15 @@ func (pm *machine) ConsoleOutput() string {
 	if pm.console == nil {
 		return ""
 	}
-	output := pm.console.Output()
-	// The provisioning OS boots through iPXE and the real OS boots
-	// through GRUB.  Try to ignore console logs from provisioning, but
-	// it's better to return everything than nothing.
-	grub := strings.Index(output, "GNU GRUB")
-	if grub == -1 {
-		plog.Warningf("Couldn't find GRUB banner in console output of %s", pm.ID())
-		return output
-	}
-	linux := strings.Index(output[grub:], "Linux version")
-	if linux == -1 {
-		plog.Warningf("Couldn't find Linux banner in console output of %s", pm.ID())
-		return output
+	// Try to ignore console logs from the provisioning OS, but it's
+	// better to return everything than nothing.
+	output, ok := findBanners(pm.console.Output(), pm.cluster.consoleBanners)
+	if !ok {
+		plog.Warningf("Couldn't find boot banners %q in console output of %s", pm.cluster.consoleBanners, pm.ID())
 	}
-	return output[grub+linux:]
+	return output
+}
+
+func (pm *machine) ConsoleURL() string {
+	return pm.cluster.api.DeviceConsoleURL(pm.ID())
 }
@@ -0,0 +1,100 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemu
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/coreos/mantle/platform"
+)
+
+const (
+	balloonPollDelay = time.Second
+	balloonTimeout   = 2 * time.Minute
+)
+
+// Memory returns how much memory in MiB m has with its balloon at its
+// current size. The machine must have a balloon device.
+func (qc *Cluster) Memory(m platform.Machine) (int, error) {
+	qm, ok := m.(*machine)
+	if !ok {
+		return 0, fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+	if !qm.balloon {
+		return 0, fmt.Errorf("machine %s has no balloon device", m.ID())
+	}
+	actual, err := qm.balloonSize()
+	if err != nil {
+		return 0, err
+	}
+	return int(actual >> 20), nil
+}
+
+// SetMemory inflates or deflates the memory balloon of m so that the guest
+// has mib MiB of memory, and waits for the guest to comply. mib may not
+// exceed the memory m booted with. The machine must have a balloon
+// device; see Options.Balloon.
+func (qc *Cluster) SetMemory(m platform.Machine, mib int) error {
+	qm, ok := m.(*machine)
+	if !ok {
+		return fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+	if !qm.balloon {
+		return fmt.Errorf("machine %s has no balloon device", m.ID())
+	}
+	if max := memoryMB(qm.args); mib <= 0 || mib > max {
+		return fmt.Errorf("memory of %s must be between 1 and %d MiB, not %d", m.ID(), max, mib)
+	}
+
+	target := int64(mib) << 20
+	if _, err := qm.qmp("balloon", map[string]int64{"value": target}); err != nil {
+		return err
+	}
+
+	// the guest's balloon driver resizes the balloon asynchronously
+	deadline := time.Now().Add(balloonTimeout)
+	for {
+		actual, err := qm.balloonSize()
+		if err != nil {
+			return err
+		}
+		if actual == target {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %s to reach %d MiB of memory, at %d MiB", m.ID(), mib, actual>>20)
+		}
+		time.Sleep(balloonPollDelay)
+	}
+}
+
+// balloonSize returns the guest memory in bytes left by the balloon.
+func (m *machine) balloonSize() (int64, error) {
+	ret, err := m.qmp("query-balloon", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	var info struct {
+		Actual int64 `json:"actual"`
+	}
+	if err := json.Unmarshal(ret, &info); err != nil {
+		return 0, fmt.Errorf("parsing query-balloon result: %v", err)
+	}
+	return info.Actual, nil
+}
@@ -15,13 +15,19 @@
 package qemu
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/coreos/pkg/capnslog"
 	"github.com/satori/go.uuid"
@@ -35,21 +41,176 @@ import (
 
 const (
 	primaryDiskId = "primary-disk"
+
+	defaultHugepagesPath = "/dev/hugepages"
+
+	// pointerConfig replaces itself with the config at the given URL.
+	pointerConfig = `{"ignition": {"version": "2.0.0", "config": {"replace": {"source": %q}}}}`
 )
 
+// hugetlbfsMagic is the statfs type of a hugetlbfs mount. Statfs_t.Type
+// is int32 on some architectures, so compare it as uint32.
+const hugetlbfsMagic uint32 = 0x958458f6
+
 // Options contains QEMU-specific options for the cluster.
 type Options struct {
 	// DiskImage is the full path to the disk image to boot in QEMU.
 	DiskImage string
 	Board     string
 
+	// DiskImageSignature, if set, is a detached OpenPGP signature of
+	// DiskImage to verify against the keys in Keyring before booting
+	// it. Per-machine DiskImage overrides must then have their own
+	// MachineOptions.DiskImageSignature.
+	DiskImageSignature string
+	Keyring            string
+
 	// BIOSImage is name of the BIOS file to pass to QEMU.
 	// It can be a plain name, or a full path.
 	BIOSImage string
 
+	// SharedDirs are host directories exported to every guest over
+	// virtfs/9p. Guests mount them by tag, e.g.
+	// `mount -t 9p -o trans=virtio <MountTag> /mnt`.
+	SharedDirs []SharedDir
+
+	// CapturePackets records all traffic on the cluster bridge to a
+	// pcap file in the cluster's output directory.
+	CapturePackets bool
+
+	// RTC configures the guests' real time clock. The zero value keeps
+	// QEMU's defaults.
+	RTC RTC
+
+	// ConsoleSocket additionally exposes each guest's serial console on
+	// a unix socket in its output directory, for attaching to a live
+	// machine with e.g. `socat -,raw,echo=0 UNIX-CONNECT:<path>`. QEMU
+	// runs in the cluster's network namespace, so a TCP listener would
+	// not be reachable from the host.
+	ConsoleSocket bool
+
+	// VNC serves each guest's graphical display over VNC, for debugging
+	// boot problems which never reach the serial console. It is served
+	// on a unix socket, vnc.sock in the machine's output directory,
+	// since QEMU runs in the cluster's network namespace where a TCP
+	// port would be unreachable from the host; forward one with e.g.
+	// `socat TCP-LISTEN:5900,fork UNIX-CONNECT:<socket>`. Guests have
+	// no display by default.
+	VNC bool
+
+	// DHCP customizes the lease time and addresses of the cluster's
+	// DHCP server, e.g. to test lease renewal.
+	DHCP local.DHCPOptions
+
+	// NICModel is the QEMU device model of the guests' network
+	// interface: "virtio-net" (the default), "e1000", or "rtl8139".
+	NICModel string
+
+	// Hugepages backs guest RAM with huge pages from the hugetlbfs
+	// mounted at HugepagesPath (default /dev/hugepages). The host must
+	// have enough huge pages reserved for every guest, e.g.
+	// `echo 1024 > /proc/sys/vm/nr_hugepages` for 2 GiB of 2 MiB pages,
+	// and a hugetlbfs mounted with `mount -t hugetlbfs none /dev/hugepages`.
+	Hugepages     bool
+	HugepagesPath string
+
+	// CPUFlags are CPU features to enable ("+aes") or disable
+	// ("-avx512f"), appended to the -cpu option. With "-cpu host",
+	// the default for native guests, only features the host CPU
+	// supports can be enabled.
+	CPUFlags []string
+
+	// Watchdog attaches an emulated i6300esb watchdog to each guest,
+	// which QEMU acts on if the guest arms it and then stops pinging it:
+	// "reset", "poweroff", "shutdown", "pause", "debug", "none", or
+	// "inject-nmi". The guest must open /dev/watchdog to arm it. No
+	// watchdog is attached if it is empty.
+	Watchdog string
+
+	// DiskCache and DiskAIO set the host cache mode and asynchronous
+	// I/O backend of every guest disk, unless overridden per disk.
+	// DiskCache is "none", "writeback", or "writethrough"; DiskAIO is
+	// "threads", "native", or "io_uring". Empty values keep QEMU's
+	// defaults, cache=writeback and aio=threads. aio=native requires
+	// cache=none, since it needs the file opened with O_DIRECT.
+	DiskCache string
+	DiskAIO   string
+
+	// Balloon attaches a virtio memory balloon to each guest, through
+	// which Cluster.SetMemory can change the guest's memory while it
+	// runs.
+	Balloon bool
+
+	// OmitDefaults passes -nodefaults, so QEMU creates none of its
+	// default devices, such as the VGA card, floppy and CD-ROM drives,
+	// and parallel port. Guests get only the devices kola wires up,
+	// less OmitDevices, plus any ExtraQEMUArgs, which is useful for
+	// checking that minimal images boot without them.
+	OmitDefaults bool
+
+	// OmitDevices names devices kola would otherwise attach to guests
+	// which they should boot without: "rng" for the virtio entropy
+	// source every guest gets, or "balloon" or "watchdog" to override
+	// Balloon and Watchdog.
+	OmitDevices []string
+
+	// ExtraQEMUArgs are appended to the QEMU command line of every
+	// guest, after the arguments kola assembles and before the console,
+	// QMP, and network arguments, to add or swap devices.
+	ExtraQEMUArgs []string
+
+	// Cgroup runs each cluster's QEMU processes in a host cgroup with
+	// the given limits, so a runaway guest can't destabilize the host.
+	Cgroup local.CgroupOptions
+
 	*platform.Options
 }
 
+// RTC describes the guest real time clock, passed to QEMU's -rtc option.
+type RTC struct {
+	// Base is "utc", "localtime", or a starting wall-clock time; use
+	// RTCBase to format one.
+	Base string
+
+	// Clock is the clock driving the RTC: "host", "rt", or "vm".
+	Clock string
+}
+
+// RTCBase formats t as an RTC Base starting time.
+func RTCBase(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05")
+}
+
+// SkewedRTC returns RTC settings starting the guest clock d ahead of the
+// host's, or behind it if d is negative, for testing clock
+// synchronization between machines.
+func SkewedRTC(d time.Duration) *RTC {
+	return &RTC{Base: RTCBase(time.Now().Add(d))}
+}
+
+func (r RTC) arg() string {
+	var opts []string
+	if r.Base != "" {
+		opts = append(opts, "base="+r.Base)
+	}
+	if r.Clock != "" {
+		opts = append(opts, "clock="+r.Clock)
+	}
+	return strings.Join(opts, ",")
+}
+
+// SharedDir describes a host directory shared with QEMU guests.
+type SharedDir struct {
+	HostPath string // directory on the host to export
+	MountTag string // 9p mount tag the guest uses to find the share
+	ReadOnly bool   // export the directory read-only
+}
+
+// capabilities are the optional platform features this backend provides.
+var capabilities = platform.Capabilities{
+	platform.CapConsole,
+}
+
 // Cluster is a local cluster of QEMU-based virtual machines.
 //
 // XXX: must be exported so that certain QEMU tests can access struct members
@@ -59,25 +220,130 @@ type Cluster struct {
 
 	mu sync.Mutex
 	*local.LocalCluster
+
+	namesMu  sync.Mutex
+	names    map[string]bool // machine names reserved in this cluster
+	manifest []manifestEntry // started machines, for the output manifest
+}
+
+// manifestFile lists the cluster's machines in its output directory.
+const manifestFile = "machines.json"
+
+// manifestEntry describes one machine in the output manifest.
+type manifestEntry struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
 }
 
 type MachineOptions struct {
 	AdditionalDisks []Disk
+
+	// Name is a human-friendly name for the machine, such as "etcd-0",
+	// used alongside its UUID in output and recorded with it in
+	// <output dir>/machines.json. The machine's output directory is also
+	// linked from <output dir>/<name>, so names must be unique within a
+	// cluster.
+	Name string
+
+	// NVMeRoot attaches the primary disk as an emulated NVMe device
+	// instead of virtio-blk.
+	NVMeRoot bool
+
+	// RootDiskCache and RootDiskAIO override the cluster's DiskCache
+	// and DiskAIO for the primary disk.
+	RootDiskCache string
+	RootDiskAIO   string
+
+	// Board, DiskImage, and BIOSImage override the cluster-wide
+	// Options for this machine, allowing clusters that mix
+	// architectures. DiskImage is required if Board differs from the
+	// cluster's board.
+	Board     string
+	DiskImage string
+	BIOSImage string
+
+	// DiskImageSignature is a detached OpenPGP signature of DiskImage,
+	// verified against the cluster's Keyring. It is required if the
+	// cluster verifies its own DiskImage.
+	DiskImageSignature string
+
+	// ServeIgnition serves the rendered Ignition config from the host
+	// over HTTP and boots the machine with a pointer config that
+	// replaces itself with it, exercising Ignition's remote fetch. The
+	// config is served at qc.ConfigURL(<machine ID>.ign).
+	ServeIgnition bool
+
+	// RTC overrides the cluster's RTC settings for this machine, e.g. to
+	// boot it with a fixed wall-clock time.
+	RTC *RTC
+
+	// NICModel overrides the cluster's network device model for this
+	// machine.
+	NICModel string
+
+	// Watchdog overrides the cluster's watchdog action for this machine.
+	Watchdog string
+
+	// Balloon attaches a memory balloon to this machine even if the
+	// cluster's Balloon is unset.
+	Balloon bool
+
+	// ExtraQEMUArgs are appended to the cluster's ExtraQEMUArgs for
+	// this machine.
+	ExtraQEMUArgs []string
+
+	// OmitDevices are omitted from this machine in addition to the
+	// cluster's OmitDevices.
+	OmitDevices []string
+
+	// StaticNetwork attaches a second network interface to a bridge
+	// without DHCP, which the guest must configure itself; see
+	// Cluster.StaticInterface.
+	StaticNetwork bool
 }
 
 type Disk struct {
 	Size   string // disk image size in bytes, optional suffixes "K", "M", "G", "T" allowed
 	Serial string // serial number to be passed to qemu via `serial=`. Disks show up under /dev/disk/by-id/virtio-<serial>
+	NVMe   bool   // attach as an emulated NVMe device; it shows up under /dev/disk/by-id/nvme-QEMU_NVMe_Ctrl_<serial>
+	Cache  string // host cache mode, overriding Options.DiskCache
+	AIO    string // asynchronous I/O backend, overriding Options.DiskAIO
 }
 
 var (
 	plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "kola/platform/machine/qemu")
+
+	cpuFlagRegexp = regexp.MustCompile(`^[+-][a-z0-9][a-z0-9_.-]*$`)
 )
 
 // NewCluster creates a Cluster instance, suitable for running virtual
 // machines in QEMU.
 func NewCluster(opts *Options, rconf *platform.RuntimeConfig) (platform.Cluster, error) {
-	lc, err := local.NewLocalCluster(opts.BaseName, rconf)
+	for _, flag := range opts.CPUFlags {
+		if !cpuFlagRegexp.MatchString(flag) {
+			return nil, fmt.Errorf("invalid CPU flag %q, expected +feature or -feature", flag)
+		}
+	}
+
+	if err := checkWatchdogAction(opts.Watchdog); err != nil {
+		return nil, err
+	}
+
+	if err := checkOmitDevices(opts.OmitDevices); err != nil {
+		return nil, err
+	}
+
+	if err := checkDiskIO(opts.DiskCache, opts.DiskAIO); err != nil {
+		return nil, err
+	}
+
+	if opts.DiskImageSignature != "" {
+		if _, err := local.VerifyImage(opts.DiskImage, opts.DiskImageSignature, opts.Keyring); err != nil {
+			return nil, err
+		}
+	}
+
+	lc, err := local.NewLocalCluster(opts.BaseName, rconf, opts.DHCP, opts.Cgroup)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +351,14 @@ func NewCluster(opts *Options, rconf *platform.RuntimeConfig) (platform.Cluster,
 	qc := &Cluster{
 		opts:         opts,
 		LocalCluster: lc,
+		names:        make(map[string]bool),
+	}
+
+	if opts.CapturePackets {
+		if _, err := qc.StartCapture(); err != nil {
+			qc.Destroy()
+			return nil, err
+		}
 	}
 
 	return qc, nil
@@ -97,6 +371,23 @@ func (qc *Cluster) NewMachine(userdata *conf.UserData) (platform.Machine, error)
 func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options MachineOptions) (platform.Machine, error) {
 	id := uuid.NewV4()
 
+	if strings.ContainsAny(options.Name, "/,") || options.Name == "." || options.Name == ".." || options.Name == manifestFile {
+		return nil, fmt.Errorf("invalid machine name %q", options.Name)
+	}
+	if err := qc.reserveName(options.Name); err != nil {
+		return nil, err
+	}
+	started := false
+	var servedConfig string
+	defer func() {
+		if !started {
+			qc.releaseName(options.Name)
+			if servedConfig != "" {
+				qc.ConfigSrv.Remove(servedConfig)
+			}
+		}
+	}()
+
 	dir := filepath.Join(qc.RuntimeConf().OutputDir, id.String())
 	if err := os.Mkdir(dir, 0777); err != nil {
 		return nil, err
@@ -106,7 +397,15 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options Machin
 	// NOTE: escaping is not supported
 	qc.mu.Lock()
 	netif := qc.Dnsmasq.GetInterface("br0")
-	ip := strings.Split(netif.DHCPv4[0].String(), "/")[0]
+	var staticIf *local.Interface
+	if options.StaticNetwork {
+		staticIf = qc.Dnsmasq.GetInterface(qc.Dnsmasq.Static.BridgeName)
+	}
+	ip, err := leaseIP(netif)
+	if err != nil {
+		qc.mu.Unlock()
+		return nil, err
+	}
 
 	conf, err := qc.RenderUserData(userdata, map[string]string{
 		"$public_ipv4":  ip,
@@ -124,6 +423,19 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options Machin
 		if err := conf.WriteFile(confPath); err != nil {
 			return nil, err
 		}
+
+		if options.ServeIgnition {
+			servedConfig = id.String() + ".ign"
+			qc.ConfigSrv.Add(servedConfig, conf.Bytes())
+
+			confPath = filepath.Join(dir, "ignition-pointer.json")
+			pointer := fmt.Sprintf(pointerConfig, qc.ConfigURL(servedConfig))
+			if err := ioutil.WriteFile(confPath, []byte(pointer), 0666); err != nil {
+				return nil, err
+			}
+		}
+	} else if options.ServeIgnition {
+		return nil, fmt.Errorf("ServeIgnition requires an Ignition config")
 	} else {
 		confPath, err = local.MakeConfigDrive(conf, dir)
 		if err != nil {
@@ -137,15 +449,51 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options Machin
 	}
 
 	qm := &machine{
-		qc:          qc,
-		id:          id.String(),
-		netif:       netif,
-		journal:     journal,
-		consolePath: filepath.Join(dir, "console.txt"),
+		qc:           qc,
+		id:           id.String(),
+		name:         options.Name,
+		netif:        netif,
+		staticIf:     staticIf,
+		journal:      journal,
+		dir:          dir,
+		consolePath:  filepath.Join(dir, "console.txt"),
+		qmpPath:      filepath.Join(dir, "qmp.sock"),
+		servedConfig: servedConfig,
+	}
+
+	board, diskImage, biosImage := qc.opts.Board, qc.opts.DiskImage, qc.opts.BIOSImage
+	diskImageSig := qc.opts.DiskImageSignature
+	if options.Board != "" && options.Board != board {
+		board = options.Board
+		diskImage, biosImage, diskImageSig = "", "", ""
+	}
+	if options.DiskImage != "" {
+		diskImage, diskImageSig = options.DiskImage, options.DiskImageSignature
+	}
+	if options.BIOSImage != "" {
+		biosImage = options.BIOSImage
+	}
+	if diskImage == "" {
+		return nil, fmt.Errorf("no disk image specified for board %q", board)
+	}
+	var verifiedImage *os.File
+	if diskImageSig != "" {
+		if verifiedImage, err = local.VerifyImage(diskImage, diskImageSig, qc.opts.Keyring); err != nil {
+			return nil, err
+		}
+	} else if qc.opts.DiskImageSignature != "" {
+		return nil, fmt.Errorf("disk image %s has no signature to verify", diskImage)
+	}
+	qm.nicModel = qc.opts.NICModel
+	if options.NICModel != "" {
+		qm.nicModel = options.NICModel
+	}
+	if err := checkNICModel(qm.nicModel); err != nil {
+		return nil, err
 	}
 
 	var qmCmd []string
-	combo := runtime.GOARCH + "--" + qc.opts.Board
+	combo := runtime.GOARCH + "--" + board
 	switch combo {
 	case "amd64--amd64-usr":
 		qmCmd = []string{
@@ -169,129 +517,576 @@ func (qc *Cluster) NewMachineWithOptions(userdata *conf.UserData, options Machin
 			"-m", "1024",
 		}
 	case "arm64--arm64-usr":
-		qmCmd = []string{
-			"qemu-system-aarch64",
-			"-machine", "virt,accel=kvm,gic-version=3",
-			"-cpu", "host",
-			"-m", "2048",
+		if kvmAvailable() {
+			qmCmd = []string{
+				"qemu-system-aarch64",
+				"-machine", "virt,accel=kvm,gic-version=3",
+				"-cpu", "host",
+				"-m", "2048",
+			}
+		} else {
+			plog.Warningf("/dev/kvm unavailable, emulating %s", board)
+			qmCmd = []string{
+				"qemu-system-aarch64",
+				"-machine", "virt",
+				"-cpu", "cortex-a57",
+				"-m", "2048",
+			}
 		}
 	default:
-		panic("host-guest combo not supported: " + combo)
+		return nil, fmt.Errorf("host-guest combo not supported: %s", combo)
+	}
+
+	if len(qc.opts.CPUFlags) > 0 {
+		for i := 0; i < len(qmCmd)-1; i++ {
+			if qmCmd[i] == "-cpu" {
+				qmCmd[i+1] += "," + strings.Join(qc.opts.CPUFlags, ",")
+				break
+			}
+		}
+	}
+
+	if qc.opts.Hugepages {
+		path := qc.opts.HugepagesPath
+		if path == "" {
+			path = defaultHugepagesPath
+		}
+		if err := checkHugepages(path, memoryMB(qmCmd)); err != nil {
+			return nil, err
+		}
+		qmCmd = append(qmCmd, "-mem-path", path, "-mem-prealloc")
 	}
 
-	qmMac := qm.netif.HardwareAddr.String()
+	qm.board = board
+	if biosImage != "" {
+		qmCmd = append(qmCmd, "-bios", biosImage)
+	}
 	qmCmd = append(qmCmd,
-		"-bios", qc.opts.BIOSImage,
 		"-smp", "1",
 		"-uuid", qm.id,
 		"-display", "none",
-		"-chardev", "file,id=log,path="+qm.consolePath,
-		"-serial", "chardev:log",
 	)
+	if qm.name != "" {
+		qmCmd = append(qmCmd, "-name", qm.name)
+	}
+	if qc.opts.OmitDefaults {
+		qmCmd = append(qmCmd, "-nodefaults")
+	}
+
+	if err := checkOmitDevices(options.OmitDevices); err != nil {
+		return nil, err
+	}
+	omit := func(device string) bool {
+		return containsString(qc.opts.OmitDevices, device) || containsString(options.OmitDevices, device)
+	}
+	if !omit("rng") {
+		rng, err := virtio(board, "rng", "rng=rng0")
+		if err != nil {
+			return nil, err
+		}
+		qmCmd = append(qmCmd,
+			"-object", "rng-random,id=rng0,filename=/dev/urandom",
+			"-device", rng)
+	}
+	if (qc.opts.Balloon || options.Balloon) && !omit("balloon") {
+		balloon, err := virtio(board, "balloon", "id=balloon0")
+		if err != nil {
+			return nil, err
+		}
+		qm.balloon = true
+		qmCmd = append(qmCmd, "-device", balloon)
+	}
+
+	rtc := qc.opts.RTC
+	if options.RTC != nil {
+		rtc = *options.RTC
+	}
+	if arg := rtc.arg(); arg != "" {
+		qmCmd = append(qmCmd, "-rtc", arg)
+	}
+
+	watchdog := qc.opts.Watchdog
+	if options.Watchdog != "" {
+		watchdog = options.Watchdog
+	}
+	if err := checkWatchdogAction(watchdog); err != nil {
+		return nil, err
+	}
+	if watchdog != "" && !omit("watchdog") {
+		qmCmd = append(qmCmd, "-device", "i6300esb", "-watchdog-action", watchdog)
+	}
 
 	if conf.IsIgnition() {
 		qmCmd = append(qmCmd,
 			"-fw_cfg", "name=opt/com.coreos/config,file="+confPath)
 	} else {
+		cfg, err := virtio(board, "9p", "fsdev=cfg,mount_tag=config-2")
+		if err != nil {
+			return nil, err
+		}
 		qmCmd = append(qmCmd,
 			"-fsdev", "local,id=cfg,security_model=none,readonly,path="+confPath,
-			"-device", qc.virtio("9p", "fsdev=cfg,mount_tag=config-2"))
+			"-device", cfg)
+	}
+
+	for i, dir := range qc.opts.SharedDirs {
+		path, err := filepath.Abs(dir.HostPath)
+		if err != nil {
+			return nil, err
+		}
+		fsdev := fmt.Sprintf("local,id=shared%d,security_model=none,path=%s", i, path)
+		if dir.ReadOnly {
+			fsdev += ",readonly"
+		}
+		device, err := virtio(board, "9p", fmt.Sprintf("fsdev=shared%d,mount_tag=%s", i, dir.MountTag))
+		if err != nil {
+			return nil, err
+		}
+		qmCmd = append(qmCmd,
+			"-fsdev", fsdev,
+			"-device", device)
 	}
 
-	var extraFiles []*os.File
 	fdnum := 3 // first additional file starts at position 3
 	fdset := 1
 
-	addDisk := func(file *os.File, serial string) {
+	// The disk files stay open for the life of the machine so that a
+	// migration destination can share them.
+	addDisk := func(file *os.File, serial string, nvme bool, cache, aio string) error {
+		qm.files = append(qm.files, file)
 		id := fmt.Sprintf("d%d", fdnum)
-		qmCmd = append(qmCmd, "-add-fd", fmt.Sprintf("fd=%d,set=%d", fdnum, fdset),
-			"-drive", fmt.Sprintf("if=none,id=%s,format=qcow2,file=/dev/fdset/%d,serial=%s", id, fdset, serial),
-			"-device", qc.virtio("blk", fmt.Sprintf("drive=%s", id)))
+		drive := fmt.Sprintf("if=none,id=%s,format=qcow2,file=/dev/fdset/%d", id, fdset)
+		if cache != "" {
+			drive += ",cache=" + cache
+		}
+		if aio != "" {
+			drive += ",aio=" + aio
+		}
+		qmCmd = append(qmCmd, "-add-fd", fmt.Sprintf("fd=%d,set=%d", fdnum, fdset))
+		if nvme {
+			// NVMe takes its serial number on the device, not the drive
+			qmCmd = append(qmCmd,
+				"-drive", drive,
+				"-device", fmt.Sprintf("nvme,drive=%s,serial=%s", id, serial))
+		} else {
+			device, err := virtio(board, "blk", fmt.Sprintf("drive=%s", id))
+			if err != nil {
+				return err
+			}
+			qmCmd = append(qmCmd,
+				"-drive", fmt.Sprintf("%s,serial=%s", drive, serial),
+				"-device", device)
+		}
 		fdnum += 1
 		fdset += 1
-		extraFiles = append(extraFiles, file)
+		return nil
 	}
 
-	diskFile, err := setupPrimaryDisk(qc.opts.DiskImage)
+	rootCache, rootAIO := diskIO(qc.opts, options.RootDiskCache, options.RootDiskAIO)
+	if err := checkDiskIO(rootCache, rootAIO); err != nil {
+		return nil, err
+	}
+	for _, disk := range options.AdditionalDisks {
+		cache, aio := diskIO(qc.opts, disk.Cache, disk.AIO)
+		if err := checkDiskIO(cache, aio); err != nil {
+			return nil, fmt.Errorf("disk %q: %v", disk.Serial, err)
+		}
+	}
+
+	diskFile, err := setupPrimaryDisk(diskImage, verifiedImage)
 	if err != nil {
 		return nil, err
 	}
-	defer diskFile.Close()
-	addDisk(diskFile, primaryDiskId)
+	if err := addDisk(diskFile, primaryDiskId, options.NVMeRoot, rootCache, rootAIO); err != nil {
+		qm.closeFiles()
+		return nil, err
+	}
 
 	for _, disk := range options.AdditionalDisks {
 		optionsDiskFile, err := setupDisk(disk.Size)
 		if err != nil {
+			qm.closeFiles()
+			return nil, err
+		}
+		cache, aio := diskIO(qc.opts, disk.Cache, disk.AIO)
+		if err := addDisk(optionsDiskFile, disk.Serial, disk.NVMe, cache, aio); err != nil {
+			qm.closeFiles()
 			return nil, err
 		}
-		defer optionsDiskFile.Close()
-		addDisk(optionsDiskFile, disk.Serial)
 	}
 
-	qc.mu.Lock()
+	if qc.opts.ConsoleSocket {
+		qm.consoleSock = filepath.Join(dir, "console.sock")
+	}
+	if qc.opts.VNC {
+		qm.vncSock = filepath.Join(dir, "vnc.sock")
+	}
+
+	qmCmd = append(qmCmd, qc.opts.ExtraQEMUArgs...)
+	qmCmd = append(qmCmd, options.ExtraQEMUArgs...)
+
+	qm.args = qmCmd
+	if qm.qemu, err = qm.launch(qm.qmpPath, qm.consoleSock, qm.vncSock, ""); err != nil {
+		qm.closeFiles()
+		return nil, err
+	}
+
+	if err := platform.StartMachine(qm, qm.journal, qc.RuntimeConf()); err != nil {
+		qm.Destroy()
+		return nil, err
+	}
+
+	// link the name only once the machine is up, so failed machines
+	// don't leave links behind
+	if options.Name != "" {
+		link := filepath.Join(qc.RuntimeConf().OutputDir, options.Name)
+		if err := os.Symlink(id.String(), link); err != nil {
+			qm.Destroy()
+			return nil, fmt.Errorf("naming machine %s: %v", id, err)
+		}
+	}
+	if err := qc.addToManifest(manifestEntry{ID: qm.id, Name: qm.name}); err != nil {
+		qm.Destroy()
+		return nil, err
+	}
+	started = true
+
+	qc.SetMachineConfig(qm, conf)
+	qc.AddMach(qm)
+
+	return qm, nil
+}
+
+// reserveName claims name for a new machine, failing if another machine
+// in the cluster already has it. Names stay reserved after their machine
+// is destroyed, since its output directory is still linked by name.
+func (qc *Cluster) reserveName(name string) error {
+	if name == "" {
+		return nil
+	}
+	qc.namesMu.Lock()
+	defer qc.namesMu.Unlock()
+	if qc.names[name] {
+		return fmt.Errorf("machine name %q already in use", name)
+	}
+	qc.names[name] = true
+	return nil
+}
 
-	tap, err := qc.NewTap("br0")
+// releaseName frees a name reserved for a machine which failed to start.
+func (qc *Cluster) releaseName(name string) {
+	qc.namesMu.Lock()
+	defer qc.namesMu.Unlock()
+	delete(qc.names, name)
+}
+
+// addToManifest records a started machine in the cluster's output
+// manifest, rewriting the whole file so it is always valid JSON.
+func (qc *Cluster) addToManifest(e manifestEntry) error {
+	qc.namesMu.Lock()
+	defer qc.namesMu.Unlock()
+	qc.manifest = append(qc.manifest, e)
+	buf, err := json.MarshalIndent(qc.manifest, "", "  ")
 	if err != nil {
-		qc.mu.Unlock()
+		return err
+	}
+	path := filepath.Join(qc.RuntimeConf().OutputDir, manifestFile)
+	if err := ioutil.WriteFile(path, append(buf, '\n'), 0666); err != nil {
+		return fmt.Errorf("writing machine manifest: %v", err)
+	}
+	return nil
+}
+
+// launch starts a QEMU process for m with its QMP socket at qmpPath and a
+// new tap device. If consoleSock is set, the console is also served on that
+// unix socket, and if vncSock is set, the display is served over VNC on
+// that one. If incoming is set, the process waits for a live migration
+// from that URI instead of booting.
+func (m *machine) launch(qmpPath, consoleSock, vncSock, incoming string) (exec.Cmd, error) {
+	console := "file,id=log,path=" + m.consolePath
+	if consoleSock != "" {
+		// the socket chardev still records everything to the log file
+		console = fmt.Sprintf("socket,id=log,path=%s,server,nowait,logfile=%s", consoleSock, m.consolePath)
+	}
+	if incoming != "" {
+		// keep the console output of the migration source
+		if consoleSock != "" {
+			console += ",logappend=on"
+		} else {
+			console += ",append=on"
+		}
+	}
+
+	qmCmd := append([]string{}, m.args...)
+	qmCmd = append(qmCmd,
+		"-chardev", console,
+		"-serial", "chardev:log",
+		"-qmp", "unix:"+qmpPath+",server,nowait",
+	)
+	if vncSock != "" {
+		qmCmd = append(qmCmd, "-vnc", "unix:"+vncSock)
+	}
+	if incoming != "" {
+		qmCmd = append(qmCmd, "-incoming", incoming)
+	}
+
+	m.qc.mu.Lock()
+
+	tap, err := m.qc.NewTap("br0")
+	if err != nil {
+		m.qc.mu.Unlock()
 		return nil, err
 	}
 	defer tap.Close()
+	fdnum := 3 + len(m.files)
+	nic, err := nicDevice(m.board, m.nicModel, "netdev=tap,mac="+m.netif.HardwareAddr.String())
+	if err != nil {
+		m.qc.mu.Unlock()
+		return nil, err
+	}
 	qmCmd = append(qmCmd, "-netdev", fmt.Sprintf("tap,id=tap,fd=%d", fdnum),
-		"-device", qc.virtio("net", "netdev=tap,mac="+qmMac))
-	fdnum += 1
-	extraFiles = append(extraFiles, tap.File)
+		"-device", nic)
+	taps := []*os.File{tap.File}
+
+	if m.staticIf != nil {
+		staticTap, err := m.qc.NewTap(m.qc.Dnsmasq.Static.BridgeName)
+		if err != nil {
+			m.qc.mu.Unlock()
+			return nil, err
+		}
+		defer staticTap.Close()
+		staticNic, err := nicDevice(m.board, m.nicModel, "netdev=static,mac="+m.staticIf.HardwareAddr.String())
+		if err != nil {
+			m.qc.mu.Unlock()
+			return nil, err
+		}
+		qmCmd = append(qmCmd, "-netdev", fmt.Sprintf("tap,id=static,fd=%d", fdnum+1),
+			"-device", staticNic)
+		taps = append(taps, staticTap.File)
+	}
 
-	plog.Debugf("NewMachine: (%s) %q", combo, qmCmd)
+	plog.Debugf("NewMachine %s: (%s) %q", platform.MachineName(m), m.board, qmCmd)
 
-	qm.qemu = qm.qc.NewCommand(qmCmd[0], qmCmd[1:]...)
+	qemu := m.qc.NewCgroupCommand(qmCmd[0], qmCmd[1:]...)
 
-	qc.mu.Unlock()
+	m.qc.mu.Unlock()
 
-	cmd := qm.qemu.(*ns.Cmd)
+	cmd := qemu.(*ns.Cmd)
 	cmd.Stderr = os.Stderr
 
-	cmd.ExtraFiles = append(cmd.ExtraFiles, extraFiles...)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, m.files...)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, taps...)
 
-	if err = qm.qemu.Start(); err != nil {
+	if err = qemu.Start(); err != nil {
 		return nil, err
 	}
 
-	if err := platform.StartMachine(qm, qm.journal, qc.RuntimeConf()); err != nil {
-		qm.Destroy()
-		return nil, err
+	return qemu, nil
+}
+
+// leaseIP returns the DHCPv4 address dnsmasq reserved for netif when the
+// interface was allocated. The guest is served it once it boots, so there
+// is nothing to wait for.
+func leaseIP(netif *local.Interface) (string, error) {
+	if len(netif.DHCPv4) == 0 || netif.DHCPv4[0].IP == nil {
+		return "", fmt.Errorf("no DHCPv4 address reserved for %s", netif.HardwareAddr)
 	}
+	return netif.DHCPv4[0].IP.String(), nil
+}
 
-	qc.AddMach(qm)
+// StaticNetwork returns the host's address on the network used by
+// MachineOptions.StaticNetwork, with the network's mask. Guests can use it
+// to check connectivity.
+func (qc *Cluster) StaticNetwork() net.IPNet {
+	return qc.Dnsmasq.Static.BridgeIf.DHCPv4[0]
+}
 
-	return qm, nil
+// StaticInterface returns m's interface on the network without DHCP. Its
+// DHCPv4 and DHCPv6 addresses are reserved for m, but not served; the
+// guest must configure them.
+func (qc *Cluster) StaticInterface(m platform.Machine) (*local.Interface, error) {
+	qm, ok := m.(*machine)
+	if !ok || qm.staticIf == nil {
+		return nil, fmt.Errorf("machine %s has no static network interface", m.ID())
+	}
+	return qm.staticIf, nil
+}
+
+// checkNICModel returns an error if model isn't a supported NICModel.
+func checkNICModel(model string) error {
+	switch model {
+	case "", "virtio-net", "e1000", "rtl8139":
+		return nil
+	default:
+		return fmt.Errorf("unsupported NIC model %q", model)
+	}
+}
+
+// checkWatchdogAction returns an error if action isn't a watchdog action
+// QEMU supports.
+func checkWatchdogAction(action string) error {
+	switch action {
+	case "", "reset", "poweroff", "shutdown", "pause", "debug", "none", "inject-nmi":
+		return nil
+	default:
+		return fmt.Errorf("unsupported watchdog action %q", action)
+	}
+}
+
+// omittableDevices are the devices kola attaches which OmitDevices can
+// name.
+var omittableDevices = []string{"rng", "balloon", "watchdog"}
+
+// checkOmitDevices returns an error if devices names a device kola
+// can't omit.
+func checkOmitDevices(devices []string) error {
+	for _, device := range devices {
+		if !containsString(omittableDevices, device) {
+			return fmt.Errorf("can't omit device %q; expected one of %s", device, strings.Join(omittableDevices, ", "))
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// checkDiskIO returns an error if cache or aio isn't a mode QEMU
+// supports, or if they can't be combined.
+func checkDiskIO(cache, aio string) error {
+	switch cache {
+	case "", "none", "writeback", "writethrough":
+	default:
+		return fmt.Errorf("unsupported disk cache mode %q", cache)
+	}
+	switch aio {
+	case "", "threads", "io_uring":
+	case "native":
+		if cache != "none" {
+			return fmt.Errorf("disk aio=native requires cache=none")
+		}
+	default:
+		return fmt.Errorf("unsupported disk aio mode %q", aio)
+	}
+	return nil
+}
+
+// diskIO returns the cache and aio modes of a disk, falling back to the
+// cluster's defaults for those it doesn't set.
+func diskIO(opts *Options, cache, aio string) (string, string) {
+	if cache == "" {
+		cache = opts.DiskCache
+	}
+	if aio == "" {
+		aio = opts.DiskAIO
+	}
+	return cache, aio
+}
+
+// nicDevice returns the -device argument for a network interface of the
+// given model, defaulting to virtio.
+func nicDevice(board, model, args string) (string, error) {
+	if model == "" || model == "virtio-net" {
+		return virtio(board, "net", args)
+	}
+	return model + "," + args, nil
+}
+
+// kvmAvailable reports whether QEMU can use KVM acceleration on this host.
+func kvmAvailable() bool {
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// memoryMB returns the guest memory size given by the -m option in args.
+func memoryMB(args []string) int {
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == "-m" {
+			mb, _ := strconv.Atoi(args[i+1])
+			return mb
+		}
+	}
+	return 0
+}
+
+// checkHugepages verifies that path is a hugetlbfs mount and that the host
+// has at least memMB of free huge pages.
+func checkHugepages(path string, memMB int) error {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fmt.Errorf("hugepages requested but unavailable: %v", err)
+	}
+	if uint32(st.Type) != hugetlbfsMagic {
+		return fmt.Errorf("hugepages requested but %s is not a hugetlbfs mount", path)
+	}
+
+	meminfo, err := ioutil.ReadFile("/proc/meminfo")
+	if err != nil {
+		return err
+	}
+	var free, sizeKB int
+	for _, line := range strings.Split(string(meminfo), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "HugePages_Free:":
+			free, _ = strconv.Atoi(fields[1])
+		case "Hugepagesize:":
+			sizeKB, _ = strconv.Atoi(fields[1])
+		}
+	}
+	if freeMB := free * sizeKB / 1024; freeMB < memMB {
+		return fmt.Errorf("hugepages requested but only %d MiB are free and the guest needs %d MiB; reserve more in /proc/sys/vm/nr_hugepages", freeMB, memMB)
+	}
+	return nil
 }
 
 // The virtio device name differs between machine types but otherwise
 // configuration is the same. Use this to help construct device args.
-func (qc *Cluster) virtio(device, args string) string {
+func virtio(board, device, args string) (string, error) {
 	var suffix string
-	switch qc.opts.Board {
+	switch board {
 	case "amd64-usr":
 		suffix = "pci"
 	case "arm64-usr":
 		suffix = "device"
 	default:
-		panic(qc.opts.Board)
+		return "", fmt.Errorf("no virtio %s device for board %q", device, board)
 	}
-	return fmt.Sprintf("virtio-%s-%s,%s", device, suffix, args)
+	return fmt.Sprintf("virtio-%s-%s,%s", device, suffix, args), nil
 }
 
-// Create a nameless temporary qcow2 image file backed by a raw image.
-func setupPrimaryDisk(imageFile string) (*os.File, error) {
-	// a relative path would be interpreted relative to /tmp
-	backingFile, err := filepath.Abs(imageFile)
-	if err != nil {
-		return nil, err
-	}
-	// keep the COW image from breaking if the "latest" symlink changes
-	backingFile, err = filepath.EvalSymlinks(backingFile)
-	if err != nil {
-		return nil, err
+// Create a nameless temporary qcow2 image file backed by a raw image. A
+// verified image is referred to through its open file, so that QEMU boots
+// exactly what was verified even if imageFile is replaced.
+func setupPrimaryDisk(imageFile string, verified *os.File) (*os.File, error) {
+	var backingFile string
+	if verified != nil {
+		backingFile = fmt.Sprintf("/proc/%d/fd/%d", os.Getpid(), verified.Fd())
+	} else {
+		// a relative path would be interpreted relative to /tmp
+		var err error
+		backingFile, err = filepath.Abs(imageFile)
+		if err != nil {
+			return nil, err
+		}
+		// keep the COW image from breaking if the "latest" symlink changes
+		backingFile, err = filepath.EvalSymlinks(backingFile)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	qcowOpts := fmt.Sprintf("backing_file=%s,backing_fmt=raw,lazy_refcounts=on", backingFile)
@@ -319,3 +1114,7 @@ func setupDisk(additionalOptions ...string) (*os.File, error) {
 
 	return os.OpenFile(dstFileName, os.O_RDWR, 0)
 }
+
+func (qc *Cluster) Supports(c platform.Capability) bool {
+	return capabilities.Has(c)
+}
@@ -15,7 +15,9 @@
 package qemu
 
 import (
-	"io/ioutil"
+	"io"
+	"os"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 
@@ -27,17 +29,38 @@ import (
 type machine struct {
 	qc          *Cluster
 	id          string
+	name        string // optional human-friendly name
+	board       string
 	qemu        exec.Cmd
+	args        []string   // qemu command line, less console, QMP, and network
+	files       []*os.File // disk images passed to qemu
 	netif       *local.Interface
+	staticIf    *local.Interface // on the bridge without DHCP, if requested
+	nicModel    string
+	balloon     bool // has a memory balloon device
 	journal     *platform.Journal
+	dir         string
 	consolePath string
 	console     string
+	consoleSock string // unix socket serving the live console, if enabled
+	vncSock     string // unix socket serving the display over VNC, if enabled
+	qmpPath     string
+	migrations  int
+
+	// servedConfig is the name under which ConfigSrv serves the
+	// machine's Ignition config, if MachineOptions.ServeIgnition is set.
+	servedConfig string
 }
 
 func (m *machine) ID() string {
 	return m.id
 }
 
+// MachineName returns the name m was created with, if any.
+func (m *machine) MachineName() string {
+	return m.name
+}
+
 func (m *machine) IP() string {
 	return m.netif.DHCPv4[0].IP.String()
 }
@@ -46,35 +69,64 @@ func (m *machine) PrivateIP() string {
 	return m.netif.DHCPv4[0].IP.String()
 }
 
+func (m *machine) DNSName() string {
+	return ""
+}
+
 func (m *machine) SSHClient() (*ssh.Client, error) {
-	return m.qc.SSHClient(m.IP())
+	return m.qc.SSHClient(m.qc.SSHHost(m))
 }
 
 func (m *machine) PasswordSSHClient(user string, password string) (*ssh.Client, error) {
-	return m.qc.PasswordSSHClient(m.IP(), user, password)
+	return m.qc.PasswordSSHClient(m.qc.SSHHost(m), user, password)
 }
 
 func (m *machine) SSH(cmd string) ([]byte, []byte, error) {
 	return m.qc.SSH(m, cmd)
 }
 
+func (m *machine) SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error) {
+	return m.qc.SSHWithInput(m, cmd, stdin)
+}
+
+func (m *machine) DiskUsage(path string) (*platform.DiskUsage, error) {
+	return m.qc.DiskUsage(m, path)
+}
+
+func (m *machine) MemInfo() (*platform.MemInfo, error) {
+	return m.qc.MemInfo(m)
+}
+
+func (m *machine) OSRelease() (map[string]string, error) {
+	return m.qc.OSRelease(m)
+}
+
+func (m *machine) WaitForUnit(unit, state string, timeout time.Duration) error {
+	return m.qc.WaitForUnit(m, unit, state, timeout)
+}
+
 func (m *machine) Reboot() error {
 	return platform.RebootMachine(m, m.journal, m.qc.RuntimeConf())
 }
 
 func (m *machine) Destroy() error {
 	err := m.qemu.Kill()
+	m.closeFiles()
 	if err2 := m.journal.Destroy(); err == nil && err2 != nil {
 		err = err2
 	}
 
-	buf, err2 := ioutil.ReadFile(m.consolePath)
+	console, err2 := platform.ReadConsole(m.consolePath, m.qc.RuntimeConf().MaxConsoleSize)
 	if err2 == nil {
-		m.console = string(buf)
+		m.console = console
 	} else if err == nil {
 		err = err2
 	}
 
+	if m.servedConfig != "" {
+		m.qc.ConfigSrv.Remove(m.servedConfig)
+	}
+
 	m.qc.DelMach(m)
 
 	return err
@@ -83,3 +135,27 @@ func (m *machine) Destroy() error {
 func (m *machine) ConsoleOutput() string {
 	return m.console
 }
+
+// ConsoleSnapshot returns m's console output so far, while it is running.
+func (m *machine) ConsoleSnapshot() (string, error) {
+	return platform.ReadConsole(m.consolePath, m.qc.RuntimeConf().MaxConsoleSize)
+}
+
+// ConsoleSocket returns the path of the unix socket serving m's live
+// serial console, or "" if Options.ConsoleSocket is unset.
+func (m *machine) ConsoleSocket() string {
+	return m.consoleSock
+}
+
+// VNCSocket returns the path of the unix socket serving m's display over
+// VNC, or "" if Options.VNC is unset.
+func (m *machine) VNCSocket() string {
+	return m.vncSock
+}
+
+func (m *machine) closeFiles() {
+	for _, f := range m.files {
+		f.Close()
+	}
+	m.files = nil
+}
@@ -0,0 +1,124 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemu
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/mantle/platform"
+	"github.com/coreos/mantle/util"
+)
+
+const (
+	migrateListenRetries = 50
+	migrateListenDelay   = 100 * time.Millisecond
+	migratePollDelay     = time.Second
+	migrateTimeout       = 5 * time.Minute
+)
+
+// MigrateMachine live migrates m to a new QEMU process on the same host
+// and stops the original one. The new process shares m's disks and gets a
+// new tap device with the same MAC address, so the guest keeps its
+// address and should not notice the move.
+func (qc *Cluster) MigrateMachine(m platform.Machine) error {
+	qm, ok := m.(*machine)
+	if !ok {
+		return fmt.Errorf("machine %s is not a QEMU machine", m.ID())
+	}
+
+	qm.migrations++
+	sock := filepath.Join(qm.dir, fmt.Sprintf("migrate-%d.sock", qm.migrations))
+	qmpPath := filepath.Join(qm.dir, fmt.Sprintf("qmp-%d.sock", qm.migrations))
+	var consoleSock string
+	if qm.consoleSock != "" {
+		consoleSock = filepath.Join(qm.dir, fmt.Sprintf("console-%d.sock", qm.migrations))
+	}
+
+	var vncSock string
+	if qm.vncSock != "" {
+		vncSock = filepath.Join(qm.dir, fmt.Sprintf("vnc-%d.sock", qm.migrations))
+	}
+
+	dest, err := qm.launch(qmpPath, consoleSock, vncSock, "unix:"+sock)
+	if err != nil {
+		return fmt.Errorf("starting migration destination: %v", err)
+	}
+
+	if err := util.Retry(migrateListenRetries, migrateListenDelay, func() error {
+		_, err := os.Stat(sock)
+		return err
+	}); err != nil {
+		dest.Kill()
+		return fmt.Errorf("waiting for migration destination: %v", err)
+	}
+
+	if _, err := qm.qmp("migrate", map[string]string{"uri": "unix:" + sock}); err != nil {
+		dest.Kill()
+		return err
+	}
+
+	if err := qm.waitForMigration(); err != nil {
+		dest.Kill()
+		return err
+	}
+
+	// the source is paused once migration completes
+	if err := qm.qemu.Kill(); err != nil {
+		plog.Warningf("killing migration source for %s: %v", qm.ID(), err)
+	}
+	qm.qemu = dest
+	qm.qmpPath = qmpPath
+	qm.consoleSock = consoleSock
+	qm.vncSock = vncSock
+
+	return nil
+}
+
+// waitForMigration polls the source QEMU until an outgoing migration
+// completes, fails, or times out.
+func (m *machine) waitForMigration() error {
+	deadline := time.Now().Add(migrateTimeout)
+
+	for {
+		ret, err := m.qmp("query-migrate", nil)
+		if err != nil {
+			return err
+		}
+
+		var status struct {
+			Status    string `json:"status"`
+			ErrorDesc string `json:"error-desc"`
+		}
+		if err := json.Unmarshal(ret, &status); err != nil {
+			return fmt.Errorf("parsing query-migrate result: %v", err)
+		}
+
+		switch status.Status {
+		case "completed":
+			return nil
+		case "failed", "cancelled":
+			return fmt.Errorf("migration %s: %s", status.Status, status.ErrorDesc)
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for migration, status %q", status.Status)
+		}
+		time.Sleep(migratePollDelay)
+	}
+}
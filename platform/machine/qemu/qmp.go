@@ -0,0 +1,106 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package qemu
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+)
+
+// qmpClient is a minimal client for the QEMU Machine Protocol.
+type qmpClient struct {
+	conn net.Conn
+	dec  *json.Decoder
+	enc  *json.Encoder
+}
+
+type qmpCommand struct {
+	Execute   string      `json:"execute"`
+	Arguments interface{} `json:"arguments,omitempty"`
+}
+
+type qmpResponse struct {
+	Return json.RawMessage `json:"return"`
+	Error  *struct {
+		Class string `json:"class"`
+		Desc  string `json:"desc"`
+	} `json:"error"`
+	Event string `json:"event"`
+}
+
+// dialQMP connects to the QMP socket at path and negotiates capabilities.
+func dialQMP(path string) (*qmpClient, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &qmpClient{
+		conn: conn,
+		dec:  json.NewDecoder(conn),
+		enc:  json.NewEncoder(conn),
+	}
+
+	var greeting map[string]interface{}
+	if err := c.dec.Decode(&greeting); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("reading QMP greeting: %v", err)
+	}
+
+	if _, err := c.Execute("qmp_capabilities", nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Execute runs cmd with the given arguments, which may be nil, and returns
+// the raw result. Asynchronous events received meanwhile are discarded.
+func (c *qmpClient) Execute(cmd string, args interface{}) (json.RawMessage, error) {
+	if err := c.enc.Encode(qmpCommand{Execute: cmd, Arguments: args}); err != nil {
+		return nil, fmt.Errorf("sending QMP command %s: %v", cmd, err)
+	}
+
+	for {
+		var resp qmpResponse
+		if err := c.dec.Decode(&resp); err != nil {
+			return nil, fmt.Errorf("reading QMP response to %s: %v", cmd, err)
+		}
+		if resp.Event != "" {
+			continue
+		}
+		if resp.Error != nil {
+			return nil, fmt.Errorf("QMP command %s failed: %s: %s", cmd, resp.Error.Class, resp.Error.Desc)
+		}
+		return resp.Return, nil
+	}
+}
+
+func (c *qmpClient) Close() error {
+	return c.conn.Close()
+}
+
+// qmp runs a single QMP command against m's QEMU process.
+func (m *machine) qmp(cmd string, args interface{}) (json.RawMessage, error) {
+	c, err := dialQMP(m.qmpPath)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+
+	return c.Execute(cmd, args)
+}
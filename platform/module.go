@@ -0,0 +1,69 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// LoadModule loads the kernel module on m with modprobe.
+func LoadModule(m Machine, module string) error {
+	out, stderr, err := m.SSH("sudo modprobe " + ShellQuote(module))
+	if err != nil {
+		return fmt.Errorf("modprobe %s: %s: %v: %s", module, out, err, stderr)
+	}
+	return nil
+}
+
+// ModuleLoaded reports whether the kernel module is loaded on m, or built
+// into its kernel. Dashes and underscores in module names are treated
+// alike, as modprobe does.
+func ModuleLoaded(m Machine, module string) (bool, error) {
+	out, stderr, err := m.SSH("cat /proc/modules")
+	if err != nil {
+		return false, fmt.Errorf("reading /proc/modules: %v: %s", err, stderr)
+	}
+	if moduleListed(out, module) {
+		return true, nil
+	}
+
+	// built-in modules aren't in /proc/modules, but do appear in sysfs
+	dir := "/sys/module/" + strings.Replace(module, "-", "_", -1)
+	_, stderr, err = m.SSH("test -d " + ShellQuote(dir))
+	if err == nil {
+		return true, nil
+	} else if status, ok := ExitStatus(err); ok && status == 1 {
+		return false, nil
+	}
+	return false, fmt.Errorf("checking %s: %v: %s", dir, err, stderr)
+}
+
+// moduleListed reports whether module appears in the /proc/modules
+// contents modules.
+func moduleListed(modules []byte, module string) bool {
+	module = strings.Replace(module, "-", "_", -1)
+
+	scanner := bufio.NewScanner(bytes.NewReader(modules))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == module {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"testing"
+)
+
+func TestModuleListed(t *testing.T) {
+	modules := []byte(`overlay 57344 0 - Live 0xffffffffc0345000
+nf_conntrack 106496 2 xt_conntrack,nf_nat, Live 0xffffffffc02f6000
+btrfs 1056768 0 - Live 0xffffffffc01f0000`)
+
+	for _, tt := range []struct {
+		module string
+		listed bool
+	}{
+		{"overlay", true},
+		{"nf_conntrack", true},
+		{"nf-conntrack", true},
+		{"nf_conntrack_ipv4", false},
+		{"xt_conntrack", false},
+		{"ext4", false},
+	} {
+		if listed := moduleListed(modules, tt.module); listed != tt.listed {
+			t.Errorf("moduleListed(%q): got %v, expected %v", tt.module, listed, tt.listed)
+		}
+	}
+}
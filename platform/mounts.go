@@ -0,0 +1,103 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mount is an entry of /proc/mounts.
+type Mount struct {
+	Source  string
+	Target  string
+	FSType  string
+	Options []string
+}
+
+// HasOption reports whether the mount has the given option, e.g. "ro" or
+// "discard".
+func (mnt Mount) HasOption(opt string) bool {
+	for _, o := range mnt.Options {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+// Mounts returns the filesystems mounted on m, in mount order.
+func Mounts(m Machine) ([]Mount, error) {
+	out, stderr, err := m.SSH("cat /proc/mounts")
+	if err != nil {
+		return nil, fmt.Errorf("reading /proc/mounts: %v: %s", err, stderr)
+	}
+	return parseMounts(out)
+}
+
+// FindMount returns the mount at target, which is the last one listed if
+// several filesystems are stacked there.
+func FindMount(mounts []Mount, target string) (Mount, bool) {
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].Target == target {
+			return mounts[i], true
+		}
+	}
+	return Mount{}, false
+}
+
+func parseMounts(out []byte) ([]Mount, error) {
+	var mounts []Mount
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("malformed /proc/mounts line %q", scanner.Text())
+		}
+		mounts = append(mounts, Mount{
+			Source:  unescapeMountField(fields[0]),
+			Target:  unescapeMountField(fields[1]),
+			FSType:  fields[2],
+			Options: strings.Split(fields[3], ","),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// unescapeMountField decodes the octal escapes the kernel uses for
+// whitespace and backslashes in /proc/mounts, such as "\040" for a space.
+func unescapeMountField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMounts(t *testing.T) {
+	out := []byte(`sysfs /sys sysfs rw,seclabel,nosuid,nodev,noexec,relatime 0 0
+/dev/mapper/usr /usr ext4 ro,seclabel,relatime 0 0
+/dev/loop0 /var/lib/docker btrfs rw,seclabel,relatime,discard,space_cache,subvolid=5,subvol=/ 0 0
+/dev/sdb1 /mnt/with\040space xfs rw 0 0
+tmpfs /usr tmpfs rw 0 0
+`)
+	mounts, err := parseMounts(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 5 {
+		t.Fatalf("got %d mounts, want 5", len(mounts))
+	}
+
+	want := Mount{
+		Source:  "/dev/loop0",
+		Target:  "/var/lib/docker",
+		FSType:  "btrfs",
+		Options: []string{"rw", "seclabel", "relatime", "discard", "space_cache", "subvolid=5", "subvol=/"},
+	}
+	if !reflect.DeepEqual(mounts[2], want) {
+		t.Errorf("got %+v, want %+v", mounts[2], want)
+	}
+	if !mounts[2].HasOption("discard") || mounts[2].HasOption("loop") {
+		t.Errorf("HasOption mismatch for %v", mounts[2].Options)
+	}
+
+	if mnt, ok := FindMount(mounts, "/mnt/with space"); !ok || mnt.FSType != "xfs" {
+		t.Errorf("escaped mount point not found: %+v", mnt)
+	}
+	if mnt, ok := FindMount(mounts, "/usr"); !ok || mnt.FSType != "tmpfs" {
+		t.Errorf("FindMount did not return the topmost mount: %+v", mnt)
+	}
+	if _, ok := FindMount(mounts, "/boot"); ok {
+		t.Errorf("found nonexistent mount")
+	}
+
+	if _, err := parseMounts([]byte("garbage\n")); err == nil {
+		t.Errorf("malformed line was accepted")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// OSRelease fetches /etc/os-release from m and returns its fields, such as
+// ID and VERSION_ID.
+func (bc *BaseCluster) OSRelease(m Machine) (map[string]string, error) {
+	out, stderr, err := m.SSH("cat /etc/os-release")
+	if err != nil {
+		return nil, fmt.Errorf("reading /etc/os-release: %v: %s", err, stderr)
+	}
+	return ParseOSRelease(out)
+}
+
+// ParseOSRelease parses the contents of an os-release file, as described
+// in os-release(5), into its fields. Quoted values are unquoted.
+func ParseOSRelease(data []byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("malformed os-release line %q", line)
+		}
+		value, err := unquoteOSRelease(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("malformed os-release line %q: %v", line, err)
+		}
+		fields[parts[0]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// unquoteOSRelease removes shell-style quoting from an os-release value.
+func unquoteOSRelease(s string) (string, error) {
+	if len(s) < 2 || (s[0] != '"' && s[0] != '\'') {
+		return s, nil
+	}
+	quote := s[0]
+	if s[len(s)-1] != quote {
+		return "", fmt.Errorf("unterminated quote")
+	}
+	s = s[1 : len(s)-1]
+	if quote == '\'' {
+		return s, nil
+	}
+
+	// within double quotes, a backslash escapes the next character
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String(), nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOSRelease(t *testing.T) {
+	data := []byte(`NAME="Container Linux by CoreOS"
+ID=coreos
+VERSION_ID=1465.0.0
+# comment
+
+PRETTY_NAME="Container Linux by CoreOS 1465.0.0 (Ladybug) \"quoted\""
+HOME_URL='https://coreos.com/'
+`)
+	want := map[string]string{
+		"NAME":        "Container Linux by CoreOS",
+		"ID":          "coreos",
+		"VERSION_ID":  "1465.0.0",
+		"PRETTY_NAME": `Container Linux by CoreOS 1465.0.0 (Ladybug) "quoted"`,
+		"HOME_URL":    "https://coreos.com/",
+	}
+
+	got, err := ParseOSRelease(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"NOEQUALS", "=value", `NAME="unterminated`} {
+		if _, err := ParseOSRelease([]byte(bad)); err == nil {
+			t.Errorf("parsing %q succeeded", bad)
+		}
+	}
+}
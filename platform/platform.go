@@ -18,19 +18,26 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/coreos/go-semver/semver"
+	"github.com/coreos/pkg/capnslog"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/coreos/mantle/platform/conf"
 	"github.com/coreos/mantle/util"
 )
 
+var plog = capnslog.NewPackageLogger("github.com/coreos/mantle", "platform")
+
 const (
 	sshRetries = 30
 	sshTimeout = 10 * time.Second
+
+	sshPollInterval = time.Second
 )
 
 // Machine represents a Container Linux instance.
@@ -44,6 +51,10 @@ type Machine interface {
 	// PrivateIP returns the machine's private IP.
 	PrivateIP() string
 
+	// DNSName returns the machine's public DNS name, or an empty string
+	// if the platform does not assign one.
+	DNSName() string
+
 	// SSHClient establishes a new SSH connection to the machine.
 	SSHClient() (*ssh.Client, error)
 
@@ -53,6 +64,25 @@ type Machine interface {
 	// SSH runs a single command over a new SSH connection.
 	SSH(cmd string) ([]byte, []byte, error)
 
+	// SSHWithInput runs a single command over a new SSH connection like
+	// SSH, with stdin connected to the command's standard input.
+	SSHWithInput(cmd string, stdin io.Reader) ([]byte, []byte, error)
+
+	// WaitForUnit waits until systemd reports that unit has reached the
+	// ActiveState state, such as "active", or timeout elapses.
+	WaitForUnit(unit, state string, timeout time.Duration) error
+
+	// OSRelease returns the fields of the machine's /etc/os-release,
+	// such as ID and VERSION_ID.
+	OSRelease() (map[string]string, error)
+
+	// MemInfo returns the machine's memory usage from /proc/meminfo.
+	MemInfo() (*MemInfo, error)
+
+	// DiskUsage returns the space usage of the filesystem containing
+	// path on the machine.
+	DiskUsage(path string) (*DiskUsage, error)
+
 	// Reboot restarts the machine and waits for it to come back.
 	Reboot() error
 
@@ -64,6 +94,46 @@ type Machine interface {
 	ConsoleOutput() string
 }
 
+// ConsoleURLer is implemented by machines whose platform offers a web
+// console for interactive debugging.
+type ConsoleURLer interface {
+	// ConsoleURL returns the URL of the machine's web console.
+	ConsoleURL() string
+}
+
+// HostOOMReporter is implemented by clusters whose processes run on the
+// host under a memory limit.
+type HostOOMReporter interface {
+	// HostOOMKills returns how many of the cluster's host processes
+	// the kernel has killed for exceeding the limit.
+	HostOOMKills() (uint64, error)
+}
+
+// MachineNamer is implemented by machines that can be given a
+// human-friendly name, such as "etcd-0", in addition to their unique ID.
+type MachineNamer interface {
+	// MachineName returns the machine's name, or "" if it has none.
+	MachineName() string
+}
+
+// MachineName returns a description of m for output, combining its name
+// and ID if it has a name, or just its ID otherwise.
+func MachineName(m Machine) string {
+	if n, ok := m.(MachineNamer); ok && n.MachineName() != "" {
+		return fmt.Sprintf("%s (%s)", n.MachineName(), m.ID())
+	}
+	return m.ID()
+}
+
+// ConsoleURL returns the URL of m's web console, or an empty string if
+// its platform does not offer one.
+func ConsoleURL(m Machine) string {
+	if c, ok := m.(ConsoleURLer); ok {
+		return c.ConsoleURL()
+	}
+	return ""
+}
+
 // Cluster represents a cluster of Container Linux machines within a single platform.
 type Cluster interface {
 	// NewMachine creates a new Container Linux machine.
@@ -82,20 +152,141 @@ type Cluster interface {
 	// ConsoleOutput returns a map of console output from destroyed
 	// cluster machines.
 	ConsoleOutput() map[string]string
+
+	// Supports reports whether the platform provides the capability c.
+	Supports(c Capability) bool
+
+	// KernelVersion returns the version of the kernel running on m.
+	KernelVersion(m Machine) (*semver.Version, error)
+
+	// KernelCmdline returns the arguments of the kernel command line
+	// of m.
+	KernelCmdline(m Machine) ([]string, error)
+
+	// MachineConfig returns the rendered config m was launched with,
+	// including injected SSH keys and substituted variables.
+	MachineConfig(m Machine) *conf.Conf
+
+	// SSHPipeOutput runs cmd on m, writing its stdout and stderr to the
+	// given writers as the command produces them.
+	SSHPipeOutput(m Machine, cmd string, stdout, stderr io.Writer) error
+
+	// Dial connects to address from the host side of the cluster's
+	// network, where the machines' IPs are reachable.
+	Dial(network, address string) (net.Conn, error)
+}
+
+// Capability is an optional feature which not every platform provides.
+type Capability string
+
+const (
+	// CapConsole means machines' console output is captured and
+	// returned by ConsoleOutput.
+	CapConsole Capability = "console"
+
+	// CapMetadata means guests can query a provider metadata service.
+	CapMetadata Capability = "metadata"
+
+	// CapMetadataSSHKey means SSH keys can be delivered through the
+	// provider's metadata, so NoSSHKeyInUserData may be used.
+	CapMetadataSSHKey Capability = "metadata-ssh-key"
+)
+
+// Capabilities is the set of capabilities a platform provides.
+type Capabilities []Capability
+
+// Has reports whether c is in the set.
+func (cs Capabilities) Has(c Capability) bool {
+	for _, cap := range cs {
+		if cap == c {
+			return true
+		}
+	}
+	return false
 }
 
 // Options contains the base options for all clusters.
 type Options struct {
 	BaseName string
+
+	// LaunchTimeout bounds how long cloud platforms retry creating an
+	// instance when the provider is throttling or out of capacity.
+	LaunchTimeout time.Duration
 }
 
 // RuntimeConfig contains cluster-specific configuration.
 type RuntimeConfig struct {
 	OutputDir string
 
+	// NoSSHKeyInUserData and NoSSHKeyInMetadata may not both be set;
+	// the harness needs at least one way to deliver its SSH key.
 	NoSSHKeyInUserData bool // don't inject SSH key into Ignition/cloud-config
 	NoSSHKeyInMetadata bool // don't add SSH key to platform metadata
 	NoEnableSelinux    bool // don't enable selinux when starting or rebooting a machine
+
+	MaxConsoleSize int // bytes of console output to keep per machine, 0 for unlimited
+
+	// Parallel is how many tests the harness runs at once. At 1, tests
+	// run serially, each one's machines destroyed before the next test
+	// starts, for hosts with room for only one test's machines.
+	Parallel int
+
+	// ConsolePollInterval is the least time between requests for a
+	// machine's console output on cloud platforms which rate limit
+	// them, such as EC2's GetConsoleOutput. Throttled requests back off
+	// further. Zero selects a default within the providers' limits.
+	ConsolePollInterval time.Duration
+
+	// SSHByDNSName connects to machines by DNS name rather than IP on
+	// platforms which assign one, so connections survive IP changes.
+	SSHByDNSName bool
+
+	// SSHShell, if set, is the remote shell which runs commands from
+	// Cluster.SSH, e.g. "bash" for tests relying on bashisms. By default
+	// commands run under the user's login shell.
+	SSHShell string
+
+	// MaxSSHSessions bounds how many commands Cluster.SSH runs on one
+	// machine at once; more wait their turn, to stay within sshd's
+	// connection limits. Zero selects a default; negative is unlimited.
+	MaxSSHSessions int
+
+	// SSHRetries is how many times Cluster.SSH reruns a command whose
+	// connection dropped before it reported an exit status, such as with
+	// EOF or a reset connection. Commands which exit, successfully or
+	// not, are never retried, nor are commands killed while the
+	// connection stays up, but a retried command may have partly run
+	// already, so this is only safe for tests whose commands are
+	// idempotent.
+	SSHRetries int
+
+	// BootRetries is how many times cloud platforms replace a machine
+	// which fails to come up, such as one which never gets an IP or
+	// whose Ignition run fails, before giving up on creating it.
+	BootRetries int
+
+	// DestroyWorkers bounds how many machines Cluster.Destroy tears down
+	// at once, and DestroyTimeout bounds the whole teardown; machines
+	// still being destroyed then are abandoned and reported in Destroy's
+	// error. Zero selects a default for either.
+	DestroyWorkers int
+	DestroyTimeout time.Duration
+
+	// InstanceMetadata is attached to every machine at launch as
+	// metadata items on GCE, where the guest can read them from the
+	// metadata server. Other platforms ignore it.
+	InstanceMetadata map[string]string
+
+	// TrustedCAs are PEM-encoded CA certificates to add to each
+	// machine's trust store through its Ignition or cloud-config.
+	// Machines with Ignition v1 configs or scripts are left without
+	// them, with a warning.
+	TrustedCAs []string
+
+	// NoCompressUserData keeps user-data uncompressed even when it
+	// exceeds the platform's size limit, failing machine creation
+	// instead, for images which can't read compressed user-data.
+	NoCompressUserData bool
 }
 
 // Wrap a StdoutPipe as a io.ReadCloser
@@ -0,0 +1,77 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/coreos/mantle/network"
+)
+
+// udpProbeTimeout is how long CheckPortOpen waits for a UDP port to be
+// reported unreachable.
+const udpProbeTimeout = 2 * time.Second
+
+// CheckPortOpen connects to port on m through d, usually the machine's
+// Cluster so the port is reached from the host side of its network,
+// returning an error unless the port accepts connections. proto is "tcp"
+// or "udp". A UDP port counts as open unless the machine rejects a probe
+// datagram with an ICMP port unreachable message, so a firewall silently
+// dropping packets isn't detected.
+func CheckPortOpen(d network.Dialer, m Machine, port int, proto string) error {
+	addr := net.JoinHostPort(m.IP(), strconv.Itoa(port))
+
+	switch proto {
+	case "tcp":
+		conn, err := d.Dial("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("tcp port %d on %s is not open: %v", port, m.ID(), err)
+		}
+		conn.Close()
+		return nil
+	case "udp":
+		conn, err := d.Dial("udp", addr)
+		if err != nil {
+			return fmt.Errorf("connecting to udp port %d on %s: %v", port, m.ID(), err)
+		}
+		defer conn.Close()
+
+		if _, err := conn.Write([]byte{0}); err != nil {
+			return fmt.Errorf("probing udp port %d on %s: %v", port, m.ID(), err)
+		}
+		conn.SetReadDeadline(time.Now().Add(udpProbeTimeout))
+		_, err = conn.Read(make([]byte, 1))
+		if isConnRefused(err) {
+			return fmt.Errorf("udp port %d on %s is not open: %v", port, m.ID(), err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported protocol %q", proto)
+	}
+}
+
+func isConnRefused(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		if sysErr, ok := opErr.Err.(*os.SyscallError); ok {
+			return sysErr.Err == syscall.ECONNREFUSED
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"net"
+	"testing"
+)
+
+func TestCheckPortOpen(t *testing.T) {
+	bc, err := NewBaseCluster("test", &RuntimeConfig{}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &fakeMachine{id: "m"} // its empty IP dials the local host
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	if err := CheckPortOpen(bc, m, port, "tcp"); err != nil {
+		t.Errorf("listening tcp port reported closed: %v", err)
+	}
+	l.Close()
+	if err := CheckPortOpen(bc, m, port, "tcp"); err == nil {
+		t.Errorf("closed tcp port reported open")
+	}
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port = pc.LocalAddr().(*net.UDPAddr).Port
+	if err := CheckPortOpen(bc, m, port, "udp"); err != nil {
+		t.Errorf("listening udp port reported closed: %v", err)
+	}
+	pc.Close()
+	if err := CheckPortOpen(bc, m, port, "udp"); err == nil {
+		t.Errorf("closed udp port reported open")
+	}
+
+	if err := CheckPortOpen(bc, m, port, "sctp"); err == nil {
+		t.Errorf("unsupported protocol accepted")
+	}
+}
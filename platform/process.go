@@ -0,0 +1,176 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Process is a process running on a machine.
+type Process struct {
+	PID     int
+	UID     int
+	User    string
+	Command string // the full command line
+
+	// Cgroups maps each cgroup hierarchy the process belongs to, by
+	// its controllers as listed in /proc/<pid>/cgroup ("" for the
+	// unified hierarchy), to the process's cgroup path in it.
+	Cgroups map[string]string
+}
+
+// InCgroup reports whether p is in the cgroup path, or a descendant of
+// it, in any hierarchy.
+func (p *Process) InCgroup(path string) bool {
+	path = strings.TrimSuffix(path, "/")
+	for _, cg := range p.Cgroups {
+		if cg == path || strings.HasPrefix(cg, path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// IDMapping is a line of a user namespace's uid_map or gid_map: IDs
+// Inside through Inside+Length-1 in the namespace are Outside through
+// Outside+Length-1 outside of it.
+type IDMapping struct {
+	Inside  int
+	Outside int
+	Length  int
+}
+
+// Processes lists the processes running on m.
+func Processes(m Machine) ([]Process, error) {
+	ps, stderr, err := m.SSH("ps -eo pid=,uid=,user:32=,args=")
+	if err != nil {
+		return nil, fmt.Errorf("listing processes: %v: %s", err, stderr)
+	}
+	// processes may exit while this runs, so errors are ignored
+	cgroups, stderr, err := m.SSH(`for d in /proc/[0-9]*; do printf '%s ' "${d#/proc/}"; tr '\n' ' ' < "$d/cgroup" 2>/dev/null; echo; done`)
+	if err != nil {
+		return nil, fmt.Errorf("reading process cgroups: %v: %s", err, stderr)
+	}
+	return parseProcesses(ps, cgroups)
+}
+
+// FindProcess returns the process pid on m.
+func FindProcess(m Machine, pid int) (*Process, error) {
+	procs, err := Processes(m)
+	if err != nil {
+		return nil, err
+	}
+	for i := range procs {
+		if procs[i].PID == pid {
+			return &procs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no process %d on %s", pid, m.ID())
+}
+
+// UIDMap returns the user ID mappings of the user namespace of process
+// pid on m, from /proc/<pid>/uid_map.
+func UIDMap(m Machine, pid int) ([]IDMapping, error) {
+	out, stderr, err := m.SSH(fmt.Sprintf("cat /proc/%d/uid_map", pid))
+	if err != nil {
+		return nil, fmt.Errorf("reading uid_map of process %d: %v: %s", pid, err, stderr)
+	}
+	return parseIDMap(out)
+}
+
+// parseProcesses parses the output of `ps -eo pid=,uid=,user:32=,args=`
+// and, for each process, a line of its PID followed by the lines of its
+// /proc/<pid>/cgroup.
+func parseProcesses(ps, cgroups []byte) ([]Process, error) {
+	byPID := make(map[int]map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(cgroups))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 1 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing cgroups: bad pid %q", fields[0])
+		}
+		cgs := make(map[string]string)
+		for _, field := range fields[1:] {
+			// hierarchy-ID:controller-list:cgroup-path
+			parts := strings.SplitN(field, ":", 3)
+			if len(parts) != 3 {
+				return nil, fmt.Errorf("parsing cgroups of process %d: bad line %q", pid, field)
+			}
+			cgs[parts[1]] = parts[2]
+		}
+		byPID[pid] = cgs
+	}
+
+	var procs []Process
+	scanner = bufio.NewScanner(bytes.NewReader(ps))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("parsing ps output: bad line %q", scanner.Text())
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("parsing ps output: bad pid %q", fields[0])
+		}
+		uid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("parsing ps output: bad uid %q", fields[1])
+		}
+		procs = append(procs, Process{
+			PID:     pid,
+			UID:     uid,
+			User:    fields[2],
+			Command: strings.Join(fields[3:], " "),
+			Cgroups: byPID[pid],
+		})
+	}
+	return procs, nil
+}
+
+// parseIDMap parses a uid_map or gid_map.
+func parseIDMap(out []byte) ([]IDMapping, error) {
+	var mappings []IDMapping
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("bad ID map line %q", scanner.Text())
+		}
+		var ids [3]int
+		for i, field := range fields {
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				return nil, fmt.Errorf("bad ID map line %q", scanner.Text())
+			}
+			ids[i] = id
+		}
+		mappings = append(mappings, IDMapping{Inside: ids[0], Outside: ids[1], Length: ids[2]})
+	}
+	return mappings, nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProcesses(t *testing.T) {
+	ps := []byte(`    1     0 root     /usr/lib/systemd/systemd --switched-root --system
+ 1234 100000 100000   sleep 10000
+`)
+	cgroups := []byte(`1 12:cpu,cpuacct:/init.scope 1:name=systemd:/init.scope 0::/init.scope 
+1234 12:cpu,cpuacct:/system.slice/docker-abc.scope 1:name=systemd:/system.slice/docker-abc.scope 
+`)
+	procs, err := parseProcesses(ps, cgroups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(procs) != 2 {
+		t.Fatalf("expected 2 processes, got %+v", procs)
+	}
+
+	init := procs[0]
+	if init.PID != 1 || init.UID != 0 || init.User != "root" || init.Command != "/usr/lib/systemd/systemd --switched-root --system" {
+		t.Errorf("unexpected process %+v", init)
+	}
+	if init.Cgroups[""] != "/init.scope" || init.Cgroups["cpu,cpuacct"] != "/init.scope" {
+		t.Errorf("unexpected cgroups %v", init.Cgroups)
+	}
+
+	sleep := procs[1]
+	if sleep.UID != 100000 || sleep.Command != "sleep 10000" {
+		t.Errorf("unexpected process %+v", sleep)
+	}
+	if !sleep.InCgroup("/system.slice") || !sleep.InCgroup("/system.slice/docker-abc.scope/") || sleep.InCgroup("/system") {
+		t.Errorf("InCgroup wrong for %v", sleep.Cgroups)
+	}
+
+	if _, err := parseProcesses([]byte("x 0 root sh\n"), nil); err == nil {
+		t.Errorf("parsed bad pid")
+	}
+}
+
+func TestParseIDMap(t *testing.T) {
+	mappings, err := parseIDMap([]byte("         0     100000      65536\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(mappings, []IDMapping{{Inside: 0, Outside: 100000, Length: 65536}}) {
+		t.Errorf("unexpected mappings %+v", mappings)
+	}
+
+	if _, err := parseIDMap([]byte("0 100000\n")); err == nil {
+		t.Errorf("parsed short line")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MemInfo is the memory usage of a machine from /proc/meminfo, in bytes.
+type MemInfo struct {
+	Total     uint64
+	Free      uint64
+	Available uint64
+	SwapTotal uint64
+	SwapFree  uint64
+
+	// Fields holds every field of /proc/meminfo by name, with values
+	// in kB converted to bytes.
+	Fields map[string]uint64
+}
+
+// DiskUsage is the space usage of the filesystem containing a path, in
+// bytes, as reported by df.
+type DiskUsage struct {
+	Filesystem string
+	Target     string
+	Size       uint64
+	Used       uint64
+	Available  uint64
+}
+
+// MemInfo returns the memory usage of m.
+func (bc *BaseCluster) MemInfo(m Machine) (*MemInfo, error) {
+	out, stderr, err := m.SSH("cat /proc/meminfo")
+	if err != nil {
+		return nil, fmt.Errorf("reading /proc/meminfo: %v: %s", err, stderr)
+	}
+	return parseMemInfo(out)
+}
+
+// DiskUsage returns the space usage of the filesystem containing path on
+// m.
+func (bc *BaseCluster) DiskUsage(m Machine, path string) (*DiskUsage, error) {
+	out, stderr, err := m.SSH("df -P -B1 -- " + ShellQuote(path))
+	if err != nil {
+		return nil, fmt.Errorf("checking disk usage of %s: %v: %s", path, err, stderr)
+	}
+	return parseDiskUsage(out)
+}
+
+func parseMemInfo(out []byte) (*MemInfo, error) {
+	info := &MemInfo{Fields: make(map[string]uint64)}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		// e.g. "MemTotal:        2048000 kB" or "HugePages_Total:       0"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 || !strings.HasSuffix(fields[0], ":") {
+			return nil, fmt.Errorf("malformed /proc/meminfo line %q", scanner.Text())
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed /proc/meminfo line %q: %v", scanner.Text(), err)
+		}
+		if len(fields) == 3 && fields[2] == "kB" {
+			value *= 1024
+		}
+		info.Fields[strings.TrimSuffix(fields[0], ":")] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	info.Total = info.Fields["MemTotal"]
+	info.Free = info.Fields["MemFree"]
+	info.Available = info.Fields["MemAvailable"]
+	info.SwapTotal = info.Fields["SwapTotal"]
+	info.SwapFree = info.Fields["SwapFree"]
+	return info, nil
+}
+
+func parseDiskUsage(out []byte) (*DiskUsage, error) {
+	// skip the header; -P keeps each filesystem on one line
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if len(lines) != 2 {
+		return nil, fmt.Errorf("unexpected df output %q", out)
+	}
+	fields := strings.Fields(lines[1])
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("malformed df line %q", lines[1])
+	}
+	usage := &DiskUsage{
+		Filesystem: fields[0],
+		Target:     strings.Join(fields[5:], " "),
+	}
+	for i, v := range []*uint64{&usage.Size, &usage.Used, &usage.Available} {
+		n, err := strconv.ParseUint(fields[i+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed df line %q: %v", lines[1], err)
+		}
+		*v = n
+	}
+	return usage, nil
+}
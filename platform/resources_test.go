@@ -0,0 +1,67 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"testing"
+)
+
+func TestParseMemInfo(t *testing.T) {
+	out := []byte(`MemTotal:        2041220 kB
+MemFree:         1570000 kB
+MemAvailable:    1801000 kB
+SwapTotal:             0 kB
+SwapFree:              0 kB
+HugePages_Total:       4
+`)
+	info, err := parseMemInfo(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Total != 2041220*1024 || info.Free != 1570000*1024 || info.Available != 1801000*1024 {
+		t.Errorf("unexpected memory info %+v", info)
+	}
+	if info.Fields["HugePages_Total"] != 4 {
+		t.Errorf("unitless field scaled: %d", info.Fields["HugePages_Total"])
+	}
+
+	if _, err := parseMemInfo([]byte("MemTotal: lots kB\n")); err == nil {
+		t.Errorf("parsed malformed meminfo")
+	}
+}
+
+func TestParseDiskUsage(t *testing.T) {
+	out := []byte(`Filesystem        1-blocks      Used  Available Capacity Mounted on
+/dev/sda9      16000000000 500000000 15000000000       4% /var/lib/with space
+`)
+	usage, err := parseDiskUsage(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := DiskUsage{
+		Filesystem: "/dev/sda9",
+		Target:     "/var/lib/with space",
+		Size:       16000000000,
+		Used:       500000000,
+		Available:  15000000000,
+	}
+	if *usage != want {
+		t.Errorf("got %+v, want %+v", *usage, want)
+	}
+
+	if _, err := parseDiskUsage([]byte("Filesystem\n")); err == nil {
+		t.Errorf("parsed df output without a filesystem")
+	}
+}
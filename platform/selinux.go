@@ -0,0 +1,127 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// SELinux modes, as reported by SELinuxMode.
+const (
+	SELinuxEnforcing  = "enforcing"
+	SELinuxPermissive = "permissive"
+	SELinuxDisabled   = "disabled"
+)
+
+// AVCDenial is an SELinux access vector cache denial logged by the
+// kernel's audit subsystem.
+type AVCDenial struct {
+	Permissions []string // denied permissions, e.g. "read"
+	Comm        string   // command of the denied process
+	Scontext    string   // security context of the denied process
+	Tcontext    string   // security context of the target
+	Tclass      string   // class of the target, e.g. "file"
+	Permissive  bool     // the access was allowed because of permissive mode
+	Raw         string   // the full log message
+}
+
+func (d AVCDenial) String() string {
+	return fmt.Sprintf("denied {%s} for %q: %s -> %s (%s)",
+		strings.Join(d.Permissions, " "), d.Comm, d.Scontext, d.Tcontext, d.Tclass)
+}
+
+// SELinuxMode returns the current SELinux mode of m, one of
+// SELinuxEnforcing, SELinuxPermissive, or SELinuxDisabled. Machines
+// without SELinux tools report SELinuxDisabled.
+func SELinuxMode(m Machine) (string, error) {
+	out, stderr, err := m.SSH("if type -P getenforce >/dev/null; then getenforce; else echo Disabled; fi")
+	if err != nil {
+		return "", fmt.Errorf("getenforce: %v: %s", err, stderr)
+	}
+	mode := strings.ToLower(strings.TrimSpace(string(out)))
+	switch mode {
+	case SELinuxEnforcing, SELinuxPermissive, SELinuxDisabled:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unexpected getenforce output %q", out)
+	}
+}
+
+// SELinuxContext returns the security context of path on m, such as
+// "system_u:object_r:container_runtime_exec_t:s0".
+func SELinuxContext(m Machine, path string) (string, error) {
+	out, stderr, err := m.SSH("stat -c %C -- " + ShellQuote(path))
+	if err != nil {
+		return "", fmt.Errorf("reading security context of %s: %v: %s", path, err, stderr)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// SELinuxDenials returns the AVC denials logged on m since it last
+// booted, including those allowed in permissive mode.
+func SELinuxDenials(m Machine) ([]AVCDenial, error) {
+	out, stderr, err := m.SSH("journalctl -b -o cat --no-pager")
+	if err != nil {
+		return nil, fmt.Errorf("reading journal: %v: %s", err, stderr)
+	}
+	return parseAVCDenials(out), nil
+}
+
+// parseAVCDenials finds the AVC denials in log messages, one per line.
+func parseAVCDenials(out []byte) []AVCDenial {
+	var denials []AVCDenial
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, "avc:")
+		if i < 0 {
+			continue
+		}
+		fields := strings.Fields(line[i+len("avc:"):])
+		if len(fields) < 2 || fields[0] != "denied" || fields[1] != "{" {
+			continue
+		}
+
+		d := AVCDenial{Raw: line}
+		fields = fields[2:]
+		for len(fields) > 0 && fields[0] != "}" {
+			d.Permissions = append(d.Permissions, fields[0])
+			fields = fields[1:]
+		}
+		for _, field := range fields {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch kv[0] {
+			case "comm":
+				d.Comm = strings.Trim(kv[1], `"`)
+			case "scontext":
+				d.Scontext = kv[1]
+			case "tcontext":
+				d.Tcontext = kv[1]
+			case "tclass":
+				d.Tclass = kv[1]
+			case "permissive":
+				d.Permissive = kv[1] == "1"
+			}
+		}
+		denials = append(denials, d)
+	}
+	return denials
+}
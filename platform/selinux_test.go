@@ -0,0 +1,45 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAVCDenials(t *testing.T) {
+	out := []byte(`Started Docker Application Container Engine.
+audit: type=1400 audit(1500000000.123:42): avc:  denied  { read write } for  pid=1234 comm="sh" name="foo" dev="sda9" ino=5678 scontext=system_u:system_r:svirt_lxc_net_t:s0:c1,c2 tcontext=system_u:object_r:var_lib_t:s0 tclass=file permissive=1
+audit: type=1400 audit(1500000000.456:43): avc:  granted  { setenforce } for  pid=1 comm="setenforce"
+`)
+	denials := parseAVCDenials(out)
+	if len(denials) != 1 {
+		t.Fatalf("expected 1 denial, got %d: %v", len(denials), denials)
+	}
+	d := denials[0]
+	if !reflect.DeepEqual(d.Permissions, []string{"read", "write"}) {
+		t.Errorf("unexpected permissions %q", d.Permissions)
+	}
+	if d.Comm != "sh" || d.Tclass != "file" || !d.Permissive {
+		t.Errorf("unexpected denial %+v", d)
+	}
+	if d.Scontext != "system_u:system_r:svirt_lxc_net_t:s0:c1,c2" || d.Tcontext != "system_u:object_r:var_lib_t:s0" {
+		t.Errorf("unexpected contexts %q -> %q", d.Scontext, d.Tcontext)
+	}
+
+	if denials := parseAVCDenials([]byte("avc: nothing\n")); len(denials) != 0 {
+		t.Errorf("parsed bogus denial: %v", denials)
+	}
+}
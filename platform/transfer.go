@@ -0,0 +1,348 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/coreos/pkg/multierror"
+)
+
+// PutDir recursively copies the local directory localDir to remoteDir on m,
+// preserving file modes. Symlinks are copied as symlinks unless
+// followSymlinks is set, in which case their targets are copied instead.
+// Files which can't be read are skipped and reported in the returned error
+// once the rest of the tree has been copied.
+func PutDir(m Machine, localDir, remoteDir string, followSymlinks bool) error {
+	out, stderr, err := m.SSH(fmt.Sprintf("sudo mkdir -p %s", ShellQuote(remoteDir)))
+	if err != nil {
+		return fmt.Errorf("failed creating directory %s: %s: %s: %v", remoteDir, out, stderr, err)
+	}
+
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+	go func() {
+		err := writeTar(pw, localDir, followSymlinks)
+		pw.Close()
+		errc <- err
+	}()
+
+	out, stderr, err = m.SSHWithInput(fmt.Sprintf("sudo tar -x -p -C %s", ShellQuote(remoteDir)), pr)
+	pr.Close()
+	walkErr := <-errc
+	if err != nil {
+		return fmt.Errorf("failed extracting into %s: %s: %s: %v", remoteDir, out, stderr, err)
+	}
+	return walkErr
+}
+
+// GetDir recursively copies remoteDir on m to the local directory localDir,
+// preserving file modes. Symlinks are copied as symlinks unless
+// followSymlinks is set. Files which can't be written are skipped and
+// reported in the returned error once the rest of the tree has been copied.
+func GetDir(m Machine, remoteDir, localDir string, followSymlinks bool) error {
+	cmd := fmt.Sprintf("sudo tar -c -C %s .", ShellQuote(remoteDir))
+	if followSymlinks {
+		cmd = fmt.Sprintf("sudo tar -c -h -C %s .", ShellQuote(remoteDir))
+	}
+	// the archive starts with "./" and ends with zero blocks, so the
+	// whitespace trimmed from the output is never part of it
+	out, stderr, err := m.SSH(cmd)
+
+	extractErr := extractTar(bytes.NewReader(out), localDir)
+	if err != nil {
+		// tar exits non-zero when individual files couldn't be read
+		// but still archives the rest, so report both.
+		var errs multierror.Error
+		errs = append(errs, fmt.Errorf("failed archiving %s: %v: %s", remoteDir, err, stderr))
+		if extractErr != nil {
+			errs = append(errs, extractErr)
+		}
+		return errs.AsError()
+	}
+	return extractErr
+}
+
+// writeTar writes the tree rooted at dir to w as a tar archive with paths
+// relative to dir. Errors reading individual files are collected and
+// returned after the walk; errors writing the archive abort it.
+func writeTar(w io.Writer, dir string, followSymlinks bool) error {
+	tw := tar.NewWriter(w)
+	tb := tarBuilder{
+		tw:             tw,
+		followSymlinks: followSymlinks,
+		visited:        map[string]bool{},
+	}
+	if err := tb.walk(dir, ""); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return tb.errs.AsError()
+}
+
+type tarBuilder struct {
+	tw             *tar.Writer
+	followSymlinks bool
+	visited        map[string]bool // real paths of directories being walked, to break symlink loops
+	errs           multierror.Error
+}
+
+// walk adds the tree rooted at dir to the archive under prefix.
+func (tb *tarBuilder) walk(dir, prefix string) error {
+	// filepath.Walk doesn't descend into a root which is itself a
+	// symlink, so walk the resolved path.
+	real, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		tb.errs = append(tb.errs, err)
+		return nil
+	}
+	if tb.visited[real] {
+		tb.errs = append(tb.errs, fmt.Errorf("skipping %s: symlink loop", dir))
+		return nil
+	}
+	tb.visited[real] = true
+	defer delete(tb.visited, real)
+
+	return filepath.Walk(real, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			tb.errs = append(tb.errs, err)
+			return nil
+		}
+		rel, err := filepath.Rel(real, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		name := filepath.Join(prefix, rel)
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if tb.followSymlinks {
+				target, err := os.Stat(path)
+				if err != nil {
+					tb.errs = append(tb.errs, err)
+					return nil
+				}
+				if target.IsDir() {
+					if err := tb.add(path, name, "", target); err != nil {
+						return err
+					}
+					return tb.walk(path, name)
+				}
+				info = target
+			} else {
+				link, err = os.Readlink(path)
+				if err != nil {
+					tb.errs = append(tb.errs, err)
+					return nil
+				}
+			}
+		}
+
+		return tb.add(path, name, link, info)
+	})
+}
+
+// add writes a single entry to the archive. Only errors writing the archive
+// are returned; errors reading the file are collected in tb.errs.
+func (tb *tarBuilder) add(path, name, link string, info os.FileInfo) error {
+	err := writeTarEntry(tb.tw, path, name, link, info)
+	if _, ok := err.(tarWriteError); ok {
+		return err
+	} else if err != nil {
+		tb.errs = append(tb.errs, err)
+	}
+	return nil
+}
+
+// tarWriteError marks a failure writing the archive itself, as opposed to
+// reading one of the files going into it.
+type tarWriteError struct {
+	error
+}
+
+func writeTarEntry(tw *tar.Writer, path, rel, link string, info os.FileInfo) error {
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+
+	if !info.Mode().IsRegular() {
+		if err := tw.WriteHeader(hdr); err != nil {
+			return tarWriteError{err}
+		}
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return tarWriteError{err}
+	}
+	if _, err := io.CopyN(tw, f, hdr.Size); err != nil {
+		return tarWriteError{err}
+	}
+	return nil
+}
+
+// extractTar unpacks the tar archive in r into dir, preserving modes.
+// Entries which can't be written are skipped and reported in the returned
+// error; entries escaping dir, by name or through symlinks, are rejected.
+func extractTar(r io.Reader, dir string) error {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	var errs multierror.Error
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			errs = append(errs, fmt.Errorf("reading archive: %v", err))
+			break
+		}
+
+		name := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if name == "." {
+			continue
+		}
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			errs = append(errs, fmt.Errorf("refusing to extract %q outside %s", hdr.Name, dir))
+			continue
+		}
+		path := filepath.Join(root, name)
+		mode := os.FileMode(hdr.Mode).Perm()
+		if err := checkParent(root, path); err != nil {
+			errs = append(errs, fmt.Errorf("refusing to extract %q: %v", hdr.Name, err))
+			continue
+		}
+		// replace, rather than write through, a symlink in the way
+		if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			os.Remove(path)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0700); err != nil {
+				errs = append(errs, err)
+			} else if err := os.Chmod(path, mode); err != nil {
+				errs = append(errs, err)
+			}
+		case tar.TypeSymlink:
+			os.Remove(path)
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				errs = append(errs, err)
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := extractFile(tr, path, mode); err != nil {
+				errs = append(errs, err)
+			}
+		default:
+			errs = append(errs, fmt.Errorf("skipping %q: unsupported file type %q", hdr.Name, hdr.Typeflag))
+		}
+	}
+	return errs.AsError()
+}
+
+// checkParent returns an error if the parent directory of path, inside
+// the symlink-free directory root, resolves outside root through symlinks.
+// Only the part of the parent which already exists is resolved; extracting
+// creates the rest as plain directories.
+func checkParent(root, path string) error {
+	parent := filepath.Dir(path)
+	for parent != root {
+		if _, err := os.Lstat(parent); err == nil {
+			break
+		}
+		parent = filepath.Dir(parent)
+	}
+	resolved, err := filepath.EvalSymlinks(parent)
+	if err != nil {
+		return err
+	}
+	if resolved != root && !strings.HasPrefix(resolved, root+string(filepath.Separator)) {
+		return fmt.Errorf("%s resolves to %s, outside %s", parent, resolved, root)
+	}
+	return nil
+}
+
+func extractFile(r io.Reader, path string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// OpenFile's mode is masked by the umask and ignored for
+	// existing files.
+	return os.Chmod(path, mode)
+}
+
+// RunScript copies the local script at localPath to a temporary file on
+// m, runs it with args and removes it again, returning the script's
+// standard output and error. The script needs a #! line; it runs as the
+// SSH user, so it should use sudo for privileged commands.
+func RunScript(m Machine, localPath string, args ...string) ([]byte, []byte, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	return m.SSHWithInput(scriptCommand(args), f)
+}
+
+// scriptCommand returns a shell command which saves its standard input
+// as a temporary executable, runs it with args and removes it, exiting
+// with the script's status.
+func scriptCommand(args []string) string {
+	cmd := `f=$(mktemp) && trap 'rm -f "$f"' EXIT && cat >"$f" && chmod +x "$f" && "$f"`
+	for _, arg := range args {
+		cmd += " " + ShellQuote(arg)
+	}
+	return cmd
+}
@@ -0,0 +1,200 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestTarRoundTrip(t *testing.T) {
+	src, err := ioutil.TempDir("", "kola-transfer-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+
+	if err := os.MkdirAll(filepath.Join(src, "sub", "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "sub", "dir", "script"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "data"), []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("sub", filepath.Join(src, "link")); err != nil {
+		t.Fatal(err)
+	}
+	// a loop must not hang the walk when following symlinks
+	if err := os.Symlink("..", filepath.Join(src, "sub", "up")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, follow := range []bool{false, true} {
+		dst, err := ioutil.TempDir("", "kola-transfer-dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dst)
+
+		var buf bytes.Buffer
+		err = writeTar(&buf, src, follow)
+		if !follow && err != nil {
+			t.Fatalf("writeTar: %v", err)
+		}
+		if err := extractTar(&buf, dst); err != nil {
+			t.Fatalf("extractTar: %v", err)
+		}
+
+		for path, mode := range map[string]os.FileMode{
+			"data":            0600,
+			"sub/dir/script":  0755,
+			"link/dir/script": 0755,
+		} {
+			info, err := os.Stat(filepath.Join(dst, path))
+			if err != nil {
+				t.Errorf("follow=%v: %v", follow, err)
+				continue
+			}
+			if info.Mode().Perm() != mode {
+				t.Errorf("follow=%v: %s has mode %v, expected %v", follow, path, info.Mode().Perm(), mode)
+			}
+		}
+
+		info, err := os.Lstat(filepath.Join(dst, "link"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isLink := info.Mode()&os.ModeSymlink != 0; isLink == follow {
+			t.Errorf("follow=%v: link copied as symlink: %v", follow, isLink)
+		}
+	}
+}
+
+func TestExtractTarRejectsEscape(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeTar(&buf, "testdata-does-not-exist", false); err == nil {
+		t.Errorf("writeTar of a missing directory succeeded")
+	}
+
+	dst, err := ioutil.TempDir("", "kola-transfer-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	buf.Reset()
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "../escape", Mode: 0644, Size: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractTar(&buf, filepath.Join(dst, "inner")); err == nil {
+		t.Errorf("extracting a path outside the destination succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "escape")); !os.IsNotExist(err) {
+		t.Errorf("file escaped the destination directory: %v", err)
+	}
+}
+
+func TestExtractTarSymlinkEscape(t *testing.T) {
+	dst, err := ioutil.TempDir("", "kola-transfer-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	outside := filepath.Join(dst, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+	inner := filepath.Join(dst, "inner")
+	if err := os.Mkdir(inner, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// a symlink left behind by an earlier extraction
+	if err := os.Symlink(filepath.Join(outside, "old"), filepath.Join(inner, "old")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range []*tar.Header{
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: outside},
+		{Name: "link/escape", Mode: 0644, Size: 1},
+		{Name: "link/sub/escape", Mode: 0644, Size: 1},
+		{Name: "old", Mode: 0644, Size: 1},
+	} {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Size > 0 {
+			if _, err := tw.Write([]byte("x")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := extractTar(&buf, inner); err == nil {
+		t.Errorf("extracting through a symlink succeeded")
+	}
+	for _, name := range []string{"escape", "sub", "old"} {
+		if _, err := os.Lstat(filepath.Join(outside, name)); !os.IsNotExist(err) {
+			t.Errorf("%s escaped the destination directory: %v", name, err)
+		}
+	}
+	if fi, err := os.Lstat(filepath.Join(inner, "old")); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("symlink in the way of a file not replaced: %v", err)
+	}
+}
+
+func TestScriptCommand(t *testing.T) {
+	script := "#!/bin/sh\necho \"$0\" >&2\nfor a in \"$@\"; do echo \"[$a]\"; done\nexit 3\n"
+	cmd := exec.Command("sh", "-c", scriptCommand([]string{"a b", "it's", "$HOME"}))
+	cmd.Stdin = strings.NewReader(script)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err := cmd.Run()
+
+	exit, ok := err.(*exec.ExitError)
+	if !ok || exit.Sys().(syscall.WaitStatus).ExitStatus() != 3 {
+		t.Errorf("expected exit status 3, got %v", err)
+	}
+	if got, want := stdout.String(), "[a b]\n[it's]\n[$HOME]\n"; got != want {
+		t.Errorf("got output %q, expected %q", got, want)
+	}
+	path := strings.TrimSpace(stderr.String())
+	if path == "" {
+		t.Fatal("script did not report its path")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("temporary script %s was not removed: %v", path, err)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"encoding/base64"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/mantle/util"
+)
+
+const (
+	unitPollInterval = time.Second
+	unitJournalLines = 50
+)
+
+// WaitForUnit polls m until systemd reports that unit has reached the
+// ActiveState state, such as "active" or "failed". If timeout elapses
+// first, the returned error includes the tail of the unit's journal.
+func (bc *BaseCluster) WaitForUnit(m Machine, unit, state string, timeout time.Duration) error {
+	attempts := int(timeout/unitPollInterval) + 1
+	err := util.Retry(attempts, unitPollInterval, func() error {
+		out, stderr, err := m.SSH("systemctl show -p ActiveState " + ShellQuote(unit))
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, stderr)
+		}
+		if current := strings.TrimPrefix(string(out), "ActiveState="); current != state {
+			return fmt.Errorf("unit is %q", current)
+		}
+		return nil
+	})
+	if err != nil {
+		journal, _, _ := m.SSH(fmt.Sprintf("journalctl --no-pager -n %d -u %s", unitJournalLines, ShellQuote(unit)))
+		return fmt.Errorf("timed out waiting for %s to be %s: %v\n%s", unit, state, err, journal)
+	}
+	return nil
+}
+
+// DropinPath returns the path of the systemd dropin named name for unit,
+// where Ignition and cloud-config write it.
+func DropinPath(unit, name string) string {
+	return path.Join("/etc/systemd/system", unit+".d", name)
+}
+
+// ReadDropin returns the exact contents of the systemd dropin named name
+// for unit on m, including any trailing newlines.
+func ReadDropin(m Machine, unit, name string) (string, error) {
+	// base64 keeps the output from being trimmed
+	file := DropinPath(unit, name)
+	out, stderr, err := m.SSH("base64 -w0 -- " + ShellQuote(file))
+	if err != nil {
+		return "", fmt.Errorf("reading %s: %v: %s", file, err, stderr)
+	}
+	contents, err := base64.StdEncoding.DecodeString(string(out))
+	if err != nil {
+		return "", fmt.Errorf("decoding %s: %v", file, err)
+	}
+	return string(contents), nil
+}
@@ -16,11 +16,16 @@ package platform
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/coreos/mantle/util"
 )
 
 // Manhole connects os.Stdin, os.Stdout, and os.Stderr to an interactive shell
@@ -79,6 +84,38 @@ func Manhole(m Machine) error {
 	return nil
 }
 
+// ExitStatus returns the exit status of a command which failed with err,
+// and whether err reports one at all rather than, say, a connection
+// failure. It understands *ssh.ExitError and any other error with an
+// ExitStatus method.
+func ExitStatus(err error) (int, bool) {
+	if exit, ok := err.(interface {
+		ExitStatus() int
+	}); ok {
+		return exit.ExitStatus(), true
+	}
+	return 0, false
+}
+
+// SSHJSON runs cmd on m and unmarshals its standard output, which must be
+// JSON, into v.
+func SSHJSON(m Machine, cmd string, v interface{}) error {
+	out, stderr, err := m.SSH(cmd)
+	if err != nil {
+		return fmt.Errorf("%q failed: %v: %s", cmd, err, stderr)
+	}
+	return DecodeJSON(cmd, out, v)
+}
+
+// DecodeJSON unmarshals the output of cmd into v, including the raw
+// output in the error if it isn't the expected JSON.
+func DecodeJSON(cmd string, out []byte, v interface{}) error {
+	if err := json.Unmarshal(out, v); err != nil {
+		return fmt.Errorf("could not unmarshal output of %q: %v: %q", cmd, err, out)
+	}
+	return nil
+}
+
 // Enable SELinux on a machine (skip on machines without SELinux support)
 func EnableSelinux(m Machine) error {
 	_, stderr, err := m.SSH("if type -P setenforce; then sudo setenforce 1; fi")
@@ -92,8 +129,9 @@ func EnableSelinux(m Machine) error {
 // Afterwards run CheckMachine to verify the system is back and operational.
 func StartReboot(m Machine) error {
 	// stop sshd so that commonMachineChecks will only work if the machine
-	// actually rebooted
-	out, stderr, err := m.SSH("sudo systemctl stop sshd.socket && sudo reboot")
+	// actually rebooted. The reboot drops the connection, so pass stdin
+	// to keep SSHRetries from rebooting the machine a second time.
+	out, stderr, err := m.SSHWithInput("sudo systemctl stop sshd.socket && sudo reboot", strings.NewReader(""))
 	if _, ok := err.(*ssh.ExitMissingError); ok {
 		// A terminated session is perfectly normal during reboot.
 		err = nil
@@ -108,7 +146,7 @@ func StartReboot(m Machine) error {
 // runtime config.
 func RebootMachine(m Machine, j *Journal, c RuntimeConfig) error {
 	if err := StartReboot(m); err != nil {
-		return fmt.Errorf("machine %q failed to begin rebooting: %v", m.ID(), err)
+		return fmt.Errorf("machine %q failed to begin rebooting: %v", MachineName(m), err)
 	}
 	return StartMachine(m, j, c)
 }
@@ -117,15 +155,33 @@ func RebootMachine(m Machine, j *Journal, c RuntimeConfig) error {
 // runtime config.
 func StartMachine(m Machine, j *Journal, c RuntimeConfig) error {
 	if err := j.Start(context.TODO(), m); err != nil {
-		return fmt.Errorf("machine %q failed to start: %v", m.ID(), err)
+		return fmt.Errorf("machine %q failed to start: %v", MachineName(m), err)
 	}
 	if err := CheckMachine(m); err != nil {
-		return fmt.Errorf("machine %q failed basic checks: %v", m.ID(), err)
+		return fmt.Errorf("machine %q failed basic checks: %v", MachineName(m), err)
 	}
 	if !c.NoEnableSelinux {
 		if err := EnableSelinux(m); err != nil {
-			return fmt.Errorf("machine %q failed to enable selinux: %v", m.ID(), err)
+			return fmt.Errorf("machine %q failed to enable selinux: %v", MachineName(m), err)
 		}
 	}
 	return nil
 }
+
+// WaitForSSH blocks until a command can be run on m over SSH, such as after
+// a reboot, or until timeout elapses. Unlike StartMachine it does not check
+// the machine's health once it is reachable.
+func WaitForSSH(m Machine, timeout time.Duration) error {
+	attempts := int(timeout/sshPollInterval) + 1
+	err := util.Retry(attempts, sshPollInterval, func() error {
+		_, stderr, err := m.SSH("true")
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, stderr)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("machine %q unreachable over SSH after %v: %v", MachineName(m), timeout, err)
+	}
+	return nil
+}
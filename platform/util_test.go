@@ -0,0 +1,41 @@
+// Copyright 2017 CoreOS, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package platform
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	var v struct {
+		Name  string
+		Count int
+	}
+	if err := DecodeJSON("cmd", []byte(`{"Name": "foo", "Count": 2}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Name != "foo" || v.Count != 2 {
+		t.Errorf("got %+v", v)
+	}
+
+	err := DecodeJSON("cmd", []byte("not json"), &v)
+	if err == nil {
+		t.Fatal("decoded bad json")
+	}
+	if !strings.Contains(err.Error(), `"not json"`) {
+		t.Errorf("error %q lacks the raw output", err)
+	}
+}
@@ -37,3 +37,25 @@ func Retry(attempts int, delay time.Duration, f func() error) error {
 
 	return err
 }
+
+// RetryWithBackoff calls function f until it succeeds, returns an error
+// for which retryable reports false, or timeout has elapsed. The delay
+// between calls starts at delay and doubles after each failed call. The
+// error from the last call is returned.
+func RetryWithBackoff(timeout, delay time.Duration, retryable func(error) bool, f func() error) error {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err := f()
+		if err == nil || !retryable(err) {
+			return err
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		time.Sleep(delay)
+		delay *= 2
+	}
+}